@@ -0,0 +1,49 @@
+// Command forecast-alerts-cloudrun serves Cloud Run, running once for each
+// POST to /run, e.g. from a Cloud Scheduler job, and answering with the run's
+// report as JSON. Every other request is answered 404. It listens on $PORT,
+// as Cloud Run sets it. The config can come from environment variables, as
+// forecast-alerts reads them.
+//
+// The container's disk doesn't outlast the instance, so point the sent
+// history, sent products and opt-out files at a mounted Cloud Storage volume
+// to keep them between runs. Leave authentication to Cloud Run's IAM, with
+// the scheduler job sending an OIDC token.
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/scheduler"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/telemetry"
+)
+
+// DefaultPort is listened on when PORT isn't set, as when run locally
+const DefaultPort = "8080"
+
+// RunPath is the path a run is started by POSTing to
+const RunPath = "/run"
+
+func main() {
+	configFile := flag.String("config", config.DefaultFile, "the config `file`, JSON, YAML or TOML")
+	usersFile := flag.String("users", config.DefaultUsersFile, "the users `file`, JSON, YAML or TOML")
+	profile := flag.String("profile", "", "the `profile` whose overrides to apply to the config")
+	flag.Parse()
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = DefaultPort
+	}
+	handler := scheduler.RunHandler(RunPath, scheduler.RunnerOptions{
+		ConfigFile: *configFile,
+		UsersFile:  *usersFile,
+		Profile:    *profile,
+		Metrics:    telemetry.NewMetrics(),
+	})
+	slog.Info("Listening", "port", port, "path", RunPath)
+	err := http.ListenAndServe(":"+port, handler)
+	telemetry.Fatal("Server stopped", "port", port, "err", err)
+}
@@ -0,0 +1,106 @@
+// Command forecast-alerts-lambda sends the subscribed discussion sections
+// once per invocation on AWS Lambda, e.g. on an EventBridge schedule. The
+// config comes from environment variables, as forecast-alerts reads them,
+// or a config.json deployed with the function. The users file and the state
+// kept between runs, such as the sent history and opt-outs, live in the S3
+// bucket named by STATE_BUCKET.
+//
+// Give the function a reserved concurrency of 1 so runs don't overlap. A
+// failed run returns an error, which Lambda retries; turn retries off unless
+// diffMode is set, or the users who were sent to will get it again.
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/scheduler"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/store"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/telemetry"
+)
+
+// StateBucketEnv names the S3 bucket the state is kept in. StatePrefixEnv,
+// if set, is prepended to each file's key, e.g. "alerts/".
+const (
+	StateBucketEnv = "STATE_BUCKET"
+	StatePrefixEnv = "STATE_PREFIX"
+)
+
+func main() {
+	// Only /tmp is writable on Lambda, so the state files are kept there
+	if err := os.Chdir(os.TempDir()); err != nil {
+		telemetry.Fatal("Couldn't change to the temporary directory", "err", err)
+	}
+	lambda.Start(handle)
+}
+
+// handle runs once for a scheduled event and returns the run's report
+func handle(ctx context.Context, event events.CloudWatchEvent) (*scheduler.RunReport, error) {
+	bucket := os.Getenv(StateBucketEnv)
+	if bucket == "" {
+		return nil, errors.New(StateBucketEnv + " isn't set")
+	}
+	taskRoot := os.Getenv("LAMBDA_TASK_ROOT")
+	configFile := filepath.Join(taskRoot, config.DefaultFile)
+	cfg, err := config.Load(configFile, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	httpClient, err := scheduler.NewHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	state, err := store.NewS3State(ctx, bucket, os.Getenv(StatePrefixEnv), httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	// A users file in the bucket takes precedence over one deployed with the
+	// function, so users can be changed without redeploying
+	files := stateFiles(cfg)
+	if err := state.Download(ctx, append(files, config.DefaultUsersFile)...); err != nil {
+		return nil, err
+	}
+	usersFile := config.DefaultUsersFile
+	if _, err := os.Stat(usersFile); os.IsNotExist(err) {
+		usersFile = filepath.Join(taskRoot, config.DefaultUsersFile)
+	}
+
+	runner, err := scheduler.NewRunner(ctx, scheduler.RunnerOptions{
+		ConfigFile: configFile,
+		UsersFile:  usersFile,
+		HTTPClient: httpClient,
+	})
+	if err != nil {
+		return nil, err
+	}
+	slog.SetDefault(runner.Logger)
+	slog.Info("Running", "event", event.ID, "scheduled", event.Time)
+
+	report, runErr := runner.Run(ctx)
+	// Save what was sent even if the run failed, so it isn't sent again
+	if err := state.Upload(ctx, files...); err != nil {
+		return report, errors.Join(runErr, err)
+	}
+	return report, runErr
+}
+
+// stateFiles returns the files the config keeps state in between runs
+func stateFiles(cfg config.Config) []string {
+	files := []string{store.DefaultSentHistoryFile, store.DefaultSentProductsFile, store.DefaultOptOutFile, store.DefaultOfficeCacheFile}
+	for i, name := range []string{cfg.SentHistoryFile, cfg.SentProductsFile, cfg.OptOutFile, cfg.OfficeCacheFile} {
+		if name != "" {
+			files[i] = name
+		}
+	}
+	if cfg.AuditLogFile != "" {
+		files = append(files, cfg.AuditLogFile)
+	}
+	return files
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/scheduler"
+	"github.com/johnwcallahan/forecast-discussion-alerts/nws"
+)
+
+const usage = `Usage: forecast-alerts [flags] [command]
+
+With no command, sends the subscribed discussion sections to every user.
+
+Commands:
+  serve               Send every --interval (15m by default) and serve the
+                      health checks, /metrics, Twilio's callbacks and the
+                      admin API and its UI at /ui/ on serveAddr ($PORT or
+                      :8080 by default)
+  trigger             Like serve, but send only when /run is POSTed to with
+                      triggerToken as a bearer token, e.g. by an external
+                      cron, unless --interval is given too
+  service install|uninstall|start|stop
+                      On Windows, install the service to serve as the serve
+                      command does with the flags given, from the current
+                      directory, or uninstall, start or stop it
+  init                Set up the config and users files, asking for Twilio
+                      credentials and your location and sending a test SMS
+  genkey              Print a new key for encrypted config values, to set as
+                      ALERTS_CONFIG_KEY
+  encrypt [VALUE]     Encrypt a config value, read from stdin if not given,
+                      with the key in ALERTS_CONFIG_KEY
+  offices list        List the forecast office IDs that can be used as locationId
+  locate LAT LON      Show the forecast office and zones covering a location
+  products OFFICE     List the kinds of product an office issues
+  sections OFFICE     List the sections in an office's latest discussion and
+                      rate its severity
+  discussion OFFICE [text|html|markdown]
+                      Print an office's latest discussion in the given format
+
+Flags:
+`
+
+// printFlagDefaults prints the flags, like flag.PrintDefaults, but leaves
+// out the one for each config setting
+func printFlagDefaults() {
+	all := flag.CommandLine
+	visible := flag.NewFlagSet(all.Name(), flag.ContinueOnError)
+	visible.SetOutput(all.Output())
+	all.VisitAll(func(f *flag.Flag) {
+		if !config.IsFlag(f) {
+			visible.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	visible.PrintDefaults()
+	fmt.Fprintln(all.Output(), `
+Every config setting can also be given as a flag named like its environment
+variable, which overrides the config file and environment, e.g.
+--twilio-from-phone=+15035550100 or --nws-requests-per-second=2`)
+}
+
+// newCommandNWSClient returns an NWS client for commands, which run without
+// a config file but take settings such as NWS_BASE_URI from the environment
+func newCommandNWSClient() *nws.Client {
+	var cfg config.Config
+	if err := config.ApplyEnv(&cfg, os.LookupEnv); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	httpClient, _ := scheduler.NewHTTPClient(cfg)
+	return scheduler.NewNWSClientFromConfig(cfg, httpClient)
+}
+
+// runCommand runs the subcommand named in args and returns the exit code
+func runCommand(args []string) int {
+	if len(args) == 3 && args[0] == "locate" {
+		return locate(args[1], args[2])
+	}
+	if len(args) == 2 && args[0] == "products" {
+		return listProductTypes(args[1])
+	}
+	if len(args) == 2 && args[0] == "sections" {
+		return listSections(args[1])
+	}
+	if (len(args) == 2 || len(args) == 3) && args[0] == "discussion" {
+		format := "text"
+		if len(args) == 3 {
+			format = args[2]
+		}
+		return printDiscussion(args[1], format)
+	}
+	if len(args) == 2 && args[0] == "service" {
+		return serviceCommand(args[1])
+	}
+	if (len(args) == 1 || len(args) == 2) && args[0] == "encrypt" {
+		return encryptValue(args[1:])
+	}
+	switch strings.Join(args, " ") {
+	case "genkey":
+		return generateKey()
+	case "offices list":
+		return listOffices()
+	case "help":
+		flag.CommandLine.SetOutput(os.Stdout)
+		flag.Usage()
+		return 0
+	}
+	flag.Usage()
+	return 2
+}
+
+func locate(latArg string, lonArg string) int {
+	lat, err := strconv.ParseFloat(latArg, 64)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid latitude:", latArg)
+		return 2
+	}
+	lon, err := strconv.ParseFloat(lonArg, 64)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid longitude:", lonArg)
+		return 2
+	}
+
+	client := newCommandNWSClient()
+	point, err := client.GetPoint(context.Background(), lat, lon)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("Location:          %s, %s\n", point.City, point.State)
+	fmt.Printf("Office:            %s\n", point.Office)
+	fmt.Printf("Forecast zone:     %s\n", point.ForecastZone)
+	fmt.Printf("County:            %s\n", point.County)
+	fmt.Printf("Fire weather zone: %s\n", point.FireWeatherZone)
+	fmt.Printf("Time zone:         %s\n", point.TimeZone)
+	return 0
+}
+
+func listProductTypes(locationID string) int {
+	client := newCommandNWSClient()
+	types, err := client.GetProductTypes(context.Background(), locationID)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CODE\tNAME")
+	for _, productType := range types {
+		fmt.Fprintf(w, "%s\t%s\n", productType.ProductCode, productType.ProductName)
+	}
+	w.Flush()
+	return 0
+}
+
+func listSections(locationID string) int {
+	client := newCommandNWSClient()
+	product, err := client.GetAFD(context.Background(), locationID)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	afd := product.AFD()
+	for _, name := range afd.Sections() {
+		fmt.Println(name)
+	}
+	severity := afd.Severity()
+	fmt.Printf("\nSeverity: %s (%d)\n", severity.Level, severity.Score)
+	for _, reason := range severity.Reasons {
+		fmt.Println("  " + reason)
+	}
+	return 0
+}
+
+func printDiscussion(locationID string, format string) int {
+	client := newCommandNWSClient()
+	product, err := client.GetAFD(context.Background(), locationID)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	afd := product.AFD()
+	switch format {
+	case "text":
+		for _, name := range afd.Sections() {
+			section, _ := afd.GetDiscussionSection(name)
+			fmt.Println(section + "\n")
+		}
+	case "html":
+		fmt.Print(afd.HTML())
+	case "markdown":
+		fmt.Print(afd.Markdown())
+	default:
+		fmt.Fprintln(os.Stderr, "Unknown format:", format)
+		return 2
+	}
+	return 0
+}
+
+func listOffices() int {
+	client := newCommandNWSClient()
+	offices, err := client.ListOffices(context.Background())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME")
+	for _, office := range offices {
+		fmt.Fprintf(w, "%s\t%s\n", office.ID, office.Name)
+	}
+	w.Flush()
+	return 0
+}
+
+func generateKey() int {
+	key, err := config.GenerateKey()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(key)
+	return 0
+}
+
+func encryptValue(args []string) int {
+	var value string
+	if len(args) == 1 {
+		value = args[0]
+	} else {
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		value = strings.TrimRight(string(data), "\r\n")
+	}
+	encrypted, err := config.EncryptValue(value, os.Getenv(config.KeyEnv))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(encrypted)
+	return 0
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/notify"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/scheduler"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/store"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/telemetry"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/web"
+)
+
+// DefaultServeAddr is where the serve command listens if neither serveAddr
+// nor PORT is set
+const DefaultServeAddr = ":8080"
+
+// serveAddr returns where the serve and trigger commands listen: serveAddr
+// from the config, else all interfaces on $PORT, as platforms such as
+// Fly.io, Render and Heroku set it, else DefaultServeAddr
+func serveAddr(cfg config.Config) string {
+	if cfg.ServeAddr != "" {
+		return cfg.ServeAddr
+	}
+	if port := os.Getenv("PORT"); port != "" {
+		return ":" + port
+	}
+	return DefaultServeAddr
+}
+
+// DefaultServeInterval is how often the serve command runs if --interval
+// isn't given
+const DefaultServeInterval = 15 * time.Minute
+
+// daemon struct runs every interval, or only when asked if interval is 0.
+// SIGHUP or the admin API reloads the config and users once the current run
+// is done; if they're invalid, the old ones stay.
+type daemon struct {
+	options   scheduler.RunnerOptions
+	interval  time.Duration
+	callbacks *swappableHandler
+	// runNow asks for a run before the next tick, trigger for a run answered
+	// with its report, and reload for a reload answered with its error
+	runNow  chan struct{}
+	trigger chan chan *scheduler.RunReport
+	reload  chan chan error
+	// users is where the admin API signs up users
+	users *store.UserStore
+
+	mu         sync.Mutex
+	runner     *scheduler.Runner
+	lastReport *scheduler.RunReport
+}
+
+// newDaemon returns a daemon starting with runner. callbacks serves
+// runner's handler and is given each reloaded runner's.
+func newDaemon(runner *scheduler.Runner, options scheduler.RunnerOptions, interval time.Duration, callbacks *swappableHandler) *daemon {
+	return &daemon{
+		options:   options,
+		interval:  interval,
+		callbacks: callbacks,
+		runNow:    make(chan struct{}, 1),
+		trigger:   make(chan chan *scheduler.RunReport),
+		reload:    make(chan chan error),
+		users:     &store.UserStore{Path: options.UsersFile},
+		runner:    runner,
+	}
+}
+
+// Runner returns the current runner
+func (s *daemon) Runner() *scheduler.Runner {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.runner
+}
+
+// Loop runs now and then every interval, or only when asked if interval is
+// 0, until ctx is done, keeping systemd told of its status if it's running
+// under systemd
+func (s *daemon) Loop(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	var tick <-chan time.Time
+	if s.interval > 0 {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+		s.run(ctx)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopping")
+			sdNotify("STOPPING=1")
+			if err := s.Runner().Lease.Release(); err != nil {
+				slog.Warn("Couldn't release the leader lease", "err", err)
+			}
+			return
+		case <-tick:
+			s.run(ctx)
+		case <-s.runNow:
+			s.run(ctx)
+		case reply := <-s.trigger:
+			reply <- s.run(ctx)
+		case <-hup:
+			s.Reload(ctx)
+		case reply := <-s.reload:
+			reply <- s.Reload(ctx)
+		}
+	}
+}
+
+// run runs once and keeps the report for the admin API. A misconfiguration
+// that fails every run stops the daemon; other failures, such as the leader
+// lease being lost, are in the report and health and the next run tries
+// again.
+func (s *daemon) run(ctx context.Context) *scheduler.RunReport {
+	report, err := s.Runner().Run(ctx)
+	if notify.IsMisconfigured(err) {
+		telemetry.Fatal("The run failed", "err", err)
+	}
+	if err != nil {
+		slog.Error("The run failed", "err", err)
+	}
+	s.mu.Lock()
+	s.lastReport = report
+	s.mu.Unlock()
+	switch {
+	case report.Standby:
+		sdNotify(fmt.Sprintf("STATUS=Standing by at %s, another instance is the leader", report.Started.Format(time.Kitchen)))
+	case err != nil:
+		sdNotify(fmt.Sprintf("STATUS=Last run at %s failed: %v", report.Started.Format(time.Kitchen), err))
+	default:
+		sdNotify(fmt.Sprintf("STATUS=Last run at %s: %d sent, %d failed",
+			report.Started.Format(time.Kitchen), report.MessagesSent, len(report.Failures)))
+	}
+	return report
+}
+
+// KeepLease renews the leader lease, if there is one, a few times a lease
+// until ctx is done, so the leader keeps it between runs and a standby takes
+// it over soon after the leader stops. A renewal that fails is recorded in
+// health, and if the lease then expires a run in progress stops sending.
+func (s *daemon) KeepLease(ctx context.Context) {
+	lease := s.Runner().Lease
+	if lease == nil {
+		return
+	}
+	ticker := time.NewTicker(lease.Duration / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// The current runner's, which a reload replaces
+			lease := s.Runner().Lease
+			if lease == nil {
+				continue
+			}
+			wasHeld := lease.Held()
+			held, err := lease.Acquire()
+			if err != nil {
+				slog.Error("Couldn't renew the leader lease", "path", lease.Path, "err", err)
+				s.Runner().Health.RunFailed(fmt.Errorf("Couldn't renew the leader lease: %v", err))
+			}
+			if wasHeld && !held {
+				slog.Warn("Lost the leader lease, standing by", "path", lease.Path)
+			}
+		}
+	}
+}
+
+// Reload replaces the runner with one loaded from the config and users
+// files, keeping the current one if they're invalid. Only the clients and
+// stores whose settings changed are rebuilt.
+func (s *daemon) Reload(ctx context.Context) error {
+	cfg, err := scheduler.LoadConfig(ctx, s.options)
+	if err != nil {
+		slog.Error("Couldn't reload, keeping the current config", "err", err)
+		return err
+	}
+	options, err := scheduler.WithClients(s.options, cfg)
+	if err != nil {
+		slog.Error("Couldn't reload, keeping the current config", "err", err)
+		return err
+	}
+	reloaded, err := scheduler.NewRunner(ctx, options)
+	if err != nil {
+		slog.Error("Couldn't reload, keeping the current config", "err", err)
+		return err
+	}
+	current := s.Runner()
+	if reloaded.Config.StatusCallbackAddr != current.Config.StatusCallbackAddr {
+		slog.Warn("statusCallbackAddr changed, restart to listen on the new address")
+	}
+	if reloaded.Config.LeaderLeaseFile != current.Config.LeaderLeaseFile || reloaded.Config.LeaderLeaseSeconds != current.Config.LeaderLeaseSeconds {
+		slog.Warn("The leader lease changed, restart to renew it on its new schedule")
+	}
+	s.mu.Lock()
+	s.runner = reloaded
+	s.options = options
+	s.mu.Unlock()
+	slog.SetDefault(reloaded.Logger)
+	s.callbacks.Set(reloaded.Handler())
+	slog.Info("Reloaded the config and users", "users", len(reloaded.Users.Users))
+	return nil
+}
+
+// Handler serves everything the serve and trigger commands host: the health
+// checks, /metrics, /run, the admin API under /admin/ and its UI under /ui/,
+// and Twilio's callbacks at the paths of their URLs
+func (s *daemon) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.options.Health.Healthz)
+	// For platforms whose health checks default to /health
+	mux.HandleFunc("GET /health", s.options.Health.Healthz)
+	mux.HandleFunc("GET /readyz", s.options.Health.Readyz)
+	mux.Handle("GET /metrics", s.options.Metrics)
+	mux.HandleFunc("POST /run", s.triggered(s.runOnce))
+	mux.HandleFunc("GET /admin/report", s.admin(s.getReport))
+	mux.HandleFunc("GET /admin/users", s.admin(s.listUsers))
+	mux.HandleFunc("POST /admin/users", s.admin(s.addUser))
+	mux.HandleFunc("POST /admin/run", s.admin(s.startRun))
+	mux.HandleFunc("POST /admin/reload", s.admin(s.reloadConfig))
+	ui := http.StripPrefix("/ui", web.Handler())
+	mux.HandleFunc("GET /ui/", func(w http.ResponseWriter, r *http.Request) {
+		// Like the admin API, the UI is hidden if no token is configured
+		if s.Runner().Config.AdminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+		ui.ServeHTTP(w, r)
+	})
+	mux.Handle("/", s.callbacks)
+	return mux
+}
+
+// admin requires the admin token as a bearer token, and hides the admin
+// API if no token is configured
+func (s *daemon) admin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := s.Runner().Config.AdminToken
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeAdminJSON(w, http.StatusUnauthorized, map[string]string{"error": "A valid admin token is required"})
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// triggered requires the trigger token as a bearer token, and hides /run if
+// no token is configured
+func (s *daemon) triggered(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := s.Runner().Config.TriggerToken
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="run"`)
+			writeAdminJSON(w, http.StatusUnauthorized, map[string]string{"error": "A valid trigger token is required"})
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// runOnce runs and answers with the report, or refuses if a run is in
+// progress so a cron that fires again meanwhile doesn't queue another
+func (s *daemon) runOnce(w http.ResponseWriter, r *http.Request) {
+	reply := make(chan *scheduler.RunReport, 1)
+	select {
+	case s.trigger <- reply:
+	default:
+		writeAdminJSON(w, http.StatusConflict, map[string]string{"error": "A run is already in progress"})
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, <-reply)
+}
+
+// getReport answers with the last run's report
+func (s *daemon) getReport(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	report := s.lastReport
+	s.mu.Unlock()
+	if report == nil {
+		writeAdminJSON(w, http.StatusNotFound, map[string]string{"error": "Nothing has run yet"})
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, report)
+}
+
+// adminUser is a user as the admin API lists them, without their phone
+// number
+type adminUser struct {
+	ID            int      `json:"id"`
+	FirstName     string   `json:"firstName"`
+	LocationID    string   `json:"locationId"`
+	Subscriptions []string `json:"subscriptions"`
+	Source        string   `json:"source,omitempty"`
+}
+
+// listUsers answers with the users loaded
+func (s *daemon) listUsers(w http.ResponseWriter, r *http.Request) {
+	users := []adminUser{}
+	for _, user := range s.Runner().Users.Users {
+		users = append(users, adminUser{
+			ID:            user.ID,
+			FirstName:     user.FirstName,
+			LocationID:    user.LocationID,
+			Subscriptions: user.Subscriptions,
+			Source:        user.Source,
+		})
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{"users": users})
+}
+
+// signup is what the admin API takes to sign up a user
+type signup struct {
+	FirstName     string   `json:"firstName"`
+	LastName      string   `json:"lastName"`
+	Phone         string   `json:"phone"`
+	LocationID    string   `json:"locationId"`
+	ZIPCode       string   `json:"zipCode"`
+	Subscriptions []string `json:"subscriptions"`
+}
+
+// addUser signs up a user, adding them to the users file, and reloads so
+// they're sent to from the next run
+func (s *daemon) addUser(w http.ResponseWriter, r *http.Request) {
+	var form signup
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&form); err != nil {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid signup: " + err.Error()})
+		return
+	}
+	cfg := s.Runner().Config
+	region := cfg.DefaultPhoneRegion
+	if region == "" {
+		region = config.DefaultPhoneRegion
+	}
+	user := config.User{
+		FirstName:     strings.TrimSpace(form.FirstName),
+		LastName:      strings.TrimSpace(form.LastName),
+		LocationID:    strings.ToUpper(strings.TrimSpace(form.LocationID)),
+		ZIPCode:       strings.TrimSpace(form.ZIPCode),
+		Subscriptions: form.Subscriptions,
+	}
+	phone, err := config.NormalizePhone(form.Phone, region)
+	if err != nil {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid phone: " + err.Error()})
+		return
+	}
+	user.Phone = phone
+	if errs := user.Validate(); len(errs) > 0 {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": errs[0].Error()})
+		return
+	}
+
+	user, err = s.users.Add(user)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, store.ErrUsersNotJSON) {
+			status = http.StatusConflict
+		}
+		writeAdminJSON(w, status, map[string]string{"error": "Couldn't save the user: " + err.Error()})
+		return
+	}
+	slog.Info("Signed up a user", "user", user.ID, "office", user.LocationID, "zipCode", user.ZIPCode)
+
+	reply := make(chan error, 1)
+	select {
+	case s.reload <- reply:
+	case <-r.Context().Done():
+		return
+	}
+	if err := <-reply; err != nil {
+		writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Saved user %d, but couldn't reload: %v", user.ID, err)})
+		return
+	}
+	writeAdminJSON(w, http.StatusCreated, adminUser{
+		ID:            user.ID,
+		FirstName:     user.FirstName,
+		LocationID:    user.LocationID,
+		Subscriptions: user.Subscriptions,
+	})
+}
+
+// startRun starts a run once the current one, if any, is done
+func (s *daemon) startRun(w http.ResponseWriter, r *http.Request) {
+	select {
+	case s.runNow <- struct{}{}:
+	default:
+		// A run is already waiting to start
+	}
+	writeAdminJSON(w, http.StatusAccepted, map[string]string{"status": "Run requested"})
+}
+
+// reloadConfig reloads the config and users once the current run, if any,
+// is done
+func (s *daemon) reloadConfig(w http.ResponseWriter, r *http.Request) {
+	reply := make(chan error, 1)
+	select {
+	case s.reload <- reply:
+	case <-r.Context().Done():
+		return
+	}
+	if err := <-reply; err != nil {
+		writeAdminJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{"status": "Reloaded", "users": len(s.Runner().Users.Users)})
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
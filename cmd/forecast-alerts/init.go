@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/notify"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/scheduler"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/store"
+	"github.com/johnwcallahan/forecast-discussion-alerts/nws"
+)
+
+// DefaultInitSubscriptions are offered to the first user by the init wizard
+var DefaultInitSubscriptions = []string{"SHORT TERM", "LONG TERM"}
+
+// wizard struct asks the questions of the init command
+type wizard struct {
+	in  *bufio.Scanner
+	out io.Writer
+	// eof is set once the input ends, so questions asked until they're
+	// answered can give up
+	eof bool
+}
+
+// ask prints question and returns the answer, or def if it's blank
+func (s *wizard) ask(question string, def string) string {
+	if def != "" {
+		fmt.Fprintf(s.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(s.out, "%s: ", question)
+	}
+	if !s.in.Scan() {
+		s.eof = true
+		return def
+	}
+	if answer := strings.TrimSpace(s.in.Text()); answer != "" {
+		return answer
+	}
+	return def
+}
+
+// confirm asks a yes or no question
+func (s *wizard) confirm(question string, def bool) bool {
+	choices := "y/N"
+	if def {
+		choices = "Y/n"
+	}
+	answer := strings.ToLower(s.ask(question+" ("+choices+")", ""))
+	if answer == "" {
+		return def
+	}
+	return strings.HasPrefix(answer, "y")
+}
+
+// runInit interactively writes a config with Twilio credentials and a users
+// file with a first user, after sending that user a test message. Both files
+// are written as JSON.
+func runInit(in io.Reader, out io.Writer, configFile string, usersFile string) int {
+	w := &wizard{in: bufio.NewScanner(in), out: out}
+	for _, path := range []string{configFile, usersFile} {
+		if ext := filepath.Ext(path); ext != ".json" {
+			fmt.Fprintf(out, "init writes JSON, but %s is %s\n", path, ext)
+			return 2
+		}
+	}
+	if _, err := os.Stat(configFile); err == nil && !w.confirm(configFile+" exists, overwrite it?", false) {
+		return 1
+	}
+
+	fmt.Fprintln(out, "Twilio credentials are on the console dashboard, https://console.twilio.com")
+	var cfg config.Config
+	cfg.TwillioAccountSID = w.ask("Account SID", "")
+	cfg.TwillioAuthToken = w.ask("Auth token", "")
+	cfg.TwillioFromPhone = w.ask("Twilio phone number to send from", "")
+	cfg.DefaultPhoneRegion = strings.ToUpper(w.ask("Region of phone numbers without a country code", config.DefaultPhoneRegion))
+	if from, err := config.NormalizePhone(cfg.TwillioFromPhone, cfg.DefaultPhoneRegion); err == nil {
+		cfg.TwillioFromPhone = from
+	}
+	if errs := cfg.Validate(); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintln(out, "Invalid config:", err)
+		}
+		return 1
+	}
+
+	var user config.User
+	user.FirstName = w.ask("Your first name", "")
+	user.LastName = w.ask("Your last name", "")
+	for user.Phone == "" && !w.eof {
+		phone, err := config.NormalizePhone(w.ask("Your mobile number", ""), cfg.DefaultPhoneRegion)
+		if err != nil {
+			fmt.Fprintln(out, err)
+		}
+		user.Phone = phone
+	}
+
+	client := newCommandNWSClient()
+	for user.LocationID == "" && !w.eof {
+		answer := w.ask("Your forecast office ID, or your latitude,longitude to look it up", "")
+		if parts := strings.Split(answer, ","); len(parts) == 2 {
+			lat, latErr := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+			lon, lonErr := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+			if latErr != nil || lonErr != nil {
+				fmt.Fprintln(out, "Expected a latitude and longitude like 45.52,-122.68")
+				continue
+			}
+			point, err := client.GetPoint(context.Background(), lat, lon)
+			if err != nil {
+				fmt.Fprintln(out, "Couldn't look up the location:", err)
+				continue
+			}
+			fmt.Fprintf(out, "%s, %s is covered by the %s office, forecast zone %s\n", point.City, point.State, point.Office, point.ForecastZone)
+			user.LocationID = point.Office
+			user.ForecastZone = point.ForecastZone
+			user.County = point.County
+			user.TimeZone = point.TimeZone
+			continue
+		}
+		if len(answer) != 3 {
+			fmt.Fprintln(out, "Expected a three-letter office ID like PQR, or a latitude and longitude")
+			continue
+		}
+		user.LocationID = strings.ToUpper(answer)
+	}
+
+	if product, err := client.GetAFD(context.Background(), user.LocationID); err == nil {
+		fmt.Fprintf(out, "The latest %s discussion has the sections: %s\n", user.LocationID, strings.Join(product.AFD().Sections(), ", "))
+	}
+	for _, subscription := range strings.Split(w.ask("Sections to subscribe to, separated by commas", strings.Join(DefaultInitSubscriptions, ", ")), ",") {
+		if subscription = strings.TrimSpace(subscription); subscription != "" {
+			user.Subscriptions = append(user.Subscriptions, nws.NormalizeSectionName(subscription))
+		}
+	}
+	if errs := user.Validate(); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintln(out, "Invalid user:", err)
+		}
+		return 1
+	}
+
+	if w.confirm("Send a test message to "+user.Phone+"?", true) {
+		httpClient, _ := scheduler.NewHTTPClient(cfg)
+		provider := notify.NewTwilioProvider(cfg, httpClient)
+		if _, err := provider.SendSMS(context.Background(), user.Phone, "forecast-discussion-alerts is set up. You'll get the "+user.LocationID+" forecast discussion here."); err != nil {
+			fmt.Fprintln(out, "Couldn't send the test message:", err)
+			if !w.confirm("Save the config anyway?", false) {
+				return 1
+			}
+		} else {
+			fmt.Fprintln(out, "Sent, check your phone")
+		}
+	}
+
+	if err := writeInitConfig(configFile, cfg); err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	fmt.Fprintln(out, "Wrote", configFile)
+	if _, err := (&store.UserStore{Path: usersFile}).Add(user); err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	fmt.Fprintln(out, "Wrote", usersFile)
+	return 0
+}
+
+// writeInitConfig writes only the settings the wizard asked for, readable
+// only by the owner since it holds the auth token
+func writeInitConfig(path string, cfg config.Config) error {
+	data, err := json.MarshalIndent(map[string]string{
+		"twillioAccountSID":  cfg.TwillioAccountSID,
+		"twillioAuthToken":   cfg.TwillioAuthToken,
+		"twillioFromPhone":   cfg.TwillioFromPhone,
+		"defaultPhoneRegion": cfg.DefaultPhoneRegion,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0600)
+}
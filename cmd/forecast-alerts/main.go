@@ -0,0 +1,185 @@
+// Command forecast-alerts texts users the sections of the latest NWS area
+// forecast discussions they subscribe to.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/events"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/scheduler"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/telemetry"
+	"go.opentelemetry.io/otel"
+)
+
+func main() {
+	configFile := flag.String("config", config.DefaultFile, "the config `file`, JSON, YAML or TOML. Relative paths are looked for in the working directory, then ~/.config/"+config.DirName+" and /etc/"+config.DirName+".")
+	usersFile := flag.String("users", config.DefaultUsersFile, "the users `file`, JSON, YAML or TOML, looked for like the config")
+	interval := flag.Duration("interval", 0, "run as a daemon, sending every `interval`, e.g. 15m, instead of once. SIGHUP reloads the config and users.")
+	profile := flag.String("profile", "", "the `profile` whose overrides to apply to the config, e.g. dev, staging or prod (default $"+config.ProfileEnv+" or "+config.DefaultProfile+")")
+	dryRun := flag.Bool("dry-run", false, "print the messages instead of sending them")
+	debug := flag.Bool("debug", false, "log at debug level, including the raw NWS and SMS provider requests and responses with credentials redacted")
+	summaryJSON := flag.String("summary-json", "", "write a JSON report of each run, with each user's outcome, to `path`")
+	overrides := config.Flags(flag.CommandLine)
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		printFlagDefaults()
+	}
+	flag.Parse()
+	// A Windows service starts in the system directory, so it's installed to
+	// run in the directory it was installed from
+	service := flag.NArg() == 3 && flag.Arg(0) == "service" && flag.Arg(1) == "run"
+	if service {
+		if err := os.Chdir(flag.Arg(2)); err != nil {
+			telemetry.Fatal("Couldn't change to the service's directory", "err", err)
+		}
+	}
+	if err := config.LoadDotEnv(config.DefaultDotEnvFile); err != nil {
+		telemetry.Fatal("Couldn't load "+config.DefaultDotEnvFile, "err", err)
+	}
+	if flag.NArg() == 1 && flag.Arg(0) == "init" {
+		os.Exit(runInit(os.Stdin, os.Stdout, *configFile, *usersFile))
+	}
+	serve := flag.NArg() == 1 && flag.Arg(0) == "serve" || service
+	trigger := flag.NArg() == 1 && flag.Arg(0) == "trigger"
+	if flag.NArg() > 0 && !serve && !trigger {
+		os.Exit(runCommand(flag.Args()))
+	}
+	if serve && *interval <= 0 {
+		*interval = DefaultServeInterval
+	}
+
+	// The clock and the state shared across reloads are made here, as are
+	// the clients and stores built from the config below
+	now := time.Now
+	metrics := telemetry.NewMetrics()
+	bus := &events.Bus{}
+	bus.Subscribe(metrics.HandleEvent)
+	options := scheduler.RunnerOptions{
+		ConfigFile:  *configFile,
+		UsersFile:   *usersFile,
+		Profile:     *profile,
+		Overrides:   overrides,
+		Metrics:     metrics,
+		Health:      scheduler.NewHealth(*interval),
+		Alerter:     &scheduler.AdminAlerter{Now: now},
+		Events:      bus,
+		Now:         now,
+		DryRun:      *dryRun,
+		Debug:       *debug,
+		SummaryJSON: *summaryJSON,
+	}
+	// An interrupt or SIGTERM cancels the run in progress, and the daemon
+	// exits instead of starting another
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// Or so does the Windows service manager, if it started us
+	ctx, finishService := startService(ctx)
+	defer finishService()
+
+	cfg, err := scheduler.LoadConfig(ctx, options)
+	if err != nil {
+		telemetry.Fatal("Couldn't start", "err", err)
+	}
+	if options, err = scheduler.WithClients(options, cfg); err != nil {
+		telemetry.Fatal("Couldn't start", "err", err)
+	}
+	runner, err := scheduler.NewRunner(ctx, options)
+	if err != nil {
+		telemetry.Fatal("Couldn't start", "err", err)
+	}
+	slog.SetDefault(runner.Logger)
+
+	if err := telemetry.InitSentry(runner.Config); err != nil {
+		telemetry.Fatal("Couldn't set up Sentry", "err", err)
+	}
+	defer sentry.Flush(telemetry.SentryFlushTimeout)
+	defer telemetry.ReportPanic()
+
+	tracerProvider, err := telemetry.NewTracerProvider(ctx, runner.Config)
+	if err != nil {
+		telemetry.Fatal("Couldn't set up tracing", "err", err)
+	}
+	if tracerProvider != nil {
+		otel.SetTracerProvider(tracerProvider)
+		// Flush the spans of the last run before exiting
+		defer tracerProvider.Shutdown(context.Background())
+	}
+
+	callbacks := &swappableHandler{handler: runner.Handler()}
+	if runner.Config.StatusCallbackAddr != "" {
+		go func() {
+			err := http.ListenAndServe(runner.Config.StatusCallbackAddr, callbacks)
+			telemetry.Fatal("Callback server stopped", "addr", runner.Config.StatusCallbackAddr, "err", err)
+		}()
+	}
+	if runner.Config.MetricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", options.Metrics)
+		mux.HandleFunc("/healthz", options.Health.Healthz)
+		mux.HandleFunc("/readyz", options.Health.Readyz)
+		go func() {
+			err := http.ListenAndServe(runner.Config.MetricsAddr, mux)
+			telemetry.Fatal("Metrics server stopped", "addr", runner.Config.MetricsAddr, "err", err)
+		}()
+	}
+
+	if *interval <= 0 && !trigger {
+		if _, err := runner.Run(ctx); err != nil {
+			telemetry.Fatal("The run failed", "err", err)
+		}
+		return
+	}
+
+	d := newDaemon(runner, options, *interval, callbacks)
+	if serve || trigger {
+		if trigger && runner.Config.TriggerToken == "" {
+			telemetry.Fatal("The trigger command needs triggerToken set")
+		}
+		addr := serveAddr(runner.Config)
+		handler := d.Handler()
+		go func() {
+			err := http.ListenAndServe(addr, handler)
+			telemetry.Fatal("Server stopped", "addr", addr, "err", err)
+		}()
+		slog.Info("Serving", "addr", addr, "interval", *interval)
+	}
+	go watchdog(ctx, options.Health)
+	go d.KeepLease(ctx)
+	sdNotify("READY=1")
+	d.Loop(ctx)
+}
+
+// -----------------------------------------------------------------------------
+// HELPERS
+// -----------------------------------------------------------------------------
+
+// swappableHandler struct serves requests with the latest handler set, so
+// the callback server keeps running when the config is reloaded
+type swappableHandler struct {
+	mu      sync.Mutex
+	handler http.Handler
+}
+
+func (s *swappableHandler) Set(handler http.Handler) {
+	s.mu.Lock()
+	s.handler = handler
+	s.mu.Unlock()
+}
+
+func (s *swappableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	handler := s.handler
+	s.mu.Unlock()
+	handler.ServeHTTP(w, r)
+}
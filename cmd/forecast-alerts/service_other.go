@@ -0,0 +1,21 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// serviceCommand refuses, services being Windows only. Elsewhere run the
+// serve command under systemd or launchd.
+func serviceCommand(action string) int {
+	fmt.Fprintln(os.Stderr, "Services are only supported on Windows, run forecast-alerts serve under systemd or launchd instead")
+	return 1
+}
+
+// startService does nothing outside Windows
+func startService(ctx context.Context) (context.Context, func()) {
+	return ctx, func() {}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// serviceName is the name the service is installed under
+const serviceName = "forecast-alerts"
+
+// serviceLogFile is where a service's output goes, in the directory it runs
+// in, since a service has no console
+const serviceLogFile = "forecast-alerts.log"
+
+// serviceStopTimeout bounds waiting for the service to stop, giving a run
+// in progress time to finish sending
+const serviceStopTimeout = 2 * time.Minute
+
+// serviceCommand installs, uninstalls, starts or stops the Windows service
+func serviceCommand(action string) int {
+	var err error
+	switch action {
+	case "install":
+		err = installService()
+	case "uninstall":
+		err = uninstallService()
+	case "start":
+		err = startInstalledService()
+	case "stop":
+		err = stopInstalledService()
+	default:
+		fmt.Fprintln(os.Stderr, "Unknown service command "+action+", use install, uninstall, start or stop")
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// installService installs the service to start with Windows and serve as
+// the serve command does, with the flags given to install, in the current
+// directory so relative paths in them and the config work the same
+func installService() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	var args []string
+	flag.Visit(func(f *flag.Flag) {
+		args = append(args, "-"+f.Name+"="+f.Value.String())
+	})
+	args = append(args, "service", "run", dir)
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("Couldn't connect to the service manager, run as Administrator: %v", err)
+	}
+	defer m.Disconnect()
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return errors.New("The " + serviceName + " service is already installed")
+	}
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: "Forecast discussion alerts",
+		Description: "Texts subscribers the sections of the latest NWS area forecast discussions",
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	// Restart after a failed run, backing off, and forget failures after a day
+	err = s.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: time.Minute},
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Minute},
+		{Type: mgr.ServiceRestart, Delay: 15 * time.Minute},
+	}, uint32((24 * time.Hour).Seconds()))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Installed the %s service to run in %s, logging to %s there. Start it with: forecast-alerts service start\n", serviceName, dir, serviceLogFile)
+	return nil
+}
+
+// uninstallService stops the service if it's running and removes it
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("Couldn't connect to the service manager, run as Administrator: %v", err)
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return errors.New("The " + serviceName + " service isn't installed")
+	}
+	defer s.Close()
+	if status, err := s.Query(); err == nil && status.State != svc.Stopped {
+		if err := stopService(s); err != nil {
+			return err
+		}
+	}
+	if err := s.Delete(); err != nil {
+		return err
+	}
+	fmt.Println("Uninstalled the " + serviceName + " service")
+	return nil
+}
+
+// startInstalledService starts the installed service
+func startInstalledService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return errors.New("The " + serviceName + " service isn't installed, install it with: forecast-alerts service install")
+	}
+	defer s.Close()
+	if err := s.Start(); err != nil {
+		return err
+	}
+	fmt.Println("Started the " + serviceName + " service")
+	return nil
+}
+
+// stopInstalledService stops the installed service, waiting for it to
+// finish the run in progress
+func stopInstalledService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return errors.New("The " + serviceName + " service isn't installed")
+	}
+	defer s.Close()
+	if err := stopService(s); err != nil {
+		return err
+	}
+	fmt.Println("Stopped the " + serviceName + " service")
+	return nil
+}
+
+// stopService tells the service to stop and waits until it has, giving up
+// after serviceStopTimeout
+func stopService(s *mgr.Service) error {
+	status, err := s.Control(svc.Stop)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(serviceStopTimeout)
+	for status.State != svc.Stopped {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("The %s service didn't stop within %s", serviceName, serviceStopTimeout)
+		}
+		time.Sleep(300 * time.Millisecond)
+		if status, err = s.Query(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startService, when running as a Windows service, sends output to the log
+// file, tells the service manager the service is running and returns ctx
+// canceled when the service is told to stop. finish must be called before
+// exiting, to tell the service manager it stopped.
+func startService(ctx context.Context) (context.Context, func()) {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return ctx, func() {}
+	}
+	logFile, err := os.OpenFile(serviceLogFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err == nil {
+		os.Stdout = logFile
+		os.Stderr = logFile
+		log.SetOutput(logFile)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	handler := &serviceHandler{cancel: cancel, done: make(chan struct{})}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		if err := svc.Run(serviceName, handler); err != nil {
+			log.Printf("The service failed: %v", err)
+			cancel()
+		}
+	}()
+	return ctx, func() {
+		close(handler.done)
+		<-stopped
+	}
+}
+
+// serviceHandler struct answers the service manager, canceling the daemon
+// when told to stop
+type serviceHandler struct {
+	cancel context.CancelFunc
+	// done is closed when the daemon has stopped
+	done chan struct{}
+}
+
+// Execute reports the service running until the daemon stops
+func (s *serviceHandler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case <-s.done:
+			status <- svc.Status{State: svc.StopPending}
+			return false, 0
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				status <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending, WaitHint: uint32(serviceStopTimeout.Milliseconds())}
+				s.cancel()
+			}
+		}
+	}
+}
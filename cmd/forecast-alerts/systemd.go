@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/scheduler"
+)
+
+// sdNotify sends state, e.g. "READY=1", to systemd when running under a
+// Type=notify unit, and does nothing otherwise. See sd_notify(3).
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	// Abstract sockets are given with a leading @
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		slog.Warn("Couldn't notify systemd", "state", state, "err", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		slog.Warn("Couldn't notify systemd", "state", state, "err", err)
+	}
+}
+
+// watchdogInterval returns how often systemd expects a watchdog ping, from
+// WatchdogSec= in the unit, or 0 if the watchdog is off
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// watchdog pings systemd's watchdog at half its interval until ctx is done,
+// but only while health says the daemon is still polling, so a daemon stuck
+// in a run is restarted
+func watchdog(ctx context.Context, health *scheduler.Health) {
+	interval := watchdogInterval()
+	if interval == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if health.Healthy() {
+				sdNotify("WATCHDOG=1")
+			}
+		}
+	}
+}
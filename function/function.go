@@ -0,0 +1,19 @@
+// Package function runs forecast-alerts as a Google Cloud Function. Deploy
+// this package with the SendAlerts entry point, with config.json and
+// users.json alongside it or the config in environment variables, and call it
+// from a Cloud Scheduler job with POST. Each call runs once and answers with
+// the run's report as JSON; any other method or path is answered 404.
+package function
+
+import (
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/scheduler"
+)
+
+func init() {
+	functions.HTTP("SendAlerts", scheduler.RunHandler("/", scheduler.RunnerOptions{
+		ConfigFile: config.DefaultFile,
+		UsersFile:  config.DefaultUsersFile,
+	}).ServeHTTP)
+}
@@ -0,0 +1,69 @@
+package afd
+
+import (
+	"strings"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+	"github.com/johnwcallahan/forecast-discussion-alerts/nws"
+)
+
+// ChangedMarker marks new sentences in DiffModeMark
+const ChangedMarker = "» "
+
+// DiffSection compares a formatted section with the version sent before and
+// returns what to send in the given mode, or false if nothing has changed.
+// Sentences count as changed if they don't appear anywhere in previous.
+func DiffSection(previous string, current string, mode string) (string, bool) {
+	if normalizeSentence(previous) == normalizeSentence(current) {
+		return "", false
+	}
+	if mode != config.DiffModeChanged && mode != config.DiffModeMark {
+		return current, true
+	}
+
+	header, body := nws.SplitSectionHeader(current)
+	_, previous = nws.SplitSectionHeader(previous)
+
+	seen := make(map[string]bool)
+	for _, sentence := range nws.SplitSentences(strings.Join(strings.Fields(previous), " ")) {
+		seen[normalizeSentence(sentence)] = true
+	}
+
+	changed := false
+	diffLine := func(line string) string {
+		var sentences []string
+		for _, sentence := range nws.SplitSentences(line) {
+			isNew := !seen[normalizeSentence(sentence)]
+			changed = changed || isNew
+			switch {
+			case isNew && mode == config.DiffModeMark:
+				sentences = append(sentences, ChangedMarker+sentence)
+			case isNew || mode == config.DiffModeMark:
+				sentences = append(sentences, sentence)
+			}
+		}
+		return strings.Join(sentences, " ")
+	}
+
+	var paragraphs []string
+	for _, paragraph := range paragraphRe.Split(body, -1) {
+		// Keep list items on their own lines
+		var lines []string
+		for _, line := range strings.Split(paragraph, "\n") {
+			if line = diffLine(line); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) > 0 {
+			paragraphs = append(paragraphs, strings.Join(lines, "\n"))
+		}
+	}
+	if !changed {
+		return "", false
+	}
+	return header + strings.Join(paragraphs, "\n\n"), true
+}
+
+func normalizeSentence(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
@@ -0,0 +1,42 @@
+package afd
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+	"github.com/johnwcallahan/forecast-discussion-alerts/nws"
+)
+
+// KeywordAlert returns a message quoting every sentence of the discussion
+// that matches one of the user's keywords, or an empty string if none do
+func KeywordAlert(user config.User, afd *nws.AFD) string {
+	if len(user.KeywordRules) == 0 {
+		return ""
+	}
+
+	var matched []string
+	var quotes []string
+	for _, name := range afd.Sections() {
+		section, _ := afd.Section(name)
+		text := strings.Join(strings.Fields(section.Body), " ")
+		for _, sentence := range nws.SplitSentences(text) {
+			found := false
+			for _, rule := range user.KeywordRules {
+				if rule.Matches(sentence) {
+					found = true
+					if !slices.Contains(matched, rule.Keyword) {
+						matched = append(matched, rule.Keyword)
+					}
+				}
+			}
+			if found {
+				quotes = append(quotes, section.Name+": "+sentence)
+			}
+		}
+	}
+	if len(quotes) == 0 {
+		return ""
+	}
+	return "KEYWORD ALERT (" + strings.Join(matched, ", ") + ")" + nws.SectionHeaderSep + strings.Join(quotes, "\n\n")
+}
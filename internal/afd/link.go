@@ -0,0 +1,82 @@
+package afd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+)
+
+// DefaultAFDLinkTemplate points at the office's latest AFD on
+// forecast.weather.gov. {office} is replaced by the office's location ID.
+const DefaultAFDLinkTemplate = "https://forecast.weather.gov/product.php?site={office}&issuedby={office}&product=AFD&format=txt&version=1&glossary=0"
+
+// AFDLinker struct builds (optionally shortened) links to the full discussion
+type AFDLinker struct {
+	Template   string
+	Shorten    bool
+	HTTPClient *http.Client
+
+	mu    sync.Mutex
+	links map[string]string
+}
+
+// NewAFDLinker returns a linker using the template and shortening in config
+func NewAFDLinker(config config.Config, httpClient *http.Client) *AFDLinker {
+	template := config.AFDLinkTemplate
+	if template == "" {
+		template = DefaultAFDLinkTemplate
+	}
+	return &AFDLinker{
+		Template:   template,
+		Shorten:    config.ShortenAFDLinks,
+		HTTPClient: httpClient,
+		links:      make(map[string]string),
+	}
+}
+
+// Link returns the link to an office's full discussion. Shortened links are
+// cached so each office is only shortened once per run. If shortening fails
+// the full link is returned.
+func (s *AFDLinker) Link(locationID string) string {
+	locationID = strings.ToUpper(locationID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if link, ok := s.links[locationID]; ok {
+		return link
+	}
+
+	link := strings.Replace(s.Template, "{office}", url.QueryEscape(locationID), -1)
+	if s.Shorten {
+		short, err := s.shortenURL(link)
+		if err != nil {
+			slog.Warn("Couldn't shorten link", "office", locationID, "err", err)
+		} else {
+			link = short
+		}
+	}
+	s.links[locationID] = link
+	return link
+}
+
+// shortenURL shortens a link with is.gd, see https://is.gd/apishorteningreference.php
+func (s *AFDLinker) shortenURL(link string) (string, error) {
+	resp, err := s.HTTPClient.Get("https://is.gd/create.php?format=simple&url=" + url.QueryEscape(link))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("%s", body)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
@@ -0,0 +1,83 @@
+// Package afd picks, splits, diffs, summarizes and translates the sections
+// of area forecast discussions.
+package afd
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+	"github.com/johnwcallahan/forecast-discussion-alerts/nws"
+)
+
+// ErrSectionMissing is wrapped by the errors for subscribed sections the
+// discussion doesn't have
+var ErrSectionMissing = errors.New("Section missing from the discussion")
+
+// KeywordAlertSection is the key of the keyword alert in the sections from
+// SubscribedSections
+const KeywordAlertSection = "KEYWORDS"
+
+// SubscribedSections gets the text of each section of the AFD that a user is
+// subscribed to, keyed by normalized section name, with any keyword alert
+// under KeywordAlertSection. The error, if any, joins one wrapping
+// ErrSectionMissing for each subscribed section that wasn't found, and the
+// sections that were found are still returned.
+func SubscribedSections(product *nws.Product, user config.User, config config.Config) (map[string]string, error) {
+	// Offices that split the discussion by zone send each user their part
+	afd := product.AFDFor(user.Zones()...)
+	afd.Aliases = config.SectionAliasesFor(user.LocationID)
+	if user.MinSeverity != "" {
+		if severity := afd.Severity(); !severity.AtLeast(user.MinSeverity) {
+			slog.Info("Skipping user, the discussion isn't severe enough",
+				"user", user.ID, "office", user.LocationID, "product", product.ID, "severity", severity.Level, "minSeverity", user.MinSeverity)
+			return nil, nil
+		}
+	}
+
+	sections := make(map[string]string, len(user.Subscriptions)+1)
+	var errs []error
+	for _, subscription := range user.Subscriptions {
+		name := nws.NormalizeSectionName(subscription)
+		if name == nws.HeadlinesSection {
+			headlines, err := afd.GetHeadlines(user.HeadlineStates()...)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%w: %s has no %s in %s", ErrSectionMissing, strings.ToUpper(user.LocationID), name, product.ID))
+				continue
+			}
+			sections[name] = headlines
+			continue
+		}
+
+		section, err := afd.GetDiscussionSection(subscription)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%w: %s has no %s in %s, available: %s",
+				ErrSectionMissing, strings.ToUpper(user.LocationID), name, product.ID, strings.Join(afd.Sections(), ", ")))
+			continue
+		}
+		if forecaster := afd.SignatureFor(subscription); config.SignSections && forecaster != "" {
+			section += "\n\n- " + forecaster
+		}
+		sections[name] = section
+	}
+	if alert := KeywordAlert(user, afd); alert != "" {
+		sections[KeywordAlertSection] = alert
+	}
+
+	return sections, errors.Join(errs...)
+}
+
+// SectionOrder returns the keys of the sections from SubscribedSections in
+// the order they're sent: the user's subscriptions, then the keyword alert
+func SectionOrder(user config.User) []string {
+	names := make([]string, 0, len(user.Subscriptions)+1)
+	for _, subscription := range user.Subscriptions {
+		if name := nws.NormalizeSectionName(subscription); !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return append(names, KeywordAlertSection)
+}
@@ -0,0 +1,117 @@
+package afd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/nws"
+)
+
+var paragraphRe = regexp.MustCompile(`\n\s*\n`)
+
+// SplitMessage splits text into parts no longer than limit, breaking on
+// paragraph boundaries first, then sentences, then words
+func SplitMessage(text string, limit int) []string {
+	text = strings.TrimSpace(text)
+	if len(text) <= limit {
+		return []string{text}
+	}
+
+	var parts []string
+	current := ""
+	flush := func() {
+		if current != "" {
+			parts = append(parts, current)
+			current = ""
+		}
+	}
+	add := func(chunk, sep string) {
+		if current == "" {
+			current = chunk
+		} else if len(current)+len(sep)+len(chunk) <= limit {
+			current += sep + chunk
+		} else {
+			flush()
+			current = chunk
+		}
+	}
+
+	for _, paragraph := range paragraphRe.Split(text, -1) {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		if len(paragraph) <= limit {
+			add(paragraph, "\n\n")
+			continue
+		}
+
+		flush()
+		for _, sentence := range nws.SplitSentences(paragraph) {
+			if len(sentence) <= limit {
+				add(sentence, " ")
+				continue
+			}
+
+			for _, word := range strings.Fields(sentence) {
+				for len(word) > limit {
+					flush()
+					cut := cutIndex(word, limit)
+					parts = append(parts, word[:cut])
+					word = word[cut:]
+				}
+				add(word, " ")
+			}
+		}
+		flush()
+	}
+	flush()
+
+	return parts
+}
+
+// cutIndex returns where to cut s to keep at most n bytes without splitting a
+// multi-byte rune, taking the whole first rune if it alone is longer than n
+func cutIndex(s string, n int) int {
+	if n >= len(s) {
+		return len(s)
+	}
+	for i := n; i > 0; i-- {
+		if utf8.RuneStart(s[i]) {
+			return i
+		}
+	}
+	_, size := utf8.DecodeRuneInString(s)
+	return size
+}
+
+// SplitSection splits a formatted discussion section into messages no longer
+// than limit. When more than one message is needed, each is prefixed with a
+// "(1/3)"-style counter and the section name so they still read correctly if
+// delivered out of order.
+func SplitSection(section string, limit int) []string {
+	section = strings.TrimSpace(section)
+	if len(section) <= limit {
+		return []string{section}
+	}
+
+	name, body := "", section
+	if i := strings.Index(section, nws.SectionHeaderSep); i >= 0 {
+		name, body = section[:i], section[i+len(nws.SectionHeaderSep):]
+	}
+	prefix := func(i int, n int) string {
+		if name == "" {
+			return fmt.Sprintf("(%d/%d) ", i, n)
+		}
+		return fmt.Sprintf("(%d/%d) %s%s", i, n, name, nws.SectionHeaderSep)
+	}
+
+	// Leave room for the longest counter we're likely to need
+	parts := SplitMessage(body, limit-len(prefix(99, 99)))
+	for i := range parts {
+		parts[i] = prefix(i+1, len(parts)) + parts[i]
+	}
+	return parts
+}
@@ -0,0 +1,213 @@
+package afd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/httpjson"
+	"github.com/johnwcallahan/forecast-discussion-alerts/nws"
+)
+
+// DefaultSummarySections are the sections summarized when the config doesn't
+// name any
+var DefaultSummarySections = []string{"LONG TERM"}
+
+// Summarizer is implemented by each way we can condense a section
+type Summarizer interface {
+	// Summarize condenses text to at most maxLength characters
+	Summarize(ctx context.Context, text string, maxLength int) (string, error)
+}
+
+// NewSummarizer returns the summarizer selected in config, or nil if
+// summarizing is off
+func NewSummarizer(config config.Summarizer, httpClient *http.Client) (Summarizer, error) {
+	if config.MaxLength <= 0 {
+		return nil, nil
+	}
+	switch strings.ToLower(config.Backend) {
+	case "", "extractive":
+		return ExtractiveSummarizer{}, nil
+	case "llm":
+		if config.LLMURL == "" || config.LLMModel == "" {
+			return nil, errors.New("The llm summarizer needs llmURL and llmModel")
+		}
+		return &LLMSummarizer{
+			URL:        config.LLMURL,
+			APIKey:     config.LLMAPIKey,
+			Model:      config.LLMModel,
+			HTTPClient: httpClient,
+		}, nil
+	}
+	return nil, errors.New("Unknown summarizer " + config.Backend)
+}
+
+// SummarizeSection condenses the text of a formatted section that is longer
+// than maxLength and is one of the given sections, keeping its header. It
+// reports whether the section was summarized.
+func SummarizeSection(ctx context.Context, summarizer Summarizer, section string, sections []string, maxLength int) (string, bool, error) {
+	header, body := nws.SplitSectionHeader(section)
+	if len(body) <= maxLength || !summarizesSection(sections, nws.FormattedSectionName(section)) {
+		return section, false, nil
+	}
+	summary, err := summarizer.Summarize(ctx, body, maxLength)
+	if err != nil {
+		return section, false, err
+	}
+	return header + summary, true, nil
+}
+
+func summarizesSection(sections []string, name string) bool {
+	if len(sections) == 0 {
+		sections = DefaultSummarySections
+	}
+	name = nws.NormalizeSectionName(name)
+	for _, section := range sections {
+		if nws.NormalizeSectionName(section) == name {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	summaryWordRe = regexp.MustCompile(`[A-Za-z][A-Za-z']+`)
+	stopWords     = map[string]bool{
+		"the": true, "and": true, "for": true, "with": true, "that": true, "this": true,
+		"will": true, "into": true, "from": true, "are": true, "was": true, "but": true,
+		"its": true, "over": true, "then": true, "than": true, "some": true, "more": true,
+		"our": true, "any": true, "has": true, "have": true, "been": true, "also": true,
+	}
+)
+
+// ExtractiveSummarizer struct summarizes by picking the sentences that use
+// the section's most frequent words, kept in their original order
+type ExtractiveSummarizer struct{}
+
+// Summarize picks sentences from text until maxLength is reached
+func (s ExtractiveSummarizer) Summarize(ctx context.Context, text string, maxLength int) (string, error) {
+	sentences := nws.SplitSentences(strings.Join(strings.Fields(text), " "))
+
+	frequency := make(map[string]int)
+	for _, word := range summaryWordRe.FindAllString(strings.ToLower(text), -1) {
+		if !stopWords[word] {
+			frequency[word]++
+		}
+	}
+	scores := make([]float64, len(sentences))
+	for i, sentence := range sentences {
+		words := summaryWordRe.FindAllString(strings.ToLower(sentence), -1)
+		for _, word := range words {
+			scores[i] += float64(frequency[word])
+		}
+		if len(words) > 0 {
+			scores[i] /= float64(len(words))
+		}
+	}
+	// The first sentence usually sets up the rest, so it always comes first
+	if len(scores) > 0 {
+		scores[0] = 1e9
+	}
+
+	order := make([]int, len(sentences))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+
+	picked := make([]bool, len(sentences))
+	length := 0
+	for _, i := range order {
+		if length+len(sentences[i])+1 > maxLength {
+			continue
+		}
+		picked[i] = true
+		length += len(sentences[i]) + 1
+	}
+
+	var summary []string
+	for i, sentence := range sentences {
+		if picked[i] {
+			summary = append(summary, sentence)
+		}
+	}
+	if len(summary) == 0 && len(sentences) > 0 {
+		return truncate(sentences[0], maxLength), nil
+	}
+	return strings.Join(summary, " "), nil
+}
+
+// LLMSummarizer struct summarizes with a language model behind an
+// OpenAI-compatible chat completions API
+type LLMSummarizer struct {
+	URL        string
+	APIKey     string
+	Model      string
+	HTTPClient *http.Client
+}
+
+// Summarize asks the model for a summary of text, truncating it if the model
+// overshoots maxLength
+func (s *LLMSummarizer) Summarize(ctx context.Context, text string, maxLength int) (string, error) {
+	request := map[string]interface{}{
+		"model": s.Model,
+		"messages": []map[string]string{
+			{
+				"role": "system",
+				"content": fmt.Sprintf("Summarize this section of a National Weather Service Area Forecast Discussion "+
+					"for a text message in plain language, in at most %d characters. Reply with only the summary.", maxLength),
+			},
+			{"role": "user", "content": text},
+		},
+	}
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("POST", s.URL, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.APIKey)
+	}
+
+	var completion struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := httpjson.Do(ctx, s.HTTPClient, req, &completion); err != nil {
+		return "", err
+	}
+	if len(completion.Choices) == 0 {
+		return "", errors.New("Summarizer returned no summary")
+	}
+	return truncate(strings.TrimSpace(completion.Choices[0].Message.Content), maxLength), nil
+}
+
+// truncate shortens s to at most limit bytes, ending on a word boundary, or
+// at least a rune boundary
+func truncate(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	if limit <= 3 {
+		return s[:cutIndex(s, limit)]
+	}
+	cut := strings.LastIndex(s[:cutIndex(s, limit-3)], " ")
+	if cut <= 0 {
+		cut = cutIndex(s, limit-3)
+	}
+	return s[:cut] + "..."
+}
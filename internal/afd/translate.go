@@ -0,0 +1,165 @@
+package afd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/httpjson"
+)
+
+// DefaultLibreTranslateURL is the public LibreTranslate instance, which
+// needs an API key
+const DefaultLibreTranslateURL = "https://libretranslate.com/translate"
+
+// DefaultDeepLURL is the DeepL API Free endpoint. Pro accounts use
+// https://api.deepl.com/v2/translate.
+const DefaultDeepLURL = "https://api-free.deepl.com/v2/translate"
+
+// Translator is implemented by each translation service we can use
+type Translator interface {
+	// Translate translates English text into the language with the given
+	// ISO 639-1 code, e.g. "es"
+	Translate(ctx context.Context, text string, language string) (string, error)
+}
+
+// NewTranslator returns the translator selected in config, or nil if
+// translation is off. Translations are cached, since users of the same office
+// get the same text.
+func NewTranslator(config config.Translator, httpClient *http.Client) (Translator, error) {
+	var translator Translator
+	switch strings.ToLower(config.Backend) {
+	case "":
+		return nil, nil
+	case "libretranslate":
+		endpoint := config.URL
+		if endpoint == "" {
+			endpoint = DefaultLibreTranslateURL
+		}
+		translator = &LibreTranslator{URL: endpoint, APIKey: config.APIKey, HTTPClient: httpClient}
+	case "deepl":
+		endpoint := config.URL
+		if endpoint == "" {
+			endpoint = DefaultDeepLURL
+		}
+		translator = &DeepLTranslator{URL: endpoint, APIKey: config.APIKey, HTTPClient: httpClient}
+	default:
+		return nil, errors.New("Unknown translator " + config.Backend)
+	}
+	return &cachingTranslator{Translator: translator, cache: make(map[string]string)}, nil
+}
+
+// TranslateMessage translates a message into the user's language, returning
+// it unchanged for English or if translator is nil
+func TranslateMessage(ctx context.Context, translator Translator, message string, language string) (string, error) {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if translator == nil || language == "" || language == "en" || strings.HasPrefix(language, "en-") {
+		return message, nil
+	}
+	return translator.Translate(ctx, message, language)
+}
+
+// cachingTranslator struct remembers each translation for the rest of the run
+type cachingTranslator struct {
+	Translator
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+func (s *cachingTranslator) Translate(ctx context.Context, text string, language string) (string, error) {
+	key := language + "\x00" + text
+	s.mu.Lock()
+	translated, ok := s.cache[key]
+	s.mu.Unlock()
+	if ok {
+		return translated, nil
+	}
+
+	translated, err := s.Translator.Translate(ctx, text, language)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	s.cache[key] = translated
+	s.mu.Unlock()
+	return translated, nil
+}
+
+// LibreTranslator struct translates with LibreTranslate, see
+// https://libretranslate.com/docs
+type LibreTranslator struct {
+	URL        string
+	APIKey     string
+	HTTPClient *http.Client
+}
+
+// Translate translates text from English
+func (s *LibreTranslator) Translate(ctx context.Context, text string, language string) (string, error) {
+	data, err := json.Marshal(map[string]string{
+		"q":       text,
+		"source":  "en",
+		"target":  language,
+		"format":  "text",
+		"api_key": s.APIKey,
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("POST", s.URL, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp struct {
+		TranslatedText string `json:"translatedText"`
+	}
+	if err := httpjson.Do(ctx, s.HTTPClient, req, &resp); err != nil {
+		return "", err
+	}
+	return resp.TranslatedText, nil
+}
+
+// DeepLTranslator struct translates with DeepL, see
+// https://developers.deepl.com/docs/api-reference/translate
+type DeepLTranslator struct {
+	URL        string
+	APIKey     string
+	HTTPClient *http.Client
+}
+
+// Translate translates text from English
+func (s *DeepLTranslator) Translate(ctx context.Context, text string, language string) (string, error) {
+	form := url.Values{
+		"text":                {text},
+		"source_lang":         {"EN"},
+		"target_lang":         {strings.ToUpper(language)},
+		"preserve_formatting": {"1"},
+	}
+	req, err := http.NewRequest("POST", s.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "DeepL-Auth-Key "+s.APIKey)
+
+	var resp struct {
+		Translations []struct {
+			Text string `json:"text"`
+		} `json:"translations"`
+	}
+	if err := httpjson.Do(ctx, s.HTTPClient, req, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Translations) == 0 {
+		return "", errors.New("DeepL returned no translation")
+	}
+	return resp.Translations[0].Text, nil
+}
@@ -0,0 +1,274 @@
+// Package config loads and validates the config and users files.
+package config
+
+import (
+	"strings"
+)
+
+// Config struct holds our config
+type Config struct {
+	// SMSProvider selects the gateway to send through: "twilio" (the
+	// default), "vonage", "sns" or "messagebird"
+	SMSProvider string      `json:"smsProvider"`
+	Vonage      Vonage      `json:"vonage"`
+	SNS         SNS         `json:"sns"`
+	MessageBird MessageBird `json:"messageBird"`
+
+	TwillioAccountSID string `json:"twillioAccountSID"`
+	TwillioAuthToken  string `json:"twillioAuthToken"`
+	TwillioFromPhone  string `json:"twillioFromPhone"`
+	// TwillioTestMode sends through Twilio's test credentials so the whole
+	// pipeline can be exercised without sending real messages
+	TwillioTestMode       bool   `json:"twillioTestMode"`
+	TwillioTestAccountSID string `json:"twillioTestAccountSID"`
+	TwillioTestAuthToken  string `json:"twillioTestAuthToken"`
+	// TwillioFromPhones is a pool of numbers to shard users across, to stay
+	// under per-number throughput limits. It takes precedence over
+	// TwillioFromPhone.
+	TwillioFromPhones []string `json:"twillioFromPhones"`
+	// TwillioMessagingServiceSID, when set, is used instead of TwillioFromPhone
+	// so Twilio picks the sending number from the service's pool
+	TwillioMessagingServiceSID string `json:"twillioMessagingServiceSID"`
+	// TwillioStatusCallbackURL is the public URL Twilio posts delivery
+	// statuses to. StatusCallbackAddr is the local address to serve it on.
+	TwillioStatusCallbackURL string `json:"twillioStatusCallbackURL"`
+	StatusCallbackAddr       string `json:"statusCallbackAddr"`
+	// TwillioInboundURL is the public URL Twilio posts replies to, so STOP
+	// replies are added to the opt-out list kept in OptOutFile
+	TwillioInboundURL string `json:"twillioInboundURL"`
+	OptOutFile        string `json:"optOutFile"`
+	// MaxDeliveryRetries is how many times a message Twilio reports
+	// undelivered is resent through the same provider. There's no fallback
+	// to another channel. DeliveryTimeoutSeconds bounds waiting for the
+	// final statuses after a run.
+	MaxDeliveryRetries     int `json:"maxDeliveryRetries"`
+	DeliveryTimeoutSeconds int `json:"deliveryTimeoutSeconds"`
+	// AlphanumericSenderIDs maps a country calling code (e.g. "44") to the
+	// sender ID to use for numbers in that country, where carriers allow it
+	AlphanumericSenderIDs map[string]string `json:"alphanumericSenderIDs"`
+	// DefaultPhoneRegion is the ISO country code assumed for user phone
+	// numbers written without a country code, "US" if unset
+	DefaultPhoneRegion string `json:"defaultPhoneRegion"`
+	// AppendAFDLink adds a link to the full discussion after the last section
+	// sent to each user. AFDLinkTemplate can point it at a self-hosted
+	// archive, with {office} standing in for the location ID.
+	AppendAFDLink   bool   `json:"appendAFDLink"`
+	AFDLinkTemplate string `json:"afdLinkTemplate"`
+	ShortenAFDLinks bool   `json:"shortenAFDLinks"`
+	// DiffMode controls sections that were sent before: "changed" sends only
+	// new sentences, "mark" marks them, and either skips sections that
+	// haven't changed. SentHistoryFile keeps what was last sent.
+	DiffMode        string `json:"diffMode"`
+	SentHistoryFile string `json:"sentHistoryFile"`
+	// SentProductsFile keeps the last discussion sent to each user, which
+	// isn't sent again however often it's polled
+	SentProductsFile string `json:"sentProductsFile"`
+	// AuditLogFile, if set, has a JSON line appended for every message sent,
+	// scheduled or refused and every final delivery status
+	AuditLogFile string `json:"auditLogFile"`
+	// ExpandAbbreviations replaces forecaster jargon such as "CAA" and "PoPs"
+	// with plain language
+	ExpandAbbreviations bool `json:"expandAbbreviations"`
+	// Summarizer condenses long sections, with a link to the full text
+	Summarizer Summarizer `json:"summarizer"`
+	// Translator translates messages for users with a Language set
+	Translator Translator `json:"translator"`
+	// SectionAliases maps a section name to other headings that should match
+	// it, on top of the built-in aliases, for all offices under "*" or for
+	// one office under its ID, e.g. {"*": {"long term": ["days 3-7"]}}
+	SectionAliases map[string]map[string][]string `json:"sectionAliases"`
+	// SignSections ends each section with the forecaster who wrote it
+	SignSections bool `json:"signSections"`
+	// NWSBaseURI overrides the NWS API address, e.g. for a caching proxy
+	NWSBaseURI string `json:"nwsBaseURI"`
+	// HTTPTimeoutSeconds bounds every outgoing request. HTTPProxy sends them
+	// through a proxy.
+	HTTPTimeoutSeconds int    `json:"httpTimeoutSeconds"`
+	HTTPProxy          string `json:"httpProxy"`
+	// NWSUserAgent should identify the operator with contact details, e.g.
+	// "(myweatherapp.com, contact@myweatherapp.com)", as the NWS API requires
+	NWSUserAgent         string  `json:"nwsUserAgent"`
+	NWSRequestsPerSecond float64 `json:"nwsRequestsPerSecond"`
+	// NWSMaxRetries and NWSRetryDelayMS tune how transient NWS API errors
+	// are retried
+	NWSMaxRetries   int `json:"nwsMaxRetries"`
+	NWSRetryDelayMS int `json:"nwsRetryDelayMS"`
+	// After NWSBreakerThreshold failed requests in a row, NWS requests are
+	// paused for NWSBreakerCooldownSeconds
+	NWSBreakerThreshold       int `json:"nwsBreakerThreshold"`
+	NWSBreakerCooldownSeconds int `json:"nwsBreakerCooldownSeconds"`
+	// Concurrency is how many users are sent to at once, 8 if 0
+	Concurrency int `json:"concurrency"`
+	// RunTimeoutSeconds bounds fetching and sending for all users in a run,
+	// 15 minutes if 0, so a hung request can't hold up a cron job forever
+	RunTimeoutSeconds int `json:"runTimeoutSeconds"`
+	// IEMFallback fetches AFDs from the Iowa Environmental Mesonet archive
+	// when the NWS API fails
+	IEMFallback bool `json:"iemFallback"`
+	// OfficeCacheFile caches the list of valid office IDs used to check
+	// users' locationId
+	OfficeCacheFile string `json:"officeCacheFile"`
+	// ZIPCodeFile is a Census ZCTA gazetteer file used to resolve user ZIP
+	// codes to coordinates. Without it the built in table of three digit
+	// prefixes finds their office, but not their zone or county.
+	ZIPCodeFile string `json:"zipCodeFile"`
+	// SegmentCost and MMSCost are the prices in USD used to estimate the cost
+	// of a run
+	SegmentCost float64 `json:"segmentCost"`
+	MMSCost     float64 `json:"mmsCost"`
+	// MetricsAddr is the address to serve Prometheus metrics on at
+	// /metrics, e.g. ":9090", along with the /healthz and /readyz health
+	// checks. It's most useful with --interval.
+	MetricsAddr string `json:"metricsAddr"`
+	// ServeAddr is the address the serve and trigger commands listen on for
+	// everything at once: the health checks, /metrics, /run, Twilio's
+	// callbacks and the admin API. If unset it's all interfaces on $PORT, as
+	// PaaS platforms such as Fly.io, Render and Heroku set it, or ":8080".
+	ServeAddr string `json:"serveAddr"`
+	// AdminToken is the bearer token the admin API under /admin/ requires,
+	// and that its UI under /ui/ asks for. Without it both are off. The UI
+	// signs up users into the users file, which must be JSON.
+	AdminToken string `json:"adminToken"`
+	// TriggerToken is the bearer token POST /run requires to run once, so an
+	// external cron such as Cloud Scheduler or a GitHub Actions schedule can
+	// drive the runs. Without it /run is off.
+	TriggerToken string `json:"triggerToken"`
+	// LogLevel is "debug", "info" (the default), "warn" or "error". At debug
+	// level every NWS request is logged with its duration.
+	LogLevel string `json:"logLevel"`
+	// LogFormat is "text" (the default) or "json"
+	LogFormat string `json:"logFormat"`
+	// OTLPEndpoint is the OTLP/HTTP collector URL to send traces of each run
+	// to, e.g. "http://localhost:4318/v1/traces". Without it, nothing is
+	// traced. Changing it takes a restart.
+	OTLPEndpoint string `json:"otlpEndpoint"`
+	// AdminAlerts tells the admin when a run fails to reach subscribers
+	AdminAlerts AdminAlerts `json:"adminAlerts"`
+	// SentryDSN is the Sentry, or compatible, project to report errors and
+	// panics to. Changing it takes a restart.
+	SentryDSN string `json:"sentryDSN"`
+	// HeartbeatURL is pinged after each run without failures, so a monitor
+	// like healthchecks.io alerts if the runs stop. HeartbeatFailURL, e.g.
+	// the healthchecks.io URL ending in /fail, is pinged instead after a run
+	// with failures.
+	HeartbeatURL     string `json:"heartbeatURL"`
+	HeartbeatFailURL string `json:"heartbeatFailURL"`
+	// Sources are where users can get messages from instead of the AFD, keyed
+	// by the name a user's source setting refers to
+	Sources map[string]Plugin `json:"sources"`
+	// Sinks are channels every user's messages are delivered through after
+	// SMS
+	Sinks []Plugin `json:"sinks"`
+	// LeaderLeaseFile, if set, lets several instances run for high
+	// availability with only one of them sending: the leader, which holds the
+	// lease kept in this file. It must be on storage they all share, e.g. NFS,
+	// as should the sent history and opt-out files. If the leader stops
+	// renewing the lease for LeaderLeaseSeconds (60 if unset), another takes
+	// over.
+	LeaderLeaseFile    string `json:"leaderLeaseFile"`
+	LeaderLeaseSeconds int    `json:"leaderLeaseSeconds"`
+}
+
+// Diff modes for sections that have been sent before
+const (
+	// DiffModeChanged sends only the sentences that are new since the last
+	// time the section was sent
+	DiffModeChanged = "changed"
+	// DiffModeMark sends the whole section with new sentences marked
+	DiffModeMark = "mark"
+)
+
+// SectionAliasesFor returns the section aliases configured for all offices
+// and for the given office
+func (s Config) SectionAliasesFor(locationID string) map[string][]string {
+	aliases := make(map[string][]string)
+	for office, officeAliases := range s.SectionAliases {
+		if office != "*" && !strings.EqualFold(office, locationID) {
+			continue
+		}
+		for name, names := range officeAliases {
+			aliases[name] = append(aliases[name], names...)
+		}
+	}
+	return aliases
+}
+
+// Plugin struct configures a source or sink of a registered type. Exec
+// plugins run Command with Settings in its environment.
+type Plugin struct {
+	// Type is what the source or sink was registered as, e.g. "exec"
+	Type     string            `json:"type"`
+	Command  []string          `json:"command"`
+	Settings map[string]string `json:"settings"`
+	// TimeoutSeconds bounds each call to the plugin, 30 seconds if 0
+	TimeoutSeconds int `json:"timeoutSeconds"`
+}
+
+// Vonage struct holds the Vonage (formerly Nexmo) credentials
+type Vonage struct {
+	APIKey    string `json:"apiKey"`
+	APISecret string `json:"apiSecret"`
+	From      string `json:"from"`
+}
+
+// SNS struct holds the AWS SNS settings. Credentials come from the
+// usual AWS environment variables, shared config or instance role.
+type SNS struct {
+	Region   string `json:"region"`
+	SenderID string `json:"senderId"`
+	// SMSType is "Transactional" (the default) or "Promotional"
+	SMSType string `json:"smsType"`
+}
+
+// MessageBird struct holds the MessageBird credentials
+type MessageBird struct {
+	AccessKey  string `json:"accessKey"`
+	Originator string `json:"originator"`
+}
+
+// Summarizer struct configures condensing long sections for SMS
+type Summarizer struct {
+	// MaxLength is the longest a summarized section's text may be. Zero turns
+	// summarizing off.
+	MaxLength int `json:"maxLength"`
+	// Sections are the sections to summarize, "LONG TERM" if unset
+	Sections []string `json:"sections"`
+	// Backend is "extractive" (the default) or "llm"
+	Backend string `json:"backend"`
+	// LLMURL is an OpenAI-compatible chat completions endpoint, e.g.
+	// "https://api.openai.com/v1/chat/completions"
+	LLMURL    string `json:"llmURL"`
+	LLMAPIKey string `json:"llmAPIKey"`
+	LLMModel  string `json:"llmModel"`
+}
+
+// Translator struct configures translating messages into each user's
+// language
+type Translator struct {
+	// Backend is "libretranslate" or "deepl". Translation is off if unset.
+	Backend string `json:"backend"`
+	// URL overrides the backend's endpoint, e.g. for a self-hosted
+	// LibreTranslate
+	URL    string `json:"url"`
+	APIKey string `json:"apiKey"`
+}
+
+// AdminAlerts struct says who to tell when a run fails to reach
+// subscribers, by SMS, email or both
+type AdminAlerts struct {
+	Phone string `json:"phone"`
+	Email string `json:"email"`
+	// FailureThreshold is how many failed fetches and sends in a run trigger
+	// an alert, DefaultAdminFailureThreshold if unset
+	FailureThreshold int `json:"failureThreshold"`
+	// CooldownMinutes is the least time between alerts,
+	// DefaultAdminAlertCooldown if unset
+	CooldownMinutes int `json:"cooldownMinutes"`
+	// SMTPAddr is the mail server's host:port for email alerts, e.g.
+	// "smtp.gmail.com:587"
+	SMTPAddr     string `json:"smtpAddr"`
+	SMTPUsername string `json:"smtpUsername"`
+	SMTPPassword string `json:"smtpPassword"`
+	// SMTPFrom is the sender address, SMTPUsername if unset
+	SMTPFrom string `json:"smtpFrom"`
+}
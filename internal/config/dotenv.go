@@ -0,0 +1,77 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultDotEnvFile is read at startup, if it exists, for environment
+// variables to set
+const DefaultDotEnvFile = ".env"
+
+// LoadDotEnv sets the environment variables in the file at path, one
+// KEY=value per line, e.g. TWILIO_AUTH_TOKEN=... Variables already set in the
+// environment take precedence. Blank lines, # comments and a leading "export"
+// are ignored, and values can be quoted. A missing file isn't an error.
+func LoadDotEnv(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return fmt.Errorf("%s:%d: expected KEY=value", path, lineNumber)
+		}
+		key := strings.TrimSpace(kv[0])
+		value, err := dotEnvValue(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", path, lineNumber, err)
+		}
+		if _, ok := os.LookupEnv(key); ok {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// dotEnvValue unquotes a value. Double quoted values can have escapes like
+// \n, single quoted values are taken as they are, and unquoted values end at
+// a " #" comment.
+func dotEnvValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		end := strings.LastIndex(value, `"`)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated quote")
+		}
+		return strconv.Unquote(value[:end+1])
+	case strings.HasPrefix(value, "'"):
+		end := strings.LastIndex(value, "'")
+		if end == 0 {
+			return "", fmt.Errorf("unterminated quote")
+		}
+		return value[1:end], nil
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value, nil
+}
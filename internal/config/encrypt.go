@@ -0,0 +1,105 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeyEnv is the environment variable holding the key that decrypts
+// encrypted config values, as printed by the genkey command
+const KeyEnv = "ALERTS_CONFIG_KEY"
+
+// Encrypted config values look like ENC[aes256gcm,...], in the style of sops,
+// with the base64 of the nonce and sealed value between the brackets
+const (
+	encryptedPrefix = "ENC[aes256gcm,"
+	encryptedSuffix = "]"
+)
+
+// GenerateKey returns a new random key for encrypting config values,
+// base64 encoded
+func GenerateKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// EncryptValue encrypts value with the base64 key, for pasting into a
+// config file in place of value
+func EncryptValue(value string, key string) (string, error) {
+	aead, err := newConfigCipher(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed) + encryptedSuffix, nil
+}
+
+// DecryptValue returns the value encrypted by EncryptValue
+func DecryptValue(encrypted string, key string) (string, error) {
+	aead, err := newConfigCipher(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(strings.TrimPrefix(encrypted, encryptedPrefix), encryptedSuffix))
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("Encrypted value is too short")
+	}
+	value, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("Couldn't decrypt, the value or " + KeyEnv + " is wrong")
+	}
+	return string(value), nil
+}
+
+// IsEncryptedValue reports whether value was encrypted by
+// EncryptValue
+func IsEncryptedValue(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix) && strings.HasSuffix(value, encryptedSuffix)
+}
+
+// Decrypt decrypts every encrypted value in config with the key in
+// KeyEnv. Without encrypted values, the key isn't needed.
+func Decrypt(config *Config) error {
+	key := os.Getenv(KeyEnv)
+	return rewriteConfigStrings(config, func(name string, value string) (string, error) {
+		if !IsEncryptedValue(value) {
+			return value, nil
+		}
+		if key == "" {
+			return "", fmt.Errorf("%s is encrypted but %s isn't set", name, KeyEnv)
+		}
+		decrypted, err := DecryptValue(value, key)
+		if err != nil {
+			return "", fmt.Errorf("Invalid %s: %v", name, err)
+		}
+		return decrypted, nil
+	})
+}
+
+func newConfigCipher(key string) (cipher.AEAD, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil || len(raw) != 32 {
+		return nil, errors.New(KeyEnv + " must be a base64 256-bit key, see the genkey command")
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
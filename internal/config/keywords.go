@@ -0,0 +1,112 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/nws"
+)
+
+// thresholdRe matches keywords that compare a quantity mentioned in the
+// discussion with a value, e.g. "snow >= 6" or "gust > 58"
+var thresholdRe = regexp.MustCompile(`^\s*([A-Za-z]+)\s*(>=|<=|>|<|=|≥|≤)\s*(\d+(?:\.\d+)?)\s*$`)
+
+// KeywordRule struct is a word, phrase, regular expression or threshold that
+// triggers a message whenever the discussion mentions it
+type KeywordRule struct {
+	Keyword string
+	re      *regexp.Regexp
+
+	// For thresholds, the kind of quantity, comparison and value
+	kind  string
+	op    string
+	value float64
+}
+
+// Matches reports whether a sentence of the discussion triggers the rule
+func (s KeywordRule) Matches(sentence string) bool {
+	if s.re != nil {
+		return s.re.MatchString(sentence)
+	}
+	for _, q := range nws.ExtractQuantities(sentence) {
+		if q.Kind != s.kind {
+			continue
+		}
+		switch s.op {
+		case ">=", "≥":
+			if q.Max >= s.value {
+				return true
+			}
+		case ">":
+			if q.Max > s.value {
+				return true
+			}
+		case "<=", "≤":
+			if q.Min <= s.value {
+				return true
+			}
+		case "<":
+			if q.Min < s.value {
+				return true
+			}
+		case "=":
+			if q.Min <= s.value && s.value <= q.Max {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CompileKeyword compiles a user's keyword. Keywords written between slashes,
+// e.g. "/ice (storm|accretion)/", are regular expressions, and keywords like
+// "snow >= 6" compare the quantities the discussion mentions, in inches, mph
+// or percent. Anything else matches as a whole word or phrase. All ignore
+// case.
+func CompileKeyword(keyword string) (KeywordRule, error) {
+	if m := thresholdRe.FindStringSubmatch(keyword); m != nil {
+		kind := strings.ToLower(m[1])
+		if !slices.Contains(quantityKinds, kind) {
+			return KeywordRule{}, fmt.Errorf("Unknown quantity %s, expected one of %s", m[1], strings.Join(quantityKinds, ", "))
+		}
+		value, err := strconv.ParseFloat(m[3], 64)
+		if err != nil {
+			return KeywordRule{}, err
+		}
+		return KeywordRule{Keyword: keyword, kind: kind, op: m[2], value: value}, nil
+	}
+
+	pattern := `\b` + strings.Join(strings.Fields(regexp.QuoteMeta(keyword)), `\s+`) + `\b`
+	if len(keyword) > 2 && strings.HasPrefix(keyword, "/") && strings.HasSuffix(keyword, "/") {
+		pattern = keyword[1 : len(keyword)-1]
+	}
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return KeywordRule{}, err
+	}
+	return KeywordRule{Keyword: keyword, re: re}, nil
+}
+
+var quantityKinds = []string{nws.QuantitySnow, nws.QuantityRain, nws.QuantityIce, nws.QuantityWind, nws.QuantityGust, nws.QuantityPoP}
+
+// CompileKeywords compiles every user's keywords. Invalid keywords are
+// dropped and an error naming each one is returned.
+func (s *Users) CompileKeywords() []error {
+	var errs []error
+	for i := range s.Users {
+		user := &s.Users[i]
+		user.KeywordRules = nil
+		for _, keyword := range user.Keywords {
+			rule, err := CompileKeyword(keyword)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("User %d (%s %s): keyword %s: %v", user.ID, user.FirstName, user.LastName, keyword, err))
+				continue
+			}
+			user.KeywordRules = append(user.KeywordRules, rule)
+		}
+	}
+	return errs
+}
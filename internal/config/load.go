@@ -0,0 +1,521 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is the config file read when no other is given. If it
+// doesn't exist, the same name with any of FileExtensions is used.
+const DefaultFile = "config.json"
+
+// DefaultProfile is the profile used when neither the --profile flag nor
+// ProfileEnv selects one
+const DefaultProfile = "dev"
+
+// ProfileEnv is the environment variable that selects the profile
+const ProfileEnv = "ALERTS_PROFILE"
+
+// DefaultUsersFile is the user list read at startup. Like the config, it can
+// also be YAML or TOML.
+const DefaultUsersFile = "users.json"
+
+// FileExtensions are the config file formats LoadFile understands
+var FileExtensions = []string{".json", ".yaml", ".yml", ".toml"}
+
+// DirName is the name of the directories searched for config files
+const DirName = "forecast-discussion-alerts"
+
+// Dirs returns the directories searched, in order, for config files
+// that aren't in the working directory: ~/.config/forecast-discussion-alerts
+// or the same under $XDG_CONFIG_HOME, the same under each of
+// $XDG_CONFIG_DIRS, then /etc/forecast-discussion-alerts
+func Dirs() []string {
+	var dirs []string
+	if dir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(dir, DirName))
+	}
+	for _, dir := range filepath.SplitList(os.Getenv("XDG_CONFIG_DIRS")) {
+		if dir != "" {
+			dirs = append(dirs, filepath.Join(dir, DirName))
+		}
+	}
+	return append(dirs, filepath.Join("/etc", DirName))
+}
+
+// FindFile returns path if it exists, or else the first existing file
+// with the same name and another config extension, e.g. config.yaml for
+// config.json. A relative path that isn't found in the working directory is
+// looked for in each of Dirs. It returns path if there's none.
+func FindFile(path string) string {
+	if found, ok := findWithExtension(path); ok || filepath.IsAbs(path) {
+		return found
+	}
+	for _, dir := range Dirs() {
+		if found, ok := findWithExtension(filepath.Join(dir, path)); ok {
+			return found
+		}
+	}
+	return path
+}
+
+// findWithExtension returns path, or path with another config extension, if
+// the file exists
+func findWithExtension(path string) (string, bool) {
+	if fileExists(path) {
+		return path, true
+	}
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, ext := range FileExtensions {
+		if fileExists(base + ext) {
+			return base + ext, true
+		}
+	}
+	return path, false
+}
+
+// ProfileFile returns the file with the overrides for a profile, e.g.
+// config.prod.json for config.json and the "prod" profile. Files named like
+// config_dev.json, from before there were profiles, are still found. It
+// returns "" if there's none.
+func ProfileFile(path string, profile string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for _, name := range []string{base + "." + profile + ext, base + "_" + profile + ext} {
+		if name = FindFile(name); fileExists(name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// Load reads the config file at path, if there is one, then the
+// overrides for the profile on top of it, then any settings given in
+// environment variables and finally those in overrides, from Flags. It
+// then decrypts any encrypted values. Settings missing from the profile's
+// file keep their value from path. If profile is "", it's taken from
+// ProfileEnv, or else is DefaultProfile, and needn't have a file.
+func Load(path string, profile string, overrides map[string]string) (Config, error) {
+	var config Config
+	path = FindFile(path)
+	if err := LoadFile(path, &config); err != nil && !os.IsNotExist(err) {
+		return config, err
+	}
+
+	required := profile != ""
+	if profile == "" {
+		profile = os.Getenv(ProfileEnv)
+		required = profile != ""
+	}
+	if profile == "" {
+		profile = DefaultProfile
+	}
+	if profilePath := ProfileFile(path, profile); profilePath != "" {
+		if err := LoadFile(profilePath, &config); err != nil {
+			return config, err
+		}
+	} else if required {
+		return config, fmt.Errorf("No config file for profile %s next to %s", profile, path)
+	}
+
+	if err := ApplyEnv(&config, os.LookupEnv); err != nil {
+		return config, err
+	}
+	err := ApplyEnv(&config, func(name string) (string, bool) {
+		value, ok := overrides[name]
+		return value, ok
+	})
+	if err != nil {
+		return config, err
+	}
+	if err := Decrypt(&config); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// LoadFile decodes the JSON, YAML or TOML file at path into v, choosing the
+// format by the file's extension. Every format uses the JSON field names, so
+// v needs only json tags. Unknown fields are an error, so a misspelled
+// setting isn't silently ignored.
+func LoadFile(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+	case ".yaml", ".yml":
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		doc, err := yamlToJSON(&node, reflect.TypeOf(v))
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	case ".toml":
+		var doc map[string]interface{}
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	default:
+		return fmt.Errorf("%s: Unknown config format, expected one of %s", path, strings.Join(FileExtensions, ", "))
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// yamlToJSON converts a YAML node to a value that marshals to the JSON for
+// decoding into t. Scalars bound for string fields keep their text as
+// written, so "phone: +15035550100" and "zipCode: 02134" aren't read as
+// numbers. Where t doesn't say, e.g. for an unknown field, YAML's own types
+// are used.
+func yamlToJSON(node *yaml.Node, t reflect.Type) (interface{}, error) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch node.Kind {
+	case 0:
+		// An empty file
+		return nil, nil
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return yamlToJSON(node.Content[0], t)
+	case yaml.AliasNode:
+		return yamlToJSON(node.Alias, t)
+	case yaml.SequenceNode:
+		var elem reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elem = t.Elem()
+		}
+		list := make([]interface{}, 0, len(node.Content))
+		for _, item := range node.Content {
+			value, err := yamlToJSON(item, elem)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	case yaml.MappingNode:
+		object := make(map[string]interface{})
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, item := node.Content[i], node.Content[i+1]
+			// Merge the mapping of a "<<: *anchor" key
+			if key.Tag == "!!merge" {
+				merged, err := yamlToJSON(item, t)
+				if err != nil {
+					return nil, err
+				}
+				if merged, ok := merged.(map[string]interface{}); ok {
+					for name, value := range merged {
+						if _, ok := object[name]; !ok {
+							object[name] = value
+						}
+					}
+				}
+				continue
+			}
+			value, err := yamlToJSON(item, fieldType(t, key.Value))
+			if err != nil {
+				return nil, err
+			}
+			object[key.Value] = value
+		}
+		return object, nil
+	}
+
+	if node.Tag == "!!null" {
+		return nil, nil
+	}
+	if t != nil && t.Kind() == reflect.String {
+		return node.Value, nil
+	}
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// fieldType returns the type of the value for key in a struct or map of type
+// t, matching struct fields by JSON name as encoding/json does, or nil if
+// it isn't known
+func fieldType(t reflect.Type, key string) reflect.Type {
+	if t == nil {
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Map:
+		return t.Elem()
+	case reflect.Struct:
+		var folded reflect.Type
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if field.PkgPath != "" || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			if name == key {
+				return field.Type
+			}
+			if folded == nil && strings.EqualFold(name, key) {
+				folded = field.Type
+			}
+		}
+		return folded
+	}
+	return nil
+}
+
+// ApplyEnv sets each config field that has an environment variable, looked
+// up with lookup. The variable for a field is its JSON name in upper snake
+// case, prefixed with the names of the structs it's nested in, e.g.
+// TWILIO_ACCOUNT_SID, NWS_BASE_URI or VONAGE_API_KEY. Lists are comma
+// separated, maps are comma separated key=value pairs, and anything else can
+// be given as JSON.
+func ApplyEnv(config *Config, lookup func(string) (string, bool)) error {
+	return applyEnv(reflect.ValueOf(config).Elem(), "", lookup)
+}
+
+func applyEnv(v reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.PkgPath != "" || tag == "" || tag == "-" {
+			continue
+		}
+		name := prefix + envName(tag)
+		value := v.Field(i)
+
+		if value.Kind() == reflect.Struct {
+			if err := applyEnv(value, name+"_", lookup); err != nil {
+				return err
+			}
+			continue
+		}
+		env, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := setFromEnv(value, env); err != nil {
+			return fmt.Errorf("Invalid %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// configFlag struct is the command-line flag for a config setting
+type configFlag struct {
+	env       string
+	kind      reflect.Type
+	overrides map[string]string
+}
+
+func (s *configFlag) String() string {
+	if s == nil || s.overrides == nil {
+		return ""
+	}
+	return s.overrides[s.env]
+}
+
+// Set checks that value parses as the setting's type
+func (s *configFlag) Set(value string) error {
+	if err := setFromEnv(reflect.New(s.kind).Elem(), value); err != nil {
+		return err
+	}
+	s.overrides[s.env] = value
+	return nil
+}
+
+// IsBoolFlag lets boolean settings be given as just --name
+func (s *configFlag) IsBoolFlag() bool {
+	return s.kind.Kind() == reflect.Bool
+}
+
+// Flags defines a flag on fs for every config setting, named like its
+// environment variable in lower case with hyphens, e.g. --twilio-from-phone
+// or --nws-requests-per-second. Values are given as for environment
+// variables. It returns the values given after fs is parsed, by environment
+// variable name, for Load.
+func Flags(fs *flag.FlagSet) map[string]string {
+	overrides := make(map[string]string)
+	defineConfigFlags(fs, reflect.TypeOf(Config{}), "", overrides)
+	return overrides
+}
+
+// IsFlag reports whether the flag was defined by Flags
+func IsFlag(f *flag.Flag) bool {
+	_, ok := f.Value.(*configFlag)
+	return ok
+}
+
+func defineConfigFlags(fs *flag.FlagSet, t reflect.Type, prefix string, overrides map[string]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.PkgPath != "" || tag == "" || tag == "-" {
+			continue
+		}
+		name := prefix + envName(tag)
+		if field.Type.Kind() == reflect.Struct {
+			defineConfigFlags(fs, field.Type, name+"_", overrides)
+			continue
+		}
+		flagName := strings.ToLower(strings.Replace(name, "_", "-", -1))
+		fs.Var(&configFlag{env: name, kind: field.Type, overrides: overrides}, flagName, "sets "+name)
+	}
+}
+
+// rewriteConfigStrings replaces each string field of config, including those
+// of nested structs, with what rewrite returns for it. rewrite is given the
+// field's JSON path, e.g. "vonage.apiKey", and value.
+func rewriteConfigStrings(config *Config, rewrite func(name string, value string) (string, error)) error {
+	return rewriteStrings(reflect.ValueOf(config).Elem(), "", rewrite)
+}
+
+func rewriteStrings(v reflect.Value, prefix string, rewrite func(name string, value string) (string, error)) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := prefix + strings.Split(field.Tag.Get("json"), ",")[0]
+		value := v.Field(i)
+
+		switch value.Kind() {
+		case reflect.Struct:
+			if err := rewriteStrings(value, name+".", rewrite); err != nil {
+				return err
+			}
+		case reflect.String:
+			rewritten, err := rewrite(name, value.String())
+			if err != nil {
+				return err
+			}
+			value.SetString(rewritten)
+		}
+	}
+	return nil
+}
+
+// envName turns a JSON field name into an environment variable name, e.g.
+// "twillioAccountSID" into "TWILIO_ACCOUNT_SID"
+func envName(tag string) string {
+	var b strings.Builder
+	runes := []rune(tag)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			// Break before a capital that starts a word: "accountSID" and
+			// "SIDValue" but not inside "SID" or "IDs"
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if nextLower && runes[i+1] == 's' && (i+2 == len(runes) || unicode.IsUpper(runes[i+2])) {
+				nextLower = false
+			}
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	// The config fields keep an old misspelling
+	return strings.Replace(b.String(), "TWILLIO", "TWILIO", 1)
+}
+
+func setFromEnv(value reflect.Value, env string) error {
+	trimmed := strings.TrimSpace(env)
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(env)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(trimmed)
+		if err != nil {
+			return err
+		}
+		value.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(trimmed, 10, 64)
+		if err != nil {
+			return err
+		}
+		value.SetInt(n)
+		return nil
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(trimmed, 64)
+		if err != nil {
+			return err
+		}
+		value.SetFloat(f)
+		return nil
+	}
+
+	if strings.HasPrefix(trimmed, "[") || strings.HasPrefix(trimmed, "{") {
+		return json.Unmarshal([]byte(trimmed), value.Addr().Interface())
+	}
+	switch {
+	case value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(trimmed, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		value.Set(reflect.ValueOf(items))
+		return nil
+	case value.Kind() == reflect.Map && value.Type().Key().Kind() == reflect.String && value.Type().Elem().Kind() == reflect.String:
+		pairs := make(map[string]string)
+		for _, pair := range strings.Split(trimmed, ",") {
+			if pair = strings.TrimSpace(pair); pair == "" {
+				continue
+			}
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("expected key=value, got %s", pair)
+			}
+			pairs[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+		value.Set(reflect.ValueOf(pairs))
+		return nil
+	}
+	return fmt.Errorf("expected JSON")
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFile writes text to name in a temporary directory and returns its path
+func writeFile(t *testing.T, name string, text string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFileYAMLKeepsStringText(t *testing.T) {
+	path := writeFile(t, "users.yaml", `
+users:
+  - id: 1
+    firstName: Pat
+    phone: +15035550100
+    zipCode: 02134
+    latitude: 45.5
+    subscriptions: [SHORT TERM, 2024]
+`)
+	var users Users
+	if err := LoadFile(path, &users); err != nil {
+		t.Fatal(err)
+	}
+	if len(users.Users) != 1 {
+		t.Fatalf("Loaded %d users, want 1", len(users.Users))
+	}
+	user := users.Users[0]
+	if user.ID != 1 || user.Phone != "+15035550100" || user.ZIPCode != "02134" {
+		t.Errorf("Loaded id %d, phone %q and ZIP code %q, want 1, +15035550100 and 02134", user.ID, user.Phone, user.ZIPCode)
+	}
+	if user.Latitude == nil || *user.Latitude != 45.5 {
+		t.Errorf("Loaded latitude %v, want 45.5", user.Latitude)
+	}
+	if strings.Join(user.Subscriptions, ",") != "SHORT TERM,2024" {
+		t.Errorf("Loaded subscriptions %q", user.Subscriptions)
+	}
+}
+
+func TestLoadFileYAMLConfig(t *testing.T) {
+	path := writeFile(t, "config.yml", `
+twillioFromPhone: +15035550100
+twillioMessagingServiceSID: ~
+concurrency: 4
+`)
+	var config Config
+	if err := LoadFile(path, &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.TwillioFromPhone != "+15035550100" || config.Concurrency != 4 {
+		t.Errorf("Loaded from phone %q and concurrency %d", config.TwillioFromPhone, config.Concurrency)
+	}
+}
+
+func TestLoadFileYAMLUnknownField(t *testing.T) {
+	path := writeFile(t, "config.yaml", "twilioFromPhone: +15035550100\n")
+	var config Config
+	if err := LoadFile(path, &config); err == nil || !strings.Contains(err.Error(), "unknown field") {
+		t.Errorf("LoadFile returned %v, want an unknown field error", err)
+	}
+}
+
+func TestLoadFileEmptyYAML(t *testing.T) {
+	var config Config
+	if err := LoadFile(writeFile(t, "config.yaml", ""), &config); err != nil {
+		t.Errorf("LoadFile of an empty file returned %v", err)
+	}
+}
+
+func TestLoadFileYAMLMergeKey(t *testing.T) {
+	path := writeFile(t, "users.yaml", `
+users:
+  - &pat
+    id: 1
+    phone: +15035550100
+    zipCode: 02134
+  - <<: *pat
+    id: 2
+`)
+	var users Users
+	if err := LoadFile(path, &users); err != nil {
+		t.Fatal(err)
+	}
+	if len(users.Users) != 2 || users.Users[1].ID != 2 || users.Users[1].ZIPCode != "02134" {
+		t.Errorf("Loaded %+v, want the second user merged from the first", users.Users)
+	}
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/nyaruka/phonenumbers"
+)
+
+// DefaultPhoneRegion is the region numbers without a country code are
+// assumed to be in
+const DefaultPhoneRegion = "US"
+
+// NormalizePhone parses a phone number as written by a person and returns it
+// in E.164 format, e.g. "(503) 555-0100" becomes "+15035550100"
+func NormalizePhone(phone string, defaultRegion string) (string, error) {
+	number, err := phonenumbers.Parse(phone, defaultRegion)
+	if err != nil {
+		return "", err
+	}
+	if !phonenumbers.IsValidNumber(number) {
+		return "", fmt.Errorf("%s is not a valid phone number", phone)
+	}
+	return phonenumbers.Format(number, phonenumbers.E164), nil
+}
+
+// NormalizePhones rewrites every user's phone number in E.164 format. Users
+// with an invalid number are removed so nothing is sent to them, and an error
+// naming each one is returned.
+func (s *Users) NormalizePhones(defaultRegion string) []error {
+	var errs []error
+	valid := s.Users[:0]
+	for _, user := range s.Users {
+		phone, err := NormalizePhone(user.Phone, defaultRegion)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("User %d (%s %s): %v", user.ID, user.FirstName, user.LastName, err))
+			continue
+		}
+		user.Phone = phone
+		valid = append(valid, user)
+	}
+	s.Users = valid
+	return errs
+}
@@ -0,0 +1,251 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/httpjson"
+)
+
+// Prefixes of config values that refer to a secret instead of holding it.
+// What follows is the secret's ID, then optionally "#" and a key to take from
+// a secret holding a JSON object, e.g.
+//
+//	"twillioAuthToken": "aws-secretsmanager://prod/alerts#twilioAuthToken"
+//	"twillioAuthToken": "gcp-secretmanager://projects/alerts/secrets/twilio-token"
+//	"twillioAuthToken": "vault://secret/data/alerts#twilioAuthToken"
+const (
+	AWSSecretPrefix   = "aws-secretsmanager://"
+	GCPSecretPrefix   = "gcp-secretmanager://"
+	VaultSecretPrefix = "vault://"
+)
+
+// SecretsTimeout limits how long fetching the config's secrets can take
+const SecretsTimeout = 30 * time.Second
+
+// DefaultVaultAddr is used when VAULT_ADDR isn't set, as by the Vault CLI
+const DefaultVaultAddr = "https://127.0.0.1:8200"
+
+// gcpTokenURL is the metadata server endpoint for the access token of the
+// instance's service account
+const gcpTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// SecretStore is implemented by each secrets manager config values can refer
+// to
+type SecretStore interface {
+	// GetSecret returns the value of the secret with the given ID
+	GetSecret(ctx context.Context, id string) (string, error)
+}
+
+// ResolveSecrets replaces every config value that refers to a secret with the
+// secret. Each secret is fetched once however many values refer to it.
+func ResolveSecrets(ctx context.Context, config *Config, httpClient *http.Client) error {
+	resolver := &secretResolver{
+		httpClient: httpClient,
+		stores:     make(map[string]SecretStore),
+		secrets:    make(map[string]string),
+	}
+	return rewriteConfigStrings(config, func(name string, value string) (string, error) {
+		secret, ok, err := resolver.lookup(ctx, value)
+		if err != nil {
+			return "", fmt.Errorf("Couldn't get %s: %v", name, err)
+		}
+		if !ok {
+			return value, nil
+		}
+		return secret, nil
+	})
+}
+
+// secretResolver struct holds the stores and secrets used so far
+type secretResolver struct {
+	httpClient *http.Client
+	stores     map[string]SecretStore
+	secrets    map[string]string
+}
+
+// lookup returns the secret ref refers to, or false if it isn't a reference
+func (s *secretResolver) lookup(ctx context.Context, ref string) (string, bool, error) {
+	var scheme string
+	for _, prefix := range []string{AWSSecretPrefix, GCPSecretPrefix, VaultSecretPrefix} {
+		if strings.HasPrefix(ref, prefix) {
+			scheme = prefix
+		}
+	}
+	if scheme == "" {
+		return "", false, nil
+	}
+	id, key := strings.TrimPrefix(ref, scheme), ""
+	if i := strings.LastIndex(id, "#"); i >= 0 {
+		id, key = id[:i], id[i+1:]
+	}
+
+	secret, ok := s.secrets[scheme+id]
+	if !ok {
+		store, err := s.store(scheme)
+		if err != nil {
+			return "", false, err
+		}
+		if secret, err = store.GetSecret(ctx, id); err != nil {
+			return "", false, err
+		}
+		s.secrets[scheme+id] = secret
+	}
+	if key == "" {
+		return secret, true, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", false, fmt.Errorf("Secret %s isn't a JSON object, so has no key %s", id, key)
+	}
+	value, ok := fields[key]
+	if !ok {
+		return "", false, fmt.Errorf("Secret %s has no key %s", id, key)
+	}
+	if str, ok := value.(string); ok {
+		return str, true, nil
+	}
+	return fmt.Sprint(value), true, nil
+}
+
+func (s *secretResolver) store(scheme string) (SecretStore, error) {
+	if store, ok := s.stores[scheme]; ok {
+		return store, nil
+	}
+	var store SecretStore
+	switch scheme {
+	case AWSSecretPrefix:
+		cfg, err := awsconfig.LoadDefaultConfig(context.Background(), awsconfig.WithHTTPClient(s.httpClient))
+		if err != nil {
+			return nil, err
+		}
+		store = &AWSSecretStore{Client: secretsmanager.NewFromConfig(cfg)}
+	case GCPSecretPrefix:
+		store = &GCPSecretStore{AccessToken: os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"), HTTPClient: s.httpClient}
+	case VaultSecretPrefix:
+		addr := os.Getenv("VAULT_ADDR")
+		if addr == "" {
+			addr = DefaultVaultAddr
+		}
+		store = &VaultSecretStore{Addr: addr, Token: os.Getenv("VAULT_TOKEN"), HTTPClient: s.httpClient}
+	}
+	s.stores[scheme] = store
+	return store, nil
+}
+
+// AWSSecretStore struct reads secrets from AWS Secrets Manager. Credentials
+// and region come from the usual AWS environment variables, shared config or
+// instance role.
+type AWSSecretStore struct {
+	Client *secretsmanager.Client
+}
+
+// GetSecret returns the current version of the secret with the given name or
+// ARN
+func (s *AWSSecretStore) GetSecret(ctx context.Context, id string) (string, error) {
+	out, err := s.Client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(id)})
+	if err != nil {
+		return "", err
+	}
+	if out.SecretString != nil {
+		return *out.SecretString, nil
+	}
+	return string(out.SecretBinary), nil
+}
+
+// GCPSecretStore struct reads secrets from GCP Secret Manager. AccessToken is
+// used if set, otherwise a token for the instance's service account is taken
+// from the metadata server.
+type GCPSecretStore struct {
+	AccessToken string
+	HTTPClient  *http.Client
+}
+
+// GetSecret returns the secret with the given resource name, e.g.
+// "projects/PROJECT/secrets/NAME". The latest version is used unless the name
+// includes one.
+func (s *GCPSecretStore) GetSecret(ctx context.Context, id string) (string, error) {
+	if !strings.Contains(id, "/versions/") {
+		id += "/versions/latest"
+	}
+	if s.AccessToken == "" {
+		req, err := http.NewRequest("GET", gcpTokenURL, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Metadata-Flavor", "Google")
+		var token struct {
+			AccessToken string `json:"access_token"`
+		}
+		if err := httpjson.Do(ctx, s.HTTPClient, req, &token); err != nil {
+			return "", fmt.Errorf("Couldn't get a GCP access token: %v", err)
+		}
+		s.AccessToken = token.AccessToken
+	}
+
+	req, err := http.NewRequest("GET", "https://secretmanager.googleapis.com/v1/"+id+":access", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.AccessToken)
+	var resp struct {
+		Payload struct {
+			// Data is base64, which encoding/json decodes into []byte
+			Data []byte `json:"data"`
+		} `json:"payload"`
+	}
+	if err := httpjson.Do(ctx, s.HTTPClient, req, &resp); err != nil {
+		return "", err
+	}
+	return string(resp.Payload.Data), nil
+}
+
+// VaultSecretStore struct reads secrets from a HashiCorp Vault KV secrets
+// engine, version 1 or 2
+type VaultSecretStore struct {
+	Addr       string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// GetSecret returns the secret at the given path, e.g. "secret/data/alerts"
+// for KV version 2. A secret's fields are returned as a JSON object, so a
+// reference picks one with "#".
+func (s *VaultSecretStore) GetSecret(ctx context.Context, id string) (string, error) {
+	if s.Token == "" {
+		return "", errors.New("VAULT_TOKEN isn't set")
+	}
+	req, err := http.NewRequest("GET", strings.TrimSuffix(s.Addr, "/")+"/v1/"+strings.TrimPrefix(id, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", s.Token)
+	var resp struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := httpjson.Do(ctx, s.HTTPClient, req, &resp); err != nil {
+		return "", err
+	}
+
+	// KV version 2 nests the fields in data.data beside data.metadata
+	data, nested := resp.Data["data"]
+	if _, ok := resp.Data["metadata"]; ok && nested {
+		return string(data), nil
+	}
+	fields, err := json.Marshal(resp.Data)
+	if err != nil {
+		return "", err
+	}
+	return string(fields), nil
+}
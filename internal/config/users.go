@@ -0,0 +1,222 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/nws"
+)
+
+// Users struct contains all users
+type Users struct {
+	Users []User `json:"users"`
+}
+
+// User struct represents a user
+type User struct {
+	ID            int      `json:"id"`
+	FirstName     string   `json:"firstName"`
+	LastName      string   `json:"lastName"`
+	LocationID    string   `json:"locationId"`
+	Phone         string   `json:"phone"`
+	Subscriptions []string `json:"subscriptions"`
+	// Latitude and Longitude, or a US ZIPCode, can be given instead of
+	// LocationID, which is then looked up at startup along with the
+	// ForecastZone and County codes. The built in ZIP code table only finds
+	// the office; configure zipCodeFile for the zone and county too.
+	Latitude     *float64 `json:"latitude"`
+	Longitude    *float64 `json:"longitude"`
+	ZIPCode      string   `json:"zipCode"`
+	ForecastZone string   `json:"forecastZone"`
+	County       string   `json:"county"`
+	// State limits the "headlines" subscription to the watches, warnings and
+	// advisories for one state, e.g. "OR". It defaults to the state of
+	// ForecastZone.
+	State string `json:"state"`
+	// Media optionally attaches a graphic to the first message of each run:
+	// "graphicast", "spc" or "radar"
+	Media        string `json:"media"`
+	RadarStation string `json:"radarStation"`
+	// Messages that would arrive between QuietHoursStart and QuietHoursEnd
+	// ("22:00" and "07:00") in TimeZone are scheduled for the end of the
+	// quiet hours, if the SMS provider supports scheduling
+	QuietHoursStart string `json:"quietHoursStart"`
+	QuietHoursEnd   string `json:"quietHoursEnd"`
+	TimeZone        string `json:"timeZone"`
+	// Keywords send the sentences of the discussion that mention them,
+	// whatever the subscriptions, e.g. "tornado", "/ice (storm|jam)/" or
+	// "snow >= 6"
+	Keywords []string `json:"keywords"`
+	// MinSeverity only sends discussions rated at least this urgent: "low",
+	// "moderate", "high" or "extreme". Everything is sent if unset.
+	MinSeverity string `json:"minSeverity"`
+	// Language is the ISO 639-1 code of the language to send messages in,
+	// e.g. "es", if a translator is configured. English is the default.
+	Language string `json:"language"`
+	// Source names one of the config's sources to get messages from instead
+	// of the AFD
+	Source string `json:"source"`
+
+	// KeywordRules are the compiled Keywords, set by CompileKeywords
+	KeywordRules []KeywordRule `json:"-"`
+}
+
+// ResolveLocations looks up the LocationID, ForecastZone and County of users
+// who gave coordinates or a ZIP code instead. zips may be nil if no ZIP table
+// is configured. Users whose location can't be determined are removed, and
+// an error naming each one is returned.
+func (s *Users) ResolveLocations(ctx context.Context, client nws.API, zips ZipTable) []error {
+	var errs []error
+	resolved := s.Users[:0]
+	for _, user := range s.Users {
+		if user.LocationID == "" {
+			if err := user.resolveLocation(ctx, client, zips); err != nil {
+				errs = append(errs, fmt.Errorf("User %d (%s %s): %v", user.ID, user.FirstName, user.LastName, err))
+				continue
+			}
+		}
+		resolved = append(resolved, user)
+	}
+	s.Users = resolved
+	return errs
+}
+
+func (s *User) resolveLocation(ctx context.Context, client nws.API, zips ZipTable) error {
+	var lat, lon float64
+	// A ZIP code found only by its first three digits is too rough for the
+	// zone and county, which would pick the wrong segments of a discussion
+	officeOnly := false
+	switch {
+	case s.Latitude != nil && s.Longitude != nil:
+		lat, lon = *s.Latitude, *s.Longitude
+	case s.ZIPCode != "":
+		var ok bool
+		lat, lon, ok = zips.Lookup(s.ZIPCode)
+		if !ok {
+			lat, lon, ok = zips.LookupPrefix(s.ZIPCode)
+			officeOnly = true
+		}
+		if !ok {
+			return fmt.Errorf("Unknown ZIP code %s", s.ZIPCode)
+		}
+	default:
+		return errors.New("No locationId, coordinates or ZIP code")
+	}
+
+	point, err := client.GetPoint(ctx, lat, lon)
+	if err != nil {
+		return err
+	}
+	s.LocationID = point.Office
+	if !officeOnly {
+		s.ForecastZone = point.ForecastZone
+		s.County = point.County
+	}
+	return nil
+}
+
+// Zones returns the user's forecast zone and county codes that are known
+func (s User) Zones() []string {
+	var zones []string
+	for _, zone := range []string{s.ForecastZone, s.County} {
+		if zone != "" {
+			zones = append(zones, zone)
+		}
+	}
+	return zones
+}
+
+// HeadlineStates returns the states whose headlines the user wants, or none
+// for every state the office covers
+func (s User) HeadlineStates() []string {
+	if s.State != "" {
+		return []string{strings.ToUpper(s.State)}
+	}
+	if len(s.ForecastZone) >= 2 {
+		return []string{strings.ToUpper(s.ForecastZone[:2])}
+	}
+	return nil
+}
+
+// ValidateLocations removes users whose LocationID isn't one of offices,
+// returning an error naming each one
+func (s *Users) ValidateLocations(offices []nws.Office) []error {
+	valid := make(map[string]bool, len(offices))
+	for _, office := range offices {
+		valid[strings.ToUpper(office.ID)] = true
+	}
+
+	var errs []error
+	kept := s.Users[:0]
+	for _, user := range s.Users {
+		if !valid[strings.ToUpper(user.LocationID)] {
+			errs = append(errs, fmt.Errorf("User %d (%s %s) has unknown locationId %q", user.ID, user.FirstName, user.LastName, user.LocationID))
+			continue
+		}
+		kept = append(kept, user)
+	}
+	s.Users = kept
+	return errs
+}
+
+// ValidateSources removes users whose Source isn't one of the config's
+// sources, returning an error naming each one
+func (s *Users) ValidateSources(config Config) []error {
+	var errs []error
+	kept := s.Users[:0]
+	for _, user := range s.Users {
+		if _, ok := config.Sources[user.Source]; user.Source != "" && !ok {
+			errs = append(errs, fmt.Errorf("User %d (%s %s) has unknown source %q", user.ID, user.FirstName, user.LastName, user.Source))
+			continue
+		}
+		kept = append(kept, user)
+	}
+	s.Users = kept
+	return errs
+}
+
+// QuietUntil reports whether now falls within the user's quiet hours and, if
+// so, when they end
+func (s User) QuietUntil(now time.Time) (time.Time, bool) {
+	if s.QuietHoursStart == "" || s.QuietHoursEnd == "" {
+		return time.Time{}, false
+	}
+	start, err := time.Parse("15:04", s.QuietHoursStart)
+	if err != nil {
+		return time.Time{}, false
+	}
+	end, err := time.Parse("15:04", s.QuietHoursEnd)
+	if err != nil {
+		return time.Time{}, false
+	}
+	loc := time.Local
+	if s.TimeZone != "" {
+		if l, err := time.LoadLocation(s.TimeZone); err == nil {
+			loc = l
+		}
+	}
+
+	now = now.In(loc)
+	minutes := now.Hour()*60 + now.Minute()
+	startMinutes := start.Hour()*60 + start.Minute()
+	endMinutes := end.Hour()*60 + end.Minute()
+	var quiet bool
+	if startMinutes <= endMinutes {
+		quiet = minutes >= startMinutes && minutes < endMinutes
+	} else {
+		// Quiet hours span midnight
+		quiet = minutes >= startMinutes || minutes < endMinutes
+	}
+	if !quiet {
+		return time.Time{}, false
+	}
+
+	until := time.Date(now.Year(), now.Month(), now.Day(), end.Hour(), end.Minute(), 0, 0, loc)
+	if !until.After(now) {
+		until = until.AddDate(0, 0, 1)
+	}
+	return until, true
+}
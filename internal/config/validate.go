@@ -0,0 +1,253 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/nws"
+)
+
+// FieldError struct is a problem with one field of the config or of a user,
+// named by its JSON path, e.g. "vonage.apiKey" or "users[2].phone"
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (s FieldError) Error() string {
+	return s.Field + ": " + s.Message
+}
+
+// Validate checks that the config has everything the selected providers need
+// and that every setting with a fixed set of values has one of them. Nothing
+// should be sent if it returns any errors.
+func (s Config) Validate() []error {
+	var errs []error
+	required := func(field string, value string, why string) {
+		if strings.TrimSpace(value) == "" {
+			errs = append(errs, FieldError{field, "is required " + why})
+		}
+	}
+	oneOf := func(field string, value string, values ...string) {
+		for _, v := range values {
+			if strings.EqualFold(value, v) {
+				return
+			}
+		}
+		errs = append(errs, FieldError{field, fmt.Sprintf("is %q, expected one of %q", value, values)})
+	}
+	isURL := func(field string, value string) {
+		if value == "" {
+			return
+		}
+		if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, FieldError{field, fmt.Sprintf("%q is not an absolute URL", value)})
+		}
+	}
+	notNegative := func(field string, value float64) {
+		if value < 0 {
+			errs = append(errs, FieldError{field, "can't be negative"})
+		}
+	}
+
+	switch strings.ToLower(s.SMSProvider) {
+	case "", "twilio":
+		if s.TwillioTestMode {
+			required("twillioTestAccountSID", s.TwillioTestAccountSID, "in test mode")
+			required("twillioTestAuthToken", s.TwillioTestAuthToken, "in test mode")
+			break
+		}
+		required("twillioAccountSID", s.TwillioAccountSID, "for Twilio")
+		required("twillioAuthToken", s.TwillioAuthToken, "for Twilio")
+		if s.TwillioFromPhone == "" && len(s.TwillioFromPhones) == 0 && s.TwillioMessagingServiceSID == "" {
+			errs = append(errs, FieldError{"twillioFromPhone", "is required for Twilio unless twillioFromPhones or twillioMessagingServiceSID is set"})
+		}
+	case "vonage":
+		required("vonage.apiKey", s.Vonage.APIKey, "for Vonage")
+		required("vonage.apiSecret", s.Vonage.APISecret, "for Vonage")
+		required("vonage.from", s.Vonage.From, "for Vonage")
+	case "sns":
+		if s.SNS.SMSType != "" {
+			oneOf("sns.smsType", s.SNS.SMSType, "Transactional", "Promotional")
+		}
+	case "messagebird":
+		required("messageBird.accessKey", s.MessageBird.AccessKey, "for MessageBird")
+		required("messageBird.originator", s.MessageBird.Originator, "for MessageBird")
+	default:
+		oneOf("smsProvider", s.SMSProvider, "twilio", "vonage", "sns", "messagebird")
+	}
+
+	if s.DefaultPhoneRegion != "" && len(s.DefaultPhoneRegion) != 2 {
+		errs = append(errs, FieldError{"defaultPhoneRegion", fmt.Sprintf("%q is not a two-letter region code", s.DefaultPhoneRegion)})
+	}
+	if s.DiffMode != "" {
+		oneOf("diffMode", s.DiffMode, DiffModeChanged, DiffModeMark)
+	}
+	if s.Summarizer.Backend != "" {
+		oneOf("summarizer.backend", s.Summarizer.Backend, "extractive", "llm")
+	}
+	if strings.EqualFold(s.Summarizer.Backend, "llm") {
+		required("summarizer.llmURL", s.Summarizer.LLMURL, "for the llm summarizer")
+		required("summarizer.llmModel", s.Summarizer.LLMModel, "for the llm summarizer")
+	}
+	switch strings.ToLower(s.LogLevel) {
+	case "", "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, FieldError{"logLevel", fmt.Sprintf("is %q, expected debug, info, warn or error", s.LogLevel)})
+	}
+	if s.LogFormat != "" {
+		oneOf("logFormat", s.LogFormat, "text", "json")
+	}
+	if s.Translator.Backend != "" {
+		oneOf("translator.backend", s.Translator.Backend, "libretranslate", "deepl")
+	}
+
+	isURL("nwsBaseURI", s.NWSBaseURI)
+	isURL("httpProxy", s.HTTPProxy)
+	isURL("twillioStatusCallbackURL", s.TwillioStatusCallbackURL)
+	isURL("twillioInboundURL", s.TwillioInboundURL)
+	isURL("summarizer.llmURL", s.Summarizer.LLMURL)
+	isURL("translator.url", s.Translator.URL)
+	isURL("otlpEndpoint", s.OTLPEndpoint)
+	isURL("sentryDSN", s.SentryDSN)
+	isURL("heartbeatURL", s.HeartbeatURL)
+	isURL("heartbeatFailURL", s.HeartbeatFailURL)
+	if s.StatusCallbackAddr != "" && s.TwillioStatusCallbackURL == "" && s.TwillioInboundURL == "" {
+		errs = append(errs, FieldError{"statusCallbackAddr", "is set but neither twillioStatusCallbackURL nor twillioInboundURL is"})
+	}
+
+	notNegative("maxDeliveryRetries", float64(s.MaxDeliveryRetries))
+	notNegative("deliveryTimeoutSeconds", float64(s.DeliveryTimeoutSeconds))
+	notNegative("httpTimeoutSeconds", float64(s.HTTPTimeoutSeconds))
+	notNegative("nwsRequestsPerSecond", s.NWSRequestsPerSecond)
+	notNegative("nwsMaxRetries", float64(s.NWSMaxRetries))
+	notNegative("nwsRetryDelayMS", float64(s.NWSRetryDelayMS))
+	notNegative("nwsBreakerThreshold", float64(s.NWSBreakerThreshold))
+	notNegative("nwsBreakerCooldownSeconds", float64(s.NWSBreakerCooldownSeconds))
+	notNegative("concurrency", float64(s.Concurrency))
+	notNegative("runTimeoutSeconds", float64(s.RunTimeoutSeconds))
+	notNegative("leaderLeaseSeconds", float64(s.LeaderLeaseSeconds))
+	notNegative("summarizer.maxLength", float64(s.Summarizer.MaxLength))
+	notNegative("adminAlerts.failureThreshold", float64(s.AdminAlerts.FailureThreshold))
+	notNegative("adminAlerts.cooldownMinutes", float64(s.AdminAlerts.CooldownMinutes))
+	if s.AdminAlerts.Email != "" {
+		required("adminAlerts.smtpAddr", s.AdminAlerts.SMTPAddr, "for email alerts")
+	}
+	for name, source := range s.Sources {
+		required("sources."+name+".type", source.Type, "for each source")
+		notNegative("sources."+name+".timeoutSeconds", float64(source.TimeoutSeconds))
+	}
+	for i, sink := range s.Sinks {
+		required(fmt.Sprintf("sinks[%d].type", i), sink.Type, "for each sink")
+		notNegative(fmt.Sprintf("sinks[%d].timeoutSeconds", i), float64(sink.TimeoutSeconds))
+	}
+	return errs
+}
+
+// Validate checks each user's fields. Users with an invalid field are removed
+// so nothing is sent to them, and an error naming the field is returned for
+// each problem.
+func (s *Users) Validate() []error {
+	var errs []error
+	seen := make(map[int]bool)
+	kept := s.Users[:0]
+	for i, user := range s.Users {
+		userErrs := user.Validate()
+		if seen[user.ID] {
+			userErrs = append(userErrs, FieldError{"id", fmt.Sprintf("%d is used by another user", user.ID)})
+		}
+		seen[user.ID] = true
+
+		for _, field := range userErrs {
+			field.Field = fmt.Sprintf("users[%d].%s", i, field.Field)
+			errs = append(errs, fmt.Errorf("User %d (%s %s): %v", user.ID, user.FirstName, user.LastName, field))
+		}
+		if len(userErrs) == 0 {
+			kept = append(kept, user)
+		}
+	}
+	s.Users = kept
+	return errs
+}
+
+func (s User) Validate() []FieldError {
+	var errs []FieldError
+	if strings.TrimSpace(s.Phone) == "" {
+		errs = append(errs, FieldError{"phone", "is required"})
+	}
+	if s.LocationID == "" && s.ZIPCode == "" && (s.Latitude == nil || s.Longitude == nil) {
+		errs = append(errs, FieldError{"locationId", "is required unless zipCode or latitude and longitude are set"})
+	}
+	if (s.Latitude == nil) != (s.Longitude == nil) {
+		errs = append(errs, FieldError{"latitude", "and longitude must be set together"})
+	}
+	if len(s.Subscriptions) == 0 && len(s.Keywords) == 0 {
+		errs = append(errs, FieldError{"subscriptions", "is empty and there are no keywords, so nothing would be sent"})
+	}
+	for i, subscription := range s.Subscriptions {
+		if strings.TrimSpace(subscription) == "" {
+			errs = append(errs, FieldError{fmt.Sprintf("subscriptions[%d]", i), "is empty"})
+		}
+	}
+	if s.MinSeverity != "" {
+		switch strings.ToLower(s.MinSeverity) {
+		case nws.SeverityLow, nws.SeverityModerate, nws.SeverityHigh, nws.SeverityExtreme:
+		default:
+			errs = append(errs, FieldError{"minSeverity", fmt.Sprintf("is %q, expected low, moderate, high or extreme", s.MinSeverity)})
+		}
+	}
+	switch strings.ToLower(s.Media) {
+	case "", "graphicast", "spc", "radar":
+	default:
+		errs = append(errs, FieldError{"media", fmt.Sprintf("is %q, expected graphicast, spc or radar", s.Media)})
+	}
+	if (s.QuietHoursStart == "") != (s.QuietHoursEnd == "") {
+		errs = append(errs, FieldError{"quietHoursStart", "and quietHoursEnd must be set together"})
+	}
+	for _, field := range []struct{ name, value string }{{"quietHoursStart", s.QuietHoursStart}, {"quietHoursEnd", s.QuietHoursEnd}} {
+		if _, err := time.Parse("15:04", field.value); field.value != "" && err != nil {
+			errs = append(errs, FieldError{field.name, fmt.Sprintf("%q is not a time like 22:00", field.value)})
+		}
+	}
+	if s.TimeZone != "" {
+		if _, err := time.LoadLocation(s.TimeZone); err != nil {
+			errs = append(errs, FieldError{"timeZone", err.Error()})
+		}
+	}
+	return errs
+}
+
+// CheckSubscriptions returns an error for each subscription that isn't a
+// section name most offices use or one configured in sectionAliases. These
+// are likely typos, but since an office may name its sections however it
+// likes, the subscriptions are kept.
+func (s Users) CheckSubscriptions(config Config) []error {
+	var errs []error
+	for _, user := range s.Users {
+		aliases := config.SectionAliasesFor(user.LocationID)
+		for _, subscription := range user.Subscriptions {
+			if nws.IsCommonSection(subscription, aliases) || hasAlias(aliases, subscription) {
+				continue
+			}
+			errs = append(errs, fmt.Errorf("User %d (%s %s): subscription %q is not a common section name", user.ID, user.FirstName, user.LastName, subscription))
+		}
+	}
+	return errs
+}
+
+func hasAlias(aliases map[string][]string, name string) bool {
+	name = nws.NormalizeSectionName(name)
+	for key, names := range aliases {
+		if nws.NormalizeSectionName(key) == name {
+			return true
+		}
+		for _, alias := range names {
+			if nws.NormalizeSectionName(alias) == name {
+				return true
+			}
+		}
+	}
+	return false
+}
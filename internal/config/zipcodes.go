@@ -0,0 +1,110 @@
+package config
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ZipTable maps US ZIP codes, or in DefaultZipTable their first three
+// digits, to the coordinates of their center
+type ZipTable map[string][2]float64
+
+// defaultZipCodes is the embedded table, in the gazetteer's format, with the
+// center of each three digit ZIP code prefix
+//
+//go:embed zipcodes.tsv
+var defaultZipCodes string
+
+// DefaultZipTable returns the table built into the binary, used unless a
+// gazetteer file is configured. It has only the center of each three digit
+// ZIP code prefix, near the area's mail processing center. That's close
+// enough to find most users' forecast office, but not their zone or county,
+// and near an office's boundary it may find the neighboring office.
+func DefaultZipTable() ZipTable {
+	table, err := readZipTable(strings.NewReader(defaultZipCodes), "zipcodes.tsv")
+	if err != nil {
+		panic(err)
+	}
+	return table
+}
+
+// LoadZipTable reads the Census Bureau ZCTA gazetteer file, available from
+// https://www.census.gov/geographies/reference-files/time-series/geo/gazetteer-files.html
+// It is tab separated with a header row, and the GEOID, INTPTLAT and
+// INTPTLONG columns are used.
+func LoadZipTable(path string) (ZipTable, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readZipTable(file, path)
+}
+
+// readZipTable parses a gazetteer file, path naming it in errors
+func readZipTable(r io.Reader, path string) (ZipTable, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+	columns := make(map[string]int)
+	for i, name := range strings.Split(scanner.Text(), "\t") {
+		columns[strings.TrimSpace(name)] = i
+	}
+	zipCol, ok1 := columns["GEOID"]
+	latCol, ok2 := columns["INTPTLAT"]
+	lonCol, ok3 := columns["INTPTLONG"]
+	if !ok1 || !ok2 || !ok3 {
+		return nil, fmt.Errorf("%s is missing the GEOID, INTPTLAT or INTPTLONG column", path)
+	}
+
+	table := make(ZipTable)
+	for line := 2; scanner.Scan(); line++ {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) <= zipCol || len(fields) <= latCol || len(fields) <= lonCol {
+			continue
+		}
+		lat, err := strconv.ParseFloat(strings.TrimSpace(fields[latCol]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", path, line, err)
+		}
+		lon, err := strconv.ParseFloat(strings.TrimSpace(fields[lonCol]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", path, line, err)
+		}
+		table[strings.TrimSpace(fields[zipCol])] = [2]float64{lat, lon}
+	}
+	return table, scanner.Err()
+}
+
+// Lookup returns the coordinates of a ZIP code. ZIP+4 codes are accepted.
+func (s ZipTable) Lookup(zip string) (float64, float64, bool) {
+	zip = normalizeZIP(zip)
+	coords, ok := s[zip]
+	return coords[0], coords[1], ok && len(zip) == 5
+}
+
+// LookupPrefix returns the coordinates of the first three digits of a ZIP
+// code, as in DefaultZipTable
+func (s ZipTable) LookupPrefix(zip string) (float64, float64, bool) {
+	zip = normalizeZIP(zip)
+	if len(zip) != 5 {
+		return 0, 0, false
+	}
+	coords, ok := s[zip[:3]]
+	return coords[0], coords[1], ok
+}
+
+// normalizeZIP trims a ZIP code to its first five digits
+func normalizeZIP(zip string) string {
+	zip = strings.TrimSpace(zip)
+	if len(zip) > 5 {
+		zip = zip[:5]
+	}
+	return zip
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/nws"
+	"github.com/johnwcallahan/forecast-discussion-alerts/nws/nwstest"
+)
+
+func TestDefaultZipTable(t *testing.T) {
+	zips := DefaultZipTable()
+	tests := []struct {
+		zip      string
+		lat, lon float64
+		ok       bool
+	}{
+		{"02134", 42.36, -71.06, true},
+		{"60614-1234", 41.88, -87.63, true},
+		{" 80302 ", 40.01, -105.27, true},
+		{"99901", 55.34, -131.64, true},
+		{"00100", 0, 0, false},
+		{"021", 0, 0, false},
+	}
+	for _, test := range tests {
+		lat, lon, ok := zips.LookupPrefix(test.zip)
+		if ok != test.ok || lat != test.lat || lon != test.lon {
+			t.Errorf("LookupPrefix(%q) = %v, %v, %v, want %v, %v, %v", test.zip, lat, lon, ok, test.lat, test.lon, test.ok)
+		}
+		if _, _, ok := zips.Lookup(test.zip); ok {
+			t.Errorf("Lookup(%q) matched a prefix", test.zip)
+		}
+	}
+}
+
+func TestLoadZipTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "zcta.txt")
+	gazetteer := "GEOID\tALAND\tINTPTLAT\tINTPTLONG\n02134\t1\t42.355\t-71.126\n"
+	if err := ioutil.WriteFile(path, []byte(gazetteer), 0644); err != nil {
+		t.Fatal(err)
+	}
+	zips, err := LoadZipTable(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lat, lon, ok := zips.Lookup("02134"); !ok || lat != 42.355 || lon != -71.126 {
+		t.Errorf("Lookup(02134) = %v, %v, %v", lat, lon, ok)
+	}
+	if _, _, ok := zips.Lookup("02139"); ok {
+		t.Error("Lookup(02139) found a ZIP code missing from the file")
+	}
+}
+
+func TestResolveLocationsByZIPCode(t *testing.T) {
+	server := nwstest.NewServer()
+	defer server.Close()
+	box := nws.Point{Office: "BOX", ForecastZone: "MAZ015", County: "MAC025"}
+	server.AddPoint(42.355, -71.126, box)
+	server.AddPoint(42.36, -71.06, box)
+
+	zips := DefaultZipTable()
+	zips["02134"] = [2]float64{42.355, -71.126}
+	users := Users{Users: []User{
+		{ID: 1, ZIPCode: "02134"},
+		{ID: 2, ZIPCode: "02139"},
+		{ID: 3, ZIPCode: "00100"},
+	}}
+	errs := users.ResolveLocations(context.Background(), server.NWSClient(), zips)
+	if len(errs) != 1 || len(users.Users) != 2 {
+		t.Fatalf("Resolved %d users with errors %v, want 2 and the unknown ZIP code", len(users.Users), errs)
+	}
+	// Only a ZIP code in the table gets the zone and county
+	if user := users.Users[0]; user.LocationID != "BOX" || user.ForecastZone != "MAZ015" || user.County != "MAC025" {
+		t.Errorf("ZIP code 02134 resolved to %s, %s and %s", user.LocationID, user.ForecastZone, user.County)
+	}
+	if user := users.Users[1]; user.LocationID != "BOX" || len(user.Zones()) != 0 {
+		t.Errorf("ZIP code 02139 resolved to %s and zones %v, want BOX alone", user.LocationID, user.Zones())
+	}
+}
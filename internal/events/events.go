@@ -0,0 +1,72 @@
+// Package events lets features such as metrics react to what happens in a
+// run without being wired into it: the runner publishes events on a Bus and
+// each feature subscribes to the ones it cares about.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// NewIssuance struct is published when a fetch finds a discussion the runner
+// hadn't seen for the office since it was loaded
+type NewIssuance struct {
+	Office    string
+	ProductID string
+	Issued    time.Time
+}
+
+// SectionChanged struct is published for each section about to be delivered
+// to a user because it changed since it was last sent to them, or was never
+// sent
+type SectionChanged struct {
+	User    int
+	Office  string
+	Section string
+	Text    string
+}
+
+// SendFailed struct is published for each message, or part of one, a sink
+// couldn't deliver
+type SendFailed struct {
+	User    int
+	Office  string
+	Sink    string
+	Section string
+	Err     error
+}
+
+// Handler is called with each event published, one of the types above. It's
+// called from the goroutine publishing, possibly several at once, so it
+// should be quick and safe for concurrent use.
+type Handler func(event interface{})
+
+// Bus struct delivers each event published to every handler subscribed. The
+// zero value is ready to use, and its methods do nothing on a nil *Bus.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+// Subscribe calls handler for every event published from now on
+func (s *Bus) Subscribe(handler Handler) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.handlers = append(s.handlers, handler)
+	s.mu.Unlock()
+}
+
+// Publish calls every handler with event, in the order they subscribed
+func (s *Bus) Publish(event interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.RLock()
+	handlers := s.handlers
+	s.mu.RUnlock()
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
@@ -0,0 +1,29 @@
+// Package httpjson makes the requests to the JSON APIs integrated with, such
+// as secret stores, translators and summarizers.
+package httpjson
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// Do sends req with ctx and decodes the JSON response into v. A status other
+// than 200 is an error naming the host, with the response body.
+func Do(ctx context.Context, client *http.Client, req *http.Request, v interface{}) error {
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("%s returned %d: %s", req.URL.Host, resp.StatusCode, body)
+	}
+	return json.Unmarshal(body, v)
+}
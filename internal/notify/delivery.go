@@ -0,0 +1,216 @@
+package notify
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/store"
+)
+
+// DefaultDeliveryTimeout is how long to wait for final delivery statuses when
+// the config doesn't say otherwise
+const DefaultDeliveryTimeout = 5 * time.Minute
+
+// DeliveryStatus struct records the last known state of a sent message
+type DeliveryStatus struct {
+	SID       string
+	To        string
+	Body      string
+	MediaURL  string
+	Status    string
+	ErrorCode string
+	Attempts  int
+}
+
+// Final reports whether the message has a status Twilio may send no further
+// updates after. That includes "sent", the last status for carriers without
+// delivery receipts, though others may still report it delivered or not.
+func (s DeliveryStatus) Final() bool {
+	switch s.Status {
+	case "sent", "delivered", "undelivered", "failed":
+		return true
+	}
+	return false
+}
+
+// Failed reports whether the message could not be delivered
+func (s DeliveryStatus) Failed() bool {
+	return s.Status == "undelivered" || s.Status == "failed"
+}
+
+// DeliveryTracker struct receives Twilio status callbacks, records the
+// statuses and resends messages that failed. There's no other channel to fall
+// back to: a message still failing after MaxRetries resends is logged, and
+// its final status is in the audit log.
+type DeliveryTracker struct {
+	Sender     *SMSSender
+	AuthToken  string
+	URL        string
+	MaxRetries int
+	Timeout    time.Duration
+
+	mu       sync.Mutex
+	messages map[string]*DeliveryStatus
+	// retrying counts the resends in progress, which Wait waits for too
+	retrying int
+}
+
+// NewDeliveryTracker returns a tracker that retries through sender
+func NewDeliveryTracker(sender *SMSSender, config config.Config) *DeliveryTracker {
+	timeout := time.Duration(config.DeliveryTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = DefaultDeliveryTimeout
+	}
+	return &DeliveryTracker{
+		Sender:     sender,
+		AuthToken:  config.TwillioAuthToken,
+		URL:        config.TwillioStatusCallbackURL,
+		MaxRetries: config.MaxDeliveryRetries,
+		Timeout:    timeout,
+		messages:   make(map[string]*DeliveryStatus),
+	}
+}
+
+// Track starts recording the status of a sent message
+func (s *DeliveryTracker) Track(sid string, to string, body string, mediaURL string, attempts int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages[sid] = &DeliveryStatus{
+		SID:      sid,
+		To:       to,
+		Body:     body,
+		MediaURL: mediaURL,
+		Status:   "queued",
+		Attempts: attempts + 1,
+	}
+}
+
+// Statuses returns a snapshot of every tracked message
+func (s *DeliveryTracker) Statuses() []DeliveryStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]DeliveryStatus, 0, len(s.messages))
+	for _, status := range s.messages {
+		statuses = append(statuses, *status)
+	}
+	return statuses
+}
+
+// Wait blocks until every tracked message has a final status, the timeout
+// passes or ctx is done, then stops tracking them, so each run waits only on
+// the messages it sent and statuses arriving later are ignored
+func (s *DeliveryTracker) Wait(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for s.pending() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			slog.Warn("Gave up waiting on delivery statuses", "pending", s.pending())
+			s.reset()
+			return
+		}
+	}
+	s.reset()
+}
+
+func (s *DeliveryTracker) pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := s.retrying
+	for _, status := range s.messages {
+		if !status.Final() {
+			count++
+		}
+	}
+	return count
+}
+
+// reset stops tracking every message
+func (s *DeliveryTracker) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = make(map[string]*DeliveryStatus)
+}
+
+// ServeHTTP handles a Twilio status callback
+func (s *DeliveryTracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !validTwilioSignature(r, s.AuthToken, s.URL) {
+		http.Error(w, "Invalid signature", http.StatusForbidden)
+		return
+	}
+
+	s.mu.Lock()
+	status, ok := s.messages[r.PostForm.Get("MessageSid")]
+	var final DeliveryStatus
+	if ok {
+		previous := status.Status
+		status.Status = r.PostForm.Get("MessageStatus")
+		status.ErrorCode = r.PostForm.Get("ErrorCode")
+		// A "sent" message may later be reported delivered or not, which
+		// is recorded too. Repeated callbacks are ignored.
+		if status.Final() && status.Status != previous {
+			final = *status
+		}
+	}
+	if final.Failed() {
+		s.retrying++
+	}
+	s.mu.Unlock()
+
+	if final.SID != "" {
+		err := s.Sender.Audit.Record(store.AuditEntry{
+			To:          final.To,
+			Channel:     s.Sender.Channel,
+			SID:         final.SID,
+			MessageHash: store.MessageHash(final.Body),
+			MMS:         final.MediaURL != "",
+			Status:      final.Status,
+			Attempts:    final.Attempts,
+			Error:       final.ErrorCode,
+		})
+		if err != nil {
+			slog.Error("Couldn't write the audit log", "sid", final.SID, "err", err)
+		}
+	}
+
+	// Resending can outlast Twilio's wait for an answer, which would cancel
+	// the request's context, so it's done in the background
+	if final.Failed() {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+			defer cancel()
+			s.retry(ctx, final)
+			s.mu.Lock()
+			s.retrying--
+			s.mu.Unlock()
+		}()
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// retry resends a failed message, unless it has used up its retries, and
+// tracks the resend
+func (s *DeliveryTracker) retry(ctx context.Context, status DeliveryStatus) {
+	if status.Attempts > s.MaxRetries {
+		slog.Error("Giving up on undelivered message", "sid", status.SID, "to", status.To, "attempts", status.Attempts, "errorCode", status.ErrorCode)
+		return
+	}
+
+	sid, err := s.Sender.SendMMS(ctx, status.To, status.Body, status.MediaURL)
+	if err != nil {
+		slog.Error("Couldn't resend undelivered message", "sid", status.SID, "err", err)
+		return
+	}
+	s.Track(sid, status.To, status.Body, status.MediaURL, status.Attempts)
+}
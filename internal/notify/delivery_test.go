@@ -0,0 +1,138 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/store"
+)
+
+const testCallbackURL = "https://alerts.example.com/twilio/status"
+
+// postStatus sends tracker a signed status callback for a message
+func postStatus(t *testing.T, tracker *DeliveryTracker, sid string, status string) {
+	t.Helper()
+	form := url.Values{"MessageSid": {sid}, "MessageStatus": {status}}
+	keys := make([]string, 0, len(form))
+	for key := range form {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	data := testCallbackURL
+	for _, key := range keys {
+		data += key + form.Get(key)
+	}
+	mac := hmac.New(sha1.New, []byte(tracker.AuthToken))
+	mac.Write([]byte(data))
+
+	req := httptest.NewRequest("POST", testCallbackURL, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Twilio-Signature", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	w := httptest.NewRecorder()
+	tracker.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Status callback for %s answered %d", sid, w.Code)
+	}
+}
+
+func TestDeliveryTrackerWait(t *testing.T) {
+	tracker := NewDeliveryTracker(&SMSSender{}, config.Config{
+		TwillioAuthToken:         "token",
+		TwillioStatusCallbackURL: testCallbackURL,
+	})
+	tracker.Timeout = time.Minute
+
+	// A message only reported sent, by a carrier without delivery
+	// receipts, doesn't hold up the wait
+	tracker.Track("SM1", "+16175551001", "SHORT TERM: Dry.", "", 0)
+	tracker.Track("SM2", "+16175551002", "SHORT TERM: Dry.", "", 0)
+	postStatus(t, tracker, "SM1", "sent")
+	postStatus(t, tracker, "SM2", "delivered")
+	start := time.Now()
+	tracker.Wait(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Wait took %s with every message final", elapsed)
+	}
+	if statuses := tracker.Statuses(); len(statuses) != 0 {
+		t.Errorf("Wait left %d messages tracked, want none", len(statuses))
+	}
+
+	// A message never reported on is dropped when the wait ends, so the
+	// next run doesn't wait on it
+	tracker.Track("SM3", "+16175551003", "SHORT TERM: Dry.", "", 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start = time.Now()
+	tracker.Wait(ctx)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Wait took %s after ctx was canceled", elapsed)
+	}
+	if statuses := tracker.Statuses(); len(statuses) != 0 {
+		t.Errorf("Wait left %d messages tracked after giving up, want none", len(statuses))
+	}
+}
+
+// heldProvider struct sends each message once released, reporting its
+// context's error
+type heldProvider struct {
+	release chan struct{}
+	sent    chan error
+}
+
+func (s *heldProvider) SendSMS(ctx context.Context, to string, body string) (string, error) {
+	<-s.release
+	s.sent <- ctx.Err()
+	return "SM-resent", nil
+}
+
+func TestDeliveryTrackerRetriesInTheBackground(t *testing.T) {
+	provider := &heldProvider{release: make(chan struct{}), sent: make(chan error, 1)}
+	cfg := config.Config{
+		TwillioAuthToken:         "token",
+		TwillioStatusCallbackURL: testCallbackURL,
+		MaxDeliveryRetries:       1,
+	}
+	tracker := NewDeliveryTracker(NewSMSSender(cfg, provider, &store.OptOutList{}), cfg)
+	tracker.Timeout = time.Minute
+
+	tracker.Track("SM1", "+16175551001", "SHORT TERM: Dry.", "", 0)
+	// The callback is answered while the resend is held
+	postStatus(t, tracker, "SM1", "undelivered")
+	close(provider.release)
+	if err := <-provider.sent; err != nil {
+		t.Errorf("The resend's context was done: %v", err)
+	}
+
+	// Wait waits for the resend to be tracked and reported on
+	done := make(chan struct{})
+	go func() {
+		tracker.Wait(context.Background())
+		close(done)
+	}()
+	for {
+		var tracked bool
+		for _, status := range tracker.Statuses() {
+			tracked = tracked || status.SID == "SM-resent" && status.Attempts == 2
+		}
+		if tracked {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	postStatus(t, tracker, "SM-resent", "delivered")
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait didn't return once the resend was delivered")
+	}
+}
@@ -0,0 +1,45 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// DryRunProvider struct prints messages instead of sending them, for
+// --dry-run
+type DryRunProvider struct {
+	Out io.Writer
+
+	mu    sync.Mutex
+	count int
+}
+
+// SendSMS prints the message
+func (s *DryRunProvider) SendSMS(ctx context.Context, to string, body string) (string, error) {
+	return s.SendMMS(ctx, to, body, "")
+}
+
+// SendMMS prints the message and the URL of its image
+func (s *DryRunProvider) SendMMS(ctx context.Context, to string, body string, mediaURL string) (string, error) {
+	return s.print(fmt.Sprintf("To %s", to), body, mediaURL)
+}
+
+// ScheduleMMS prints the message and when it would be delivered
+func (s *DryRunProvider) ScheduleMMS(ctx context.Context, to string, body string, mediaURL string, sendAt time.Time) (string, error) {
+	return s.print(fmt.Sprintf("To %s at %s", to, sendAt.Format(time.RFC3339)), body, mediaURL)
+}
+
+func (s *DryRunProvider) print(header string, body string, mediaURL string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count++
+	fmt.Fprintf(s.Out, "--- %s (%d segments)\n", header, CountSegments(body))
+	if mediaURL != "" {
+		fmt.Fprintf(s.Out, "Media: %s\n", mediaURL)
+	}
+	fmt.Fprintf(s.Out, "%s\n\n", body)
+	return fmt.Sprintf("dry-run-%d", s.count), nil
+}
@@ -0,0 +1,47 @@
+package notify
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/store"
+)
+
+var (
+	optOutKeywords = []string{"STOP", "STOPALL", "UNSUBSCRIBE", "CANCEL", "END", "QUIT"}
+	optInKeywords  = []string{"START", "YES", "UNSTOP"}
+)
+
+// InboundHandler returns a handler for Twilio incoming message webhooks that
+// records STOP and START replies
+func InboundHandler(optOuts *store.OptOutList, authToken string, url string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !validTwilioSignature(r, authToken, url) {
+			http.Error(w, "Invalid signature", http.StatusForbidden)
+			return
+		}
+
+		from := r.PostForm.Get("From")
+		keyword := strings.ToUpper(strings.TrimSpace(r.PostForm.Get("Body")))
+		var err error
+		switch {
+		case slices.Contains(optOutKeywords, keyword):
+			err = optOuts.Add(from)
+		case slices.Contains(optInKeywords, keyword):
+			err = optOuts.Remove(from)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// An empty TwiML response, Twilio sends its own STOP/START replies
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte("<Response></Response>"))
+	})
+}
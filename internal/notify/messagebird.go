@@ -0,0 +1,120 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+)
+
+// MessageBird error codes, see https://developers.messagebird.com/api/#api-errors
+const (
+	messageBirdErrAccessKey  = 2
+	messageBirdErrBalance    = 25
+	messageBirdErrOriginator = 9
+)
+
+// MessageBirdProvider struct sends messages through the MessageBird API
+type MessageBirdProvider struct {
+	Config     config.MessageBird
+	BaseURI    string
+	HTTPClient *http.Client
+}
+
+// NewMessageBirdProvider returns a provider with default params
+func NewMessageBirdProvider(config config.MessageBird, httpClient *http.Client) *MessageBirdProvider {
+	return &MessageBirdProvider{
+		Config:     config,
+		BaseURI:    "https://rest.messagebird.com",
+		HTTPClient: httpClient,
+	}
+}
+
+// MessageBirdError struct is an error response from the MessageBird API
+type MessageBirdError struct {
+	Status  int
+	Code    int
+	Message string
+}
+
+func (e *MessageBirdError) Error() string {
+	return fmt.Sprintf("MessageBird error %d: %s", e.Code, e.Message)
+}
+
+// Temporary reports whether the request may succeed if retried
+func (e *MessageBirdError) Temporary() bool {
+	return e.Status == http.StatusTooManyRequests || e.Status >= 500
+}
+
+// Misconfigured reports whether the error is caused by our own config
+func (e *MessageBirdError) Misconfigured() bool {
+	return e.Code == messageBirdErrAccessKey || e.Code == messageBirdErrBalance || e.Code == messageBirdErrOriginator
+}
+
+// SendSMS sends a message from the configured originator
+func (s *MessageBirdProvider) SendSMS(ctx context.Context, to string, body string) (string, error) {
+	return s.post(ctx, "/messages", map[string]interface{}{
+		"recipients": []string{strings.TrimPrefix(to, "+")},
+		"originator": s.Config.Originator,
+		"body":       body,
+	})
+}
+
+// SendMMS sends a message with an image attached
+func (s *MessageBirdProvider) SendMMS(ctx context.Context, to string, body string, mediaURL string) (string, error) {
+	return s.post(ctx, "/mms", map[string]interface{}{
+		"recipients": []string{strings.TrimPrefix(to, "+")},
+		"originator": s.Config.Originator,
+		"body":       body,
+		"mediaUrls":  []string{mediaURL},
+	})
+}
+
+func (s *MessageBirdProvider) post(ctx context.Context, path string, payload map[string]interface{}) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.BaseURI+path, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "AccessKey "+s.Config.AccessKey)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		ID     string `json:"id"`
+		Errors []struct {
+			Code        int    `json:"code"`
+			Description string `json:"description"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("%s", body)
+	}
+	if len(result.Errors) > 0 {
+		return "", &MessageBirdError{
+			Status:  resp.StatusCode,
+			Code:    result.Errors[0].Code,
+			Message: result.Errors[0].Description,
+		}
+	}
+	if resp.StatusCode >= 300 {
+		return "", &MessageBirdError{Status: resp.StatusCode, Message: string(body)}
+	}
+	return result.ID, nil
+}
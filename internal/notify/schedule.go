@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/notifier"
+)
+
+// Twilio only accepts scheduled messages between 15 minutes and 35 days
+// ahead, see https://www.twilio.com/docs/messaging/features/message-scheduling
+const (
+	MinScheduleLead = 15 * time.Minute
+	MaxScheduleLead = 35 * 24 * time.Hour
+)
+
+// ErrSchedulingUnsupported is returned when the provider can't schedule
+// messages with the current config
+var ErrSchedulingUnsupported = notifier.ErrSchedulingUnsupported
+
+// SchedulingProvider is implemented by providers that can hold a message
+// and deliver it later, so we don't have to be running at delivery time
+type SchedulingProvider = notifier.SchedulingProvider
+
+// Schedule hands a message to the provider to be delivered at sendAt, which
+// is moved forward if it's sooner than the provider allows
+func (s *SMSSender) Schedule(ctx context.Context, to string, body string, mediaURL string, sendAt time.Time) (string, error) {
+	if s.OptOuts.Contains(to) {
+		s.audit(to, body, mediaURL, "", "unsubscribed", 0, ErrUnsubscribed)
+		return "", ErrUnsubscribed
+	}
+	scheduler, ok := s.Provider.(SchedulingProvider)
+	if !ok {
+		return "", ErrSchedulingUnsupported
+	}
+	now := time.Now()
+	if s.Now != nil {
+		now = s.Now()
+	}
+	if earliest := now.Add(MinScheduleLead); sendAt.Before(earliest) {
+		sendAt = earliest
+	}
+	if sendAt.Sub(now) > MaxScheduleLead {
+		return "", errors.New("Can't schedule a message more than 35 days ahead")
+	}
+
+	sid, err := scheduler.ScheduleMMS(ctx, to, body, mediaURL, sendAt)
+	if errors.Is(err, ErrUnsubscribed) {
+		if saveErr := s.OptOuts.Add(to); saveErr != nil {
+			return "", saveErr
+		}
+	}
+	if err == nil {
+		s.Usage.Record(to, body, mediaURL != "")
+		s.audit(to, body, mediaURL, sid, "scheduled", 1, nil)
+	} else {
+		s.audit(to, body, mediaURL, sid, "failed", 1, err)
+	}
+	return sid, err
+}
@@ -0,0 +1,212 @@
+// Package notify sends messages through the SMS providers and tracks their
+// delivery.
+package notify
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/store"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/telemetry"
+	"github.com/johnwcallahan/forecast-discussion-alerts/notifier"
+)
+
+// MaxSMSLength is the maximum body length Twilio accepts for a single message
+const MaxSMSLength = notifier.MaxSMSLength
+
+// MaxSendRetries is how many times a send is retried on temporary errors
+const MaxSendRetries = 3
+
+// ErrUnsubscribed is returned when sending to a number that has opted out
+var ErrUnsubscribed = notifier.ErrUnsubscribed
+
+// SMSProvider is implemented by each SMS gateway we can send through
+type SMSProvider = notifier.Provider
+
+// MMSProvider is implemented by providers that can attach images
+type MMSProvider = notifier.MMSProvider
+
+// NewSMSProvider returns the provider selected in config, Twilio by default,
+// making its requests through httpClient
+func NewSMSProvider(config config.Config, httpClient *http.Client) (SMSProvider, error) {
+	switch strings.ToLower(config.SMSProvider) {
+	case "", "twilio":
+		return NewTwilioProvider(config, httpClient), nil
+	case "vonage":
+		return NewVonageProvider(config.Vonage, httpClient), nil
+	case "sns":
+		return NewSNSProvider(config.SNS, httpClient)
+	case "messagebird":
+		return NewMessageBirdProvider(config.MessageBird, httpClient), nil
+	}
+	return nil, errors.New("Unknown SMS provider " + config.SMSProvider)
+}
+
+// Sender is what a run sends messages through. SMSSender implements it;
+// tests can substitute one that records the messages instead.
+type Sender = notifier.Sender
+
+var _ Sender = (*SMSSender)(nil)
+
+// ChannelName names the provider selected in config for metrics and
+// traces, e.g. "twilio"
+func ChannelName(config config.Config) string {
+	if config.SMSProvider == "" {
+		return "twilio"
+	}
+	return strings.ToLower(config.SMSProvider)
+}
+
+// SMSSender struct sends messages through an SMS provider, skipping opted out
+// numbers, retrying temporary errors and tracking usage
+type SMSSender struct {
+	Provider SMSProvider
+	OptOuts  *store.OptOutList
+	Usage    *UsageTracker
+	// Channel names the provider in metrics, e.g. "twilio"
+	Channel string
+	// Metrics and Audit may be nil
+	Metrics *telemetry.Metrics
+	Audit   *store.AuditLog
+	// Now tells the time scheduled messages are held from, time.Now if nil
+	Now func() time.Time
+}
+
+// NewSMSSender returns a sender using provider, e.g. from NewSMSProvider,
+// that never sends to numbers on optOuts
+func NewSMSSender(config config.Config, provider SMSProvider, optOuts *store.OptOutList) *SMSSender {
+	return &SMSSender{
+		Provider: provider,
+		OptOuts:  optOuts,
+		Usage:    NewUsageTracker(config),
+		Channel:  ChannelName(config),
+	}
+}
+
+// Verify checks the provider's credentials, if the provider supports it, so
+// misconfiguration is reported at startup rather than on every send
+func (s *SMSSender) Verify(ctx context.Context) error {
+	if verifier, ok := s.Provider.(interface{ Verify(context.Context) error }); ok {
+		return verifier.Verify(ctx)
+	}
+	return nil
+}
+
+// Send sends a single message to a phone number and returns the ID the
+// provider assigned to it
+func (s *SMSSender) Send(ctx context.Context, to string, body string) (string, error) {
+	return s.SendMMS(ctx, to, body, "")
+}
+
+// SendMMS sends a message with an image attached. An empty mediaURL, or a
+// provider without MMS support, sends a plain SMS. Temporary errors are
+// retried, and numbers that have unsubscribed are added to the opt-out list
+// and not sent to again.
+func (s *SMSSender) SendMMS(ctx context.Context, to string, body string, mediaURL string) (string, error) {
+	if s.OptOuts.Contains(to) {
+		s.audit(to, body, mediaURL, "", "unsubscribed", 0, ErrUnsubscribed)
+		return "", ErrUnsubscribed
+	}
+	mmsProvider, ok := s.Provider.(MMSProvider)
+	if !ok {
+		mediaURL = ""
+	}
+
+	var sid string
+	var err error
+	delay := time.Second
+	attempt := 0
+	for ; attempt <= MaxSendRetries; attempt++ {
+		if attempt > 0 {
+			s.Metrics.MessageRetried(s.Channel)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+			delay *= 2
+		}
+		if mediaURL != "" {
+			sid, err = mmsProvider.SendMMS(ctx, to, body, mediaURL)
+		} else {
+			sid, err = s.Provider.SendSMS(ctx, to, body)
+		}
+		if !isTemporary(err) {
+			break
+		}
+	}
+	if attempt > MaxSendRetries {
+		attempt = MaxSendRetries
+	}
+
+	if errors.Is(err, ErrUnsubscribed) {
+		if saveErr := s.OptOuts.Add(to); saveErr != nil {
+			return "", saveErr
+		}
+	}
+	if err == nil {
+		s.Usage.Record(to, body, mediaURL != "")
+		s.Metrics.MessageSent(s.Channel, CountSegments(body))
+		s.audit(to, body, mediaURL, sid, "sent", attempt+1, nil)
+	} else {
+		s.audit(to, body, mediaURL, sid, "failed", attempt+1, err)
+	}
+	return sid, err
+}
+
+// audit records a send attempt in the audit log, logging if it can't
+func (s *SMSSender) audit(to string, body string, mediaURL string, sid string, status string, attempts int, err error) {
+	entry := store.AuditEntry{
+		To:          to,
+		Channel:     s.Channel,
+		SID:         sid,
+		MessageHash: store.MessageHash(body),
+		MMS:         mediaURL != "",
+		Status:      status,
+		Attempts:    attempts,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+		if errors.Is(err, ErrUnsubscribed) {
+			entry.Status = "unsubscribed"
+		}
+	}
+	if auditErr := s.Audit.Record(entry); auditErr != nil {
+		slog.Error("Couldn't write the audit log", "sid", sid, "err", auditErr)
+	}
+}
+
+// isTemporary reports whether err is a provider error that may succeed if
+// retried
+func isTemporary(err error) bool {
+	return notifier.IsTemporary(err)
+}
+
+// IsMisconfigured reports whether err is a provider error caused by our own
+// config, in which case every other send will fail too
+func IsMisconfigured(err error) bool {
+	return notifier.IsMisconfigured(err)
+}
+
+// MediaURL returns the URL of the forecast graphic of the given kind for a
+// user, or an empty string if the user hasn't asked for one
+func MediaURL(user config.User) string {
+	switch strings.ToLower(user.Media) {
+	case "graphicast":
+		return "https://www.weather.gov/images/" + strings.ToLower(user.LocationID) + "/graphicast/image1.png"
+	case "spc":
+		return "https://www.spc.noaa.gov/products/outlook/day1otlk.gif"
+	case "radar":
+		station := "CONUS"
+		if user.RadarStation != "" {
+			station = strings.ToUpper(user.RadarStation)
+		}
+		return "https://radar.weather.gov/ridge/standard/" + station + "_0.gif"
+	}
+	return ""
+}
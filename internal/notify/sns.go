@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/smithy-go"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+)
+
+// SNSProvider struct sends messages through AWS SNS
+type SNSProvider struct {
+	Client *sns.Client
+	Config config.SNS
+}
+
+// NewSNSProvider returns a provider using the default AWS credential chain
+func NewSNSProvider(config config.SNS, httpClient *http.Client) (*SNSProvider, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background(),
+		awsconfig.WithRegion(config.Region),
+		awsconfig.WithHTTPClient(httpClient),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &SNSProvider{
+		Client: sns.NewFromConfig(cfg),
+		Config: config,
+	}, nil
+}
+
+// SNSError struct wraps an error returned by the SNS API
+type SNSError struct {
+	Err smithy.APIError
+}
+
+func (e *SNSError) Error() string {
+	return "SNS error " + e.Err.ErrorCode() + ": " + e.Err.ErrorMessage()
+}
+
+func (e *SNSError) Unwrap() error {
+	return e.Err
+}
+
+// Is lets errors.Is match ErrUnsubscribed
+func (e *SNSError) Is(target error) bool {
+	return target == ErrUnsubscribed && e.Err.ErrorCode() == "OptedOut"
+}
+
+// Temporary reports whether the request may succeed if retried
+func (e *SNSError) Temporary() bool {
+	switch e.Err.ErrorCode() {
+	case "Throttling", "ThrottledException", "InternalError", "InternalFailure":
+		return true
+	}
+	return false
+}
+
+// Misconfigured reports whether the error is caused by our own config
+func (e *SNSError) Misconfigured() bool {
+	switch e.Err.ErrorCode() {
+	case "AuthorizationError", "InvalidClientTokenId", "SignatureDoesNotMatch":
+		return true
+	}
+	return false
+}
+
+// SendSMS publishes a message directly to a phone number
+func (s *SNSProvider) SendSMS(ctx context.Context, to string, body string) (string, error) {
+	smsType := s.Config.SMSType
+	if smsType == "" {
+		smsType = "Transactional"
+	}
+	attributes := map[string]types.MessageAttributeValue{
+		"AWS.SNS.SMS.SMSType": {
+			DataType:    aws.String("String"),
+			StringValue: aws.String(smsType),
+		},
+	}
+	if s.Config.SenderID != "" {
+		attributes["AWS.SNS.SMS.SenderID"] = types.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(s.Config.SenderID),
+		}
+	}
+
+	out, err := s.Client.Publish(ctx, &sns.PublishInput{
+		PhoneNumber:       aws.String(to),
+		Message:           aws.String(body),
+		MessageAttributes: attributes,
+	})
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return "", &SNSError{Err: apiErr}
+	}
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(out.MessageId), nil
+}
@@ -0,0 +1,298 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+)
+
+// Twilio error codes we react to, see https://www.twilio.com/docs/api/errors
+const (
+	TwilioErrAuthentication   = 20003
+	TwilioErrTooManyRequests  = 20429
+	TwilioErrInvalidFrom      = 21212
+	TwilioErrFromNotCapable   = 21606
+	TwilioErrUnsubscribed     = 21610
+	TwilioErrNotTwilioNumber  = 21659
+	TwilioErrMissingServiceID = 21701
+)
+
+// TwilioError struct is an error response from the Twilio API
+type TwilioError struct {
+	Status  int
+	Code    int
+	Message string
+}
+
+// twilioException is the body of a Twilio API error response
+type twilioException struct {
+	Status  int    `json:"status"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// twilioMessage is the part of a Twilio message resource we use
+type twilioMessage struct {
+	Sid string `json:"sid"`
+}
+
+func (e *TwilioError) Error() string {
+	return fmt.Sprintf("Twilio error %d: %s", e.Code, e.Message)
+}
+
+// Is lets errors.Is match ErrUnsubscribed
+func (e *TwilioError) Is(target error) bool {
+	return target == ErrUnsubscribed && e.Code == TwilioErrUnsubscribed
+}
+
+// Temporary reports whether the request may succeed if retried
+func (e *TwilioError) Temporary() bool {
+	return e.Status == http.StatusTooManyRequests || e.Status >= 500 || e.Code == TwilioErrTooManyRequests
+}
+
+// Misconfigured reports whether the error is caused by our own config, in
+// which case every other send will fail too
+func (e *TwilioError) Misconfigured() bool {
+	switch e.Code {
+	case TwilioErrAuthentication, TwilioErrInvalidFrom, TwilioErrFromNotCapable,
+		TwilioErrNotTwilioNumber, TwilioErrMissingServiceID:
+		return true
+	}
+	return false
+}
+
+// TwilioTestFromPhone is the magic number Twilio accepts as a sender with test
+// credentials, see https://www.twilio.com/docs/iam/test-credentials
+const TwilioTestFromPhone = "+15005550006"
+
+// TwilioProvider struct sends messages through Twilio
+type TwilioProvider struct {
+	HTTPClient *http.Client
+	Config     config.Config
+}
+
+// NewTwilioProvider returns a provider using the Twilio credentials in config.
+// In test mode it uses the test credentials and magic from number instead, so
+// Twilio validates every request without delivering or billing anything.
+func NewTwilioProvider(config config.Config, httpClient *http.Client) *TwilioProvider {
+	if config.TwillioTestMode {
+		config.TwillioAccountSID = config.TwillioTestAccountSID
+		config.TwillioAuthToken = config.TwillioTestAuthToken
+		config.TwillioFromPhone = TwilioTestFromPhone
+		config.TwillioFromPhones = nil
+		config.TwillioMessagingServiceSID = ""
+		config.TwillioStatusCallbackURL = ""
+		config.AlphanumericSenderIDs = nil
+	}
+	return &TwilioProvider{HTTPClient: httpClient, Config: config}
+}
+
+// SendSMS sends a message using the messaging service if one is configured
+// and the from number otherwise
+func (s *TwilioProvider) SendSMS(ctx context.Context, to string, body string) (string, error) {
+	return s.send(ctx, to, body, "")
+}
+
+// SendMMS sends a message with an image attached
+func (s *TwilioProvider) SendMMS(ctx context.Context, to string, body string, mediaURL string) (string, error) {
+	return s.send(ctx, to, body, mediaURL)
+}
+
+// send posts the message to Twilio, canceled with ctx like every other
+// request so a run's deadline bounds it
+func (s *TwilioProvider) send(ctx context.Context, to string, body string, mediaURL string) (string, error) {
+	form := url.Values{"To": {to}, "Body": {body}}
+	from := s.fromPhoneFor(to)
+	serviceSID := s.Config.TwillioMessagingServiceSID
+	if senderID := s.senderIDFor(to); senderID != "" && serviceSID == "" {
+		// Carriers don't accept MMS from alphanumeric senders
+		from = senderID
+		mediaURL = ""
+	}
+	if serviceSID != "" {
+		form.Set("MessagingServiceSid", serviceSID)
+	} else {
+		form.Set("From", from)
+	}
+	if mediaURL != "" {
+		form.Set("MediaUrl", mediaURL)
+	}
+	if s.Config.TwillioStatusCallbackURL != "" {
+		form.Set("StatusCallback", s.Config.TwillioStatusCallbackURL)
+	}
+
+	var resp twilioMessage
+	if err := s.twilioRequest(ctx, "POST", "/Accounts/"+s.Config.TwillioAccountSID+"/Messages.json", form, &resp); err != nil {
+		return "", err
+	}
+	return resp.Sid, nil
+}
+
+// fromPhoneFor picks the number to send from. With a pool configured, each
+// recipient is pinned to one number of the pool so the load is spread evenly
+// while users keep seeing the same sender.
+func (s *TwilioProvider) fromPhoneFor(to string) string {
+	pool := s.Config.TwillioFromPhones
+	if len(pool) == 0 {
+		return s.Config.TwillioFromPhone
+	}
+	h := fnv.New32a()
+	h.Write([]byte(to))
+	return pool[h.Sum32()%uint32(len(pool))]
+}
+
+// senderIDFor returns the alphanumeric sender ID configured for the country
+// calling code of an E.164 number, preferring the longest matching code
+func (s *TwilioProvider) senderIDFor(to string) string {
+	digits := strings.TrimPrefix(to, "+")
+	senderID := ""
+	longest := 0
+	for code, id := range s.Config.AlphanumericSenderIDs {
+		if strings.HasPrefix(digits, code) && len(code) > longest {
+			senderID = id
+			longest = len(code)
+		}
+	}
+	return senderID
+}
+
+// ScheduleMMS hands a message to Twilio to send at sendAt. Twilio only
+// schedules messages sent through a messaging service.
+func (s *TwilioProvider) ScheduleMMS(ctx context.Context, to string, body string, mediaURL string, sendAt time.Time) (string, error) {
+	if s.Config.TwillioMessagingServiceSID == "" {
+		return "", ErrSchedulingUnsupported
+	}
+	form := url.Values{
+		"MessagingServiceSid": {s.Config.TwillioMessagingServiceSID},
+		"To":                  {to},
+		"Body":                {body},
+		"ScheduleType":        {"fixed"},
+		"SendAt":              {sendAt.UTC().Format(time.RFC3339)},
+	}
+	if mediaURL != "" {
+		form.Set("MediaUrl", mediaURL)
+	}
+	if s.Config.TwillioStatusCallbackURL != "" {
+		form.Set("StatusCallback", s.Config.TwillioStatusCallbackURL)
+	}
+
+	var resp twilioMessage
+	err := s.twilioRequest(ctx, "POST", "/Accounts/"+s.Config.TwillioAccountSID+"/Messages.json", form, &resp)
+	if err != nil {
+		return "", err
+	}
+	return resp.Sid, nil
+}
+
+// Verify checks the credentials and from numbers against the Twilio account.
+// Test credentials can't read the account, so nothing is checked in test
+// mode.
+func (s *TwilioProvider) Verify(ctx context.Context) error {
+	if s.Config.TwillioTestMode {
+		return nil
+	}
+	numbers := s.Config.TwillioFromPhones
+	if len(numbers) == 0 && s.Config.TwillioFromPhone != "" {
+		numbers = []string{s.Config.TwillioFromPhone}
+	}
+	if s.Config.TwillioMessagingServiceSID != "" || len(numbers) == 0 {
+		var account struct {
+			Status string `json:"status"`
+		}
+		err := s.twilioRequest(ctx, "GET", "/Accounts/"+s.Config.TwillioAccountSID+".json", nil, &account)
+		if err != nil {
+			return err
+		}
+		if account.Status != "active" {
+			return fmt.Errorf("Twilio account is %s", account.Status)
+		}
+		return nil
+	}
+
+	for _, number := range numbers {
+		var resp struct {
+			IncomingPhoneNumbers []struct {
+				PhoneNumber string `json:"phone_number"`
+			} `json:"incoming_phone_numbers"`
+		}
+		path := "/Accounts/" + s.Config.TwillioAccountSID + "/IncomingPhoneNumbers.json?PhoneNumber=" + url.QueryEscape(number)
+		if err := s.twilioRequest(ctx, "GET", path, nil, &resp); err != nil {
+			return err
+		}
+		if len(resp.IncomingPhoneNumbers) == 0 {
+			return fmt.Errorf("From number %s is not a number on this Twilio account", number)
+		}
+	}
+	return nil
+}
+
+// twilioRequest makes a request to the Twilio API, canceled with ctx, and
+// decodes the response into v, or returns a *TwilioError for an error response
+func (s *TwilioProvider) twilioRequest(ctx context.Context, method string, path string, form url.Values, v interface{}) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, "https://api.twilio.com/2010-04-01"+path, body)
+	if err != nil {
+		return err
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	req.SetBasicAuth(s.Config.TwillioAccountSID, s.Config.TwillioAuthToken)
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		var exception twilioException
+		if err := json.Unmarshal(data, &exception); err != nil {
+			return fmt.Errorf("%s", data)
+		}
+		if exception.Status == 0 {
+			exception.Status = resp.StatusCode
+		}
+		return &TwilioError{Status: exception.Status, Code: exception.Code, Message: exception.Message}
+	}
+	return json.Unmarshal(data, v)
+}
+
+// validTwilioSignature checks the X-Twilio-Signature header of a webhook
+// request posted to url, as described at
+// https://www.twilio.com/docs/usage/security#validating-requests
+func validTwilioSignature(r *http.Request, authToken string, url string) bool {
+	keys := make([]string, 0, len(r.PostForm))
+	for key := range r.PostForm {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	data := url
+	for _, key := range keys {
+		data += key + r.PostForm.Get(key)
+	}
+
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(data))
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Twilio-Signature")))
+}
@@ -0,0 +1,120 @@
+package notify
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+	"github.com/johnwcallahan/forecast-discussion-alerts/notifier"
+)
+
+// Default Twilio prices in USD for US numbers, see
+// https://www.twilio.com/en-us/sms/pricing/us
+const (
+	DefaultSegmentCost = 0.0079
+	DefaultMMSCost     = 0.0200
+)
+
+// CountSegments returns the number of SMS segments a body is billed as
+func CountSegments(body string) int {
+	return notifier.CountSegments(body)
+}
+
+// Usage struct counts what was sent to a recipient
+type Usage struct {
+	Messages int
+	Segments int
+	MMS      int
+}
+
+// UsageTracker struct tracks messages sent during a run so the cost can be
+// estimated
+type UsageTracker struct {
+	SegmentCost float64
+	MMSCost     float64
+
+	mu    sync.Mutex
+	users map[string]*Usage
+}
+
+// NewUsageTracker returns a tracker using the prices in config
+func NewUsageTracker(config config.Config) *UsageTracker {
+	tracker := &UsageTracker{
+		SegmentCost: DefaultSegmentCost,
+		MMSCost:     DefaultMMSCost,
+		users:       make(map[string]*Usage),
+	}
+	if config.SegmentCost > 0 {
+		tracker.SegmentCost = config.SegmentCost
+	}
+	if config.MMSCost > 0 {
+		tracker.MMSCost = config.MMSCost
+	}
+	return tracker
+}
+
+// Record counts a message sent to a recipient. MMS are billed per message
+// rather than per segment.
+func (s *UsageTracker) Record(to string, body string, mms bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	usage, ok := s.users[to]
+	if !ok {
+		usage = &Usage{}
+		s.users[to] = usage
+	}
+	usage.Messages++
+	if mms {
+		usage.MMS++
+	} else {
+		usage.Segments += CountSegments(body)
+	}
+}
+
+// Users returns the usage of every recipient
+func (s *UsageTracker) Users() map[string]Usage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users := make(map[string]Usage, len(s.users))
+	for to, usage := range s.users {
+		users[to] = *usage
+	}
+	return users
+}
+
+// Totals returns the usage across all recipients
+func (s *UsageTracker) Totals() Usage {
+	var total Usage
+	for _, usage := range s.Users() {
+		total.Messages += usage.Messages
+		total.Segments += usage.Segments
+		total.MMS += usage.MMS
+	}
+	return total
+}
+
+// Cost estimates the price of some usage in USD
+func (s *UsageTracker) Cost(usage Usage) float64 {
+	return float64(usage.Segments)*s.SegmentCost + float64(usage.MMS)*s.MMSCost
+}
+
+// Summary describes the usage of the run, one line per recipient
+func (s *UsageTracker) Summary() string {
+	users := s.Users()
+	recipients := make([]string, 0, len(users))
+	for to := range users {
+		recipients = append(recipients, to)
+	}
+	sort.Strings(recipients)
+
+	var b strings.Builder
+	for _, to := range recipients {
+		usage := users[to]
+		fmt.Fprintf(&b, "%s: %d messages, %d segments, %d MMS, $%.4f\n", to, usage.Messages, usage.Segments, usage.MMS, s.Cost(usage))
+	}
+	total := s.Totals()
+	fmt.Fprintf(&b, "Total: %d messages, %d segments, %d MMS, $%.4f\n", total.Messages, total.Segments, total.MMS, s.Cost(total))
+	return b.String()
+}
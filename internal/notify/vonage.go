@@ -0,0 +1,121 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+	"github.com/johnwcallahan/forecast-discussion-alerts/notifier"
+)
+
+// Vonage status codes, see https://developer.vonage.com/en/messaging/sms/guides/troubleshooting-sms
+const (
+	vonageStatusThrottled     = "1"
+	vonageStatusInternalError = "5"
+	vonageStatusInvalidCreds  = "4"
+	vonageStatusBarred        = "7"
+	vonageStatusPartnerQuota  = "9"
+)
+
+// VonageProvider struct sends messages through the Vonage SMS API
+type VonageProvider struct {
+	Config     config.Vonage
+	BaseURI    string
+	HTTPClient *http.Client
+}
+
+// NewVonageProvider returns a provider with default params
+func NewVonageProvider(config config.Vonage, httpClient *http.Client) *VonageProvider {
+	return &VonageProvider{
+		Config:     config,
+		BaseURI:    "https://rest.nexmo.com",
+		HTTPClient: httpClient,
+	}
+}
+
+// VonageError struct is a rejected message from the Vonage API
+type VonageError struct {
+	Status  string
+	Message string
+}
+
+func (e *VonageError) Error() string {
+	return fmt.Sprintf("Vonage error %s: %s", e.Status, e.Message)
+}
+
+// Is lets errors.Is match ErrUnsubscribed
+func (e *VonageError) Is(target error) bool {
+	return target == ErrUnsubscribed && e.Status == vonageStatusBarred
+}
+
+// Temporary reports whether the request may succeed if retried
+func (e *VonageError) Temporary() bool {
+	return e.Status == vonageStatusThrottled || e.Status == vonageStatusInternalError
+}
+
+// Misconfigured reports whether the error is caused by our own config
+func (e *VonageError) Misconfigured() bool {
+	return e.Status == vonageStatusInvalidCreds || e.Status == vonageStatusPartnerQuota
+}
+
+// SendSMS sends a message from the configured sender
+func (s *VonageProvider) SendSMS(ctx context.Context, to string, body string) (string, error) {
+	// Unicode messages are billed in 70-character segments, so only use
+	// them when the body needs it
+	encoding := "text"
+	if !notifier.IsGSM7(body) {
+		encoding = "unicode"
+	}
+	form := url.Values{
+		"api_key":    {s.Config.APIKey},
+		"api_secret": {s.Config.APISecret},
+		"from":       {s.Config.From},
+		"to":         {strings.TrimPrefix(to, "+")},
+		"text":       {body},
+		"type":       {encoding},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.BaseURI+"/sms/json", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("%s", data)
+	}
+
+	var result struct {
+		Messages []struct {
+			MessageID string `json:"message-id"`
+			Status    string `json:"status"`
+			ErrorText string `json:"error-text"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", err
+	}
+	if len(result.Messages) == 0 {
+		return "", fmt.Errorf("Vonage returned no messages: %s", data)
+	}
+
+	// Long messages are split into several, all of which must be accepted
+	for _, message := range result.Messages {
+		if message.Status != "0" {
+			return "", &VonageError{Status: message.Status, Message: message.ErrorText}
+		}
+	}
+	return result.Messages[0].MessageID, nil
+}
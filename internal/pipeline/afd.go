@@ -0,0 +1,65 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/afd"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+	"github.com/johnwcallahan/forecast-discussion-alerts/nws"
+)
+
+// AFDSourceName is the Source of documents from AFDSource
+const AFDSourceName = "afd"
+
+// AFDSource struct fetches the latest AFD for each user's office
+type AFDSource struct {
+	Fetcher nws.AFDFetcher
+	// Timeout bounds each fetch, if set
+	Timeout time.Duration
+}
+
+// Fetch fetches the user's office's AFD
+func (s *AFDSource) Fetch(ctx context.Context, user config.User) (*Document, error) {
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+	product, err := s.Fetcher.GetAFD(ctx, user.LocationID)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't fetch the %s discussion: %w", strings.ToUpper(user.LocationID), err)
+	}
+	return &Document{
+		Source:   AFDSourceName,
+		ID:       product.ID,
+		Location: strings.ToUpper(user.LocationID),
+		Issued:   product.IssuanceTime,
+		Data:     product,
+	}, nil
+}
+
+// AFDParser struct picks the user's subscribed sections, and any keyword
+// alert, out of an AFD
+type AFDParser struct {
+	Config config.Config
+}
+
+// Parse returns the sections in the order the user subscribed to them, then
+// the keyword alert
+func (s *AFDParser) Parse(ctx context.Context, user config.User, doc *Document) ([]Section, error) {
+	product, ok := doc.Data.(*nws.Product)
+	if !ok {
+		return nil, fmt.Errorf("AFD parser can't parse a %s document", doc.Source)
+	}
+	texts, err := afd.SubscribedSections(product, user, s.Config)
+	var sections []Section
+	for _, name := range afd.SectionOrder(user) {
+		if text, ok := texts[name]; ok {
+			sections = append(sections, Section{Name: name, Text: text})
+		}
+	}
+	return sections, err
+}
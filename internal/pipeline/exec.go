@@ -0,0 +1,203 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+)
+
+// ExecPluginType is the type of sources and sinks that run a command, so
+// they can be written in any language without changing this program
+const ExecPluginType = "exec"
+
+// DefaultPluginTimeout bounds each call to a plugin whose config doesn't set
+// timeoutSeconds
+const DefaultPluginTimeout = 30 * time.Second
+
+func init() {
+	RegisterSource(ExecPluginType, func(env PluginEnv) (Source, Parser, error) {
+		command, err := newExecCommand(env.Plugin)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &ExecSource{Name: strings.TrimPrefix(env.Name, "sources."), Command: command}, ExecParser{}, nil
+	})
+	RegisterSink(ExecPluginType, func(env PluginEnv) (Sink, error) {
+		command, err := newExecCommand(env.Plugin)
+		if err != nil {
+			return nil, err
+		}
+		return &ExecSink{Command: command}, nil
+	})
+}
+
+// ExecCommand struct is a plugin's command line. The plugin is given a JSON
+// request on stdin and its settings in its environment.
+type ExecCommand struct {
+	Args     []string
+	Settings map[string]string
+	Timeout  time.Duration
+}
+
+func newExecCommand(plugin config.Plugin) (ExecCommand, error) {
+	if len(plugin.Command) == 0 || plugin.Command[0] == "" {
+		return ExecCommand{}, errors.New("command is required for exec plugins")
+	}
+	if _, err := exec.LookPath(plugin.Command[0]); err != nil {
+		return ExecCommand{}, err
+	}
+	command := ExecCommand{Args: plugin.Command, Settings: plugin.Settings, Timeout: DefaultPluginTimeout}
+	if plugin.TimeoutSeconds > 0 {
+		command.Timeout = time.Duration(plugin.TimeoutSeconds) * time.Second
+	}
+	return command, nil
+}
+
+// Run sends the command request as JSON and decodes its output, if any, into
+// response. A command that exits non-zero fails with what it wrote to stderr.
+func (s ExecCommand) Run(ctx context.Context, request interface{}, response interface{}) error {
+	input, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, s.Args[0], s.Args[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Env = os.Environ()
+	for key, value := range s.Settings {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return fmt.Errorf("%s failed: %v: %s", filepath.Base(s.Args[0]), err, message)
+		}
+		return fmt.Errorf("%s failed: %v", filepath.Base(s.Args[0]), err)
+	}
+	if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(stdout.Bytes(), response); err != nil {
+		return fmt.Errorf("%s wrote invalid output: %v", filepath.Base(s.Args[0]), err)
+	}
+	return nil
+}
+
+// execDocument is the document an exec source writes, e.g.
+// {"id": "...", "location": "OAX", "issued": "2024-10-15T12:00:00Z",
+// "sections": [{"name": "RIVERS", "text": "..."}], "missing": ["LAKES"]}
+type execDocument struct {
+	ID       string        `json:"id"`
+	Location string        `json:"location"`
+	Issued   time.Time     `json:"issued"`
+	Sections []execSection `json:"sections"`
+	// Missing are subscribed sections the document doesn't have
+	Missing []string `json:"missing"`
+}
+
+type execSection struct {
+	Name string `json:"name"`
+	Text string `json:"text"`
+}
+
+// ExecSource struct fetches documents by running a command with
+// {"user": {...}} on stdin. The command writes the user's sections, in the
+// order to send them.
+type ExecSource struct {
+	// Name is the source's key in the config
+	Name    string
+	Command ExecCommand
+}
+
+// Fetch runs the command for the user
+func (s *ExecSource) Fetch(ctx context.Context, user config.User) (*Document, error) {
+	var doc execDocument
+	if err := s.Command.Run(ctx, map[string]interface{}{"user": user}, &doc); err != nil {
+		return nil, fmt.Errorf("Couldn't fetch from %s: %w", s.Name, err)
+	}
+	if doc.Location == "" {
+		doc.Location = strings.ToUpper(user.LocationID)
+	}
+	return &Document{Source: s.Name, ID: doc.ID, Location: doc.Location, Issued: doc.Issued, Data: &doc}, nil
+}
+
+// ExecParser struct returns the sections an exec source wrote, as the source
+// picked them for the user already
+type ExecParser struct{}
+
+// Parse returns the document's sections, and an error for each missing one
+func (s ExecParser) Parse(ctx context.Context, user config.User, doc *Document) ([]Section, error) {
+	data, ok := doc.Data.(*execDocument)
+	if !ok {
+		return nil, fmt.Errorf("Exec parser can't parse a %s document", doc.Source)
+	}
+	var sections []Section
+	for _, section := range data.Sections {
+		if strings.TrimSpace(section.Text) != "" {
+			sections = append(sections, Section{Name: strings.ToUpper(section.Name), Text: section.Text})
+		}
+	}
+	var errs []error
+	for _, name := range data.Missing {
+		errs = append(errs, fmt.Errorf("%w: %s has no %s in %s", ErrSectionMissing, doc.Location, strings.ToUpper(name), doc.ID))
+	}
+	return sections, errors.Join(errs...)
+}
+
+// ExecSink struct delivers messages by running a command with
+// {"user": {...}, "document": {...}, "messages": [{"name": "...",
+// "text": "..."}]} on stdin. The command may write {"ids": [...]}, one per
+// message, with the IDs its channel assigned.
+type ExecSink struct {
+	Command ExecCommand
+}
+
+// Name returns the command's name
+func (s *ExecSink) Name() string {
+	return filepath.Base(s.Command.Args[0])
+}
+
+// Deliver runs the command once with all the messages. If it fails, every
+// message is recorded as failed.
+func (s *ExecSink) Deliver(ctx context.Context, user config.User, doc *Document, messages []Message) ([]Delivery, error) {
+	request := map[string]interface{}{
+		"user": user,
+		"document": map[string]interface{}{
+			"source":   doc.Source,
+			"id":       doc.ID,
+			"location": doc.Location,
+			"issued":   doc.Issued,
+		},
+	}
+	sections := make([]execSection, len(messages))
+	for i, message := range messages {
+		sections[i] = execSection{Name: message.Section.Name, Text: message.Text}
+	}
+	request["messages"] = sections
+
+	var response struct {
+		IDs []string `json:"ids"`
+	}
+	err := s.Command.Run(ctx, request, &response)
+	deliveries := make([]Delivery, len(messages))
+	for i, message := range messages {
+		deliveries[i] = Delivery{Sink: s.Name(), Section: message.Section.Name, Text: message.Text, Err: err}
+		if err == nil && i < len(response.IDs) {
+			deliveries[i].ID = response.IDs[i]
+		}
+	}
+	return deliveries, nil
+}
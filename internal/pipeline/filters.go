@@ -0,0 +1,142 @@
+package pipeline
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/afd"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/store"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/telemetry"
+	"github.com/johnwcallahan/forecast-discussion-alerts/nws"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ProductFilter struct drops every message from a document already sent to
+// the user, so polling more often than products are issued doesn't send the
+// same one again. The runner records a document once it's delivered.
+type ProductFilter struct {
+	Products *store.SentProducts
+}
+
+// Filter drops the messages if the user was last sent this document
+func (s *ProductFilter) Filter(ctx context.Context, user config.User, doc *Document, messages []Message) []Message {
+	if doc.ID != "" && s.Products.Last(user.Phone, doc.Key()) == doc.ID {
+		return nil
+	}
+	return messages
+}
+
+// HistoryFilter struct drops sections unchanged since they were last sent to
+// the user, and marks or keeps only what changed in the rest as Mode says
+type HistoryFilter struct {
+	History *store.SentHistory
+	Mode    string
+}
+
+// Filter diffs each message against the user's sent history
+func (s *HistoryFilter) Filter(ctx context.Context, user config.User, doc *Document, messages []Message) []Message {
+	var kept []Message
+	for _, message := range messages {
+		if last, ok := s.History.Last(user.Phone, message.Section.Text); ok {
+			var changed bool
+			if message.Text, changed = afd.DiffSection(last, message.Text, s.Mode); !changed {
+				continue
+			}
+		}
+		kept = append(kept, message)
+	}
+	return kept
+}
+
+// AbbreviationFilter expands the forecasters' abbreviations in each
+// message's text, leaving the header alone
+var AbbreviationFilter = FilterFunc(func(ctx context.Context, user config.User, doc *Document, messages []Message) []Message {
+	for i, message := range messages {
+		header, body := nws.SplitSectionHeader(message.Text)
+		messages[i].Text = header + nws.ExpandAbbreviations(body)
+	}
+	return messages
+})
+
+// SummaryFilter struct shortens long sections with a summarizer. Sections
+// that can't be summarized are sent in full.
+type SummaryFilter struct {
+	Summarizer afd.Summarizer
+	// Sections and MaxLength are as in config.Summarizer
+	Sections  []string
+	MaxLength int
+	Timeout   time.Duration
+	Logger    *slog.Logger
+}
+
+// Filter summarizes each message that's long enough
+func (s *SummaryFilter) Filter(ctx context.Context, user config.User, doc *Document, messages []Message) []Message {
+	for i, message := range messages {
+		summarizeCtx, span := telemetry.Tracer.Start(ctx, "summarize")
+		summarizeCtx, cancel := context.WithTimeout(summarizeCtx, s.Timeout)
+		text, summarized, err := afd.SummarizeSection(summarizeCtx, s.Summarizer, message.Text, s.Sections, s.MaxLength)
+		cancel()
+		telemetry.EndSpan(span, err)
+		if err != nil {
+			s.Logger.Warn("Couldn't summarize section", "user", user.ID, "office", user.LocationID, "err", err)
+			continue
+		}
+		messages[i].Text = text
+		messages[i].Summarized = messages[i].Summarized || summarized
+	}
+	return messages
+}
+
+// TranslateFilter struct translates messages into the user's language.
+// Messages that can't be translated are sent in English.
+type TranslateFilter struct {
+	Translator afd.Translator
+	Timeout    time.Duration
+	Logger     *slog.Logger
+}
+
+// Filter translates each message
+func (s *TranslateFilter) Filter(ctx context.Context, user config.User, doc *Document, messages []Message) []Message {
+	for i, message := range messages {
+		translateCtx, span := telemetry.Tracer.Start(ctx, "translate", trace.WithAttributes(attribute.String("language", user.Language)))
+		translateCtx, cancel := context.WithTimeout(translateCtx, s.Timeout)
+		translated, err := afd.TranslateMessage(translateCtx, s.Translator, message.Text, user.Language)
+		cancel()
+		telemetry.EndSpan(span, err)
+		if err != nil {
+			s.Logger.Warn("Couldn't translate section, sending it in English",
+				"user", user.ID, "office", user.LocationID, "language", user.Language, "err", err)
+			continue
+		}
+		messages[i].Text = translated
+	}
+	return messages
+}
+
+// LinkFilter struct links summarized messages to the full text and, if
+// AppendAFDLink is set, the last message to the full discussion. Messages
+// from other sources have no AFD to link to.
+type LinkFilter struct {
+	Linker        *afd.AFDLinker
+	AppendAFDLink bool
+}
+
+// Filter appends the links
+func (s *LinkFilter) Filter(ctx context.Context, user config.User, doc *Document, messages []Message) []Message {
+	if doc.Source != AFDSourceName {
+		return messages
+	}
+	for i, message := range messages {
+		if message.Summarized {
+			messages[i].Text += "\n\nFull text: " + s.Linker.Link(user.LocationID)
+		}
+	}
+	if s.AppendAFDLink && len(messages) > 0 {
+		last := len(messages) - 1
+		messages[last].Text += "\n\nFull discussion: " + s.Linker.Link(user.LocationID)
+	}
+	return messages
+}
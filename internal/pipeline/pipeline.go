@@ -0,0 +1,194 @@
+// Package pipeline sends a user what's new for them in stages: a Source
+// fetches a document, a Parser picks out the sections the user subscribed
+// to, Filters turn them into messages and Sinks deliver those.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/afd"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+)
+
+// ErrSectionMissing is wrapped by a Parser's errors for subscribed sections
+// the document doesn't have. Missing sections don't stop the others being
+// sent. It's afd's error, so the AFD parser's errors match it as they are.
+var ErrSectionMissing = afd.ErrSectionMissing
+
+// Document struct is what a Source fetched for a user
+type Document struct {
+	// Source names the source, e.g. "afd"
+	Source   string
+	ID       string
+	Location string
+	Issued   time.Time
+	// Data is the source's own representation, e.g. an *nws.Product, for
+	// its Parser
+	Data interface{}
+}
+
+// Key identifies where the document came from, e.g. "afd/BOX", for
+// remembering which of its documents were sent
+func (s *Document) Key() string {
+	return s.Source + "/" + s.Location
+}
+
+// Section struct is a part of a document the user subscribed to
+type Section struct {
+	// Name identifies the section in the document, e.g. "SYNOPSIS"
+	Name string
+	Text string
+}
+
+// Message struct is a section on its way to being delivered
+type Message struct {
+	Section Section
+	Text    string
+	// Summarized is set by a filter that shortened Text
+	Summarized bool
+}
+
+// Delivery struct is the result of delivering one message, or one part of
+// it, through a sink
+type Delivery struct {
+	Sink    string
+	Section string
+	Text    string
+	// ID is the one the sink's provider assigned, if any
+	ID        string
+	Scheduled bool
+	Err       error
+}
+
+// Source fetches the document a user's messages come from
+type Source interface {
+	Fetch(ctx context.Context, user config.User) (*Document, error)
+}
+
+// Parser picks the sections a user subscribed to out of a document, in the
+// order they're sent. Sections it can't find are returned as errors wrapping
+// ErrSectionMissing, joined, along with the ones it found.
+type Parser interface {
+	Parse(ctx context.Context, user config.User, doc *Document) ([]Section, error)
+}
+
+// Filter changes, adds or drops messages before they're delivered. Errors
+// that should stop the messages being sent are the filter's to handle; a
+// filter that can't do its work passes the messages on unchanged.
+type Filter interface {
+	Filter(ctx context.Context, user config.User, doc *Document, messages []Message) []Message
+}
+
+// FilterFunc adapts a function to a Filter
+type FilterFunc func(ctx context.Context, user config.User, doc *Document, messages []Message) []Message
+
+// Filter calls s
+func (s FilterFunc) Filter(ctx context.Context, user config.User, doc *Document, messages []Message) []Message {
+	return s(ctx, user, doc, messages)
+}
+
+// Sink delivers a user's messages. Failures to deliver are recorded in the
+// deliveries; an error is returned only if nothing more can be delivered
+// through the sink, e.g. because it's misconfigured.
+type Sink interface {
+	Name() string
+	Deliver(ctx context.Context, user config.User, doc *Document, messages []Message) ([]Delivery, error)
+}
+
+// Pipeline struct combines a source and parser with the filters and sinks
+// their messages go through
+type Pipeline struct {
+	Source  Source
+	Parser  Parser
+	Filters []Filter
+	Sinks   []Sink
+	// Guard, if set, is called before each sink delivers, and an error from
+	// it stops anything more being delivered, e.g. once the instance is no
+	// longer the leader
+	Guard func() error
+}
+
+// Result struct is what a pipeline did for a user
+type Result struct {
+	Document *Document
+	// Messages are those left after filtering, as delivered to each sink
+	Messages   []Message
+	Deliveries []Delivery
+	// Warnings are problems that didn't stop the rest being delivered, e.g.
+	// missing sections
+	Warnings []error
+}
+
+// Run sends a user's messages from the source through every sink. It
+// returns an error, with the result so far, if the document couldn't be
+// fetched or parsed, a sink failed as a whole or the Guard stopped it.
+func (s *Pipeline) Run(ctx context.Context, user config.User) (*Result, error) {
+	result := &Result{}
+	doc, err := s.Source.Fetch(ctx, user)
+	if err != nil {
+		return result, err
+	}
+	result.Document = doc
+
+	sections, err := s.Parser.Parse(ctx, user, doc)
+	if err != nil && !errors.Is(err, ErrSectionMissing) {
+		return result, err
+	}
+	if err != nil {
+		result.Warnings = unjoin(err)
+	}
+
+	messages := make([]Message, 0, len(sections))
+	for _, section := range sections {
+		messages = append(messages, Message{Section: section, Text: section.Text})
+	}
+	for _, filter := range s.Filters {
+		messages = filter.Filter(ctx, user, doc, messages)
+	}
+	result.Messages = messages
+	if len(messages) == 0 {
+		return result, nil
+	}
+
+	for _, sink := range s.Sinks {
+		if s.Guard != nil {
+			if err := s.Guard(); err != nil {
+				return result, err
+			}
+		}
+		deliveries, err := sink.Deliver(ctx, user, doc, messages)
+		result.Deliveries = append(result.Deliveries, deliveries...)
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// Delivered returns the sections whose every delivery succeeded, in the
+// order they were delivered
+func (s *Result) Delivered() []Section {
+	var sections []Section
+	failed := make(map[string]bool)
+	for _, delivery := range s.Deliveries {
+		if delivery.Err != nil {
+			failed[delivery.Section] = true
+		}
+	}
+	for _, message := range s.Messages {
+		if !failed[message.Section.Name] {
+			sections = append(sections, message.Section)
+		}
+	}
+	return sections
+}
+
+// unjoin splits an error made with errors.Join into the errors joined
+func unjoin(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
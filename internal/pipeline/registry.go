@@ -0,0 +1,114 @@
+package pipeline
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+)
+
+// PluginEnv struct is what a factory builds a source or sink from
+type PluginEnv struct {
+	// Name identifies the plugin in errors, e.g. "sources.river" or
+	// "sinks[0]"
+	Name       string
+	Plugin     config.Plugin
+	Config     config.Config
+	HTTPClient *http.Client
+	Logger     *slog.Logger
+}
+
+// SourceFactory builds a source, and the parser for its documents, from its
+// config
+type SourceFactory func(env PluginEnv) (Source, Parser, error)
+
+// SinkFactory builds a sink from its config
+type SinkFactory func(env PluginEnv) (Sink, error)
+
+var (
+	registryMu sync.Mutex
+	sources    = make(map[string]SourceFactory)
+	sinks      = make(map[string]SinkFactory)
+)
+
+// RegisterSource makes a source type available to the config's sources,
+// usually from an init function. It panics if the type is registered twice.
+func RegisterSource(sourceType string, factory SourceFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	sourceType = strings.ToLower(sourceType)
+	if _, ok := sources[sourceType]; ok {
+		panic("pipeline: source type " + sourceType + " registered twice")
+	}
+	sources[sourceType] = factory
+}
+
+// RegisterSink makes a sink type available to the config's sinks, usually
+// from an init function. It panics if the type is registered twice.
+func RegisterSink(sinkType string, factory SinkFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	sinkType = strings.ToLower(sinkType)
+	if _, ok := sinks[sinkType]; ok {
+		panic("pipeline: sink type " + sinkType + " registered twice")
+	}
+	sinks[sinkType] = factory
+}
+
+// NewSource builds the source env.Plugin configures
+func NewSource(env PluginEnv) (Source, Parser, error) {
+	registryMu.Lock()
+	factory, ok := sources[strings.ToLower(env.Plugin.Type)]
+	registryMu.Unlock()
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: unknown type %q, expected one of %q", env.Name, env.Plugin.Type, SourceTypes())
+	}
+	source, parser, err := factory(env)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", env.Name, err)
+	}
+	return source, parser, nil
+}
+
+// NewSink builds the sink env.Plugin configures
+func NewSink(env PluginEnv) (Sink, error) {
+	registryMu.Lock()
+	factory, ok := sinks[strings.ToLower(env.Plugin.Type)]
+	registryMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown type %q, expected one of %q", env.Name, env.Plugin.Type, SinkTypes())
+	}
+	sink, err := factory(env)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", env.Name, err)
+	}
+	return sink, nil
+}
+
+// SourceTypes returns the registered source types, sorted
+func SourceTypes() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	types := make([]string, 0, len(sources))
+	for sourceType := range sources {
+		types = append(types, sourceType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// SinkTypes returns the registered sink types, sorted
+func SinkTypes() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	types := make([]string, 0, len(sinks))
+	for sinkType := range sinks {
+		types = append(types, sinkType)
+	}
+	sort.Strings(types)
+	return types
+}
@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/afd"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/notify"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SMSSink struct texts each message to the user, split to fit in an SMS. In
+// the user's quiet hours messages are scheduled for the end of them, if the
+// provider can, and sent now otherwise.
+type SMSSink struct {
+	Sender notify.Sender
+	// Channel names the provider in traces, e.g. "twilio"
+	Channel string
+	// Tracker, if set, follows the delivery of each message sent
+	Tracker *notify.DeliveryTracker
+	Logger  *slog.Logger
+	// Now tells the time for quiet hours, time.Now if nil
+	Now func() time.Time
+}
+
+// Name returns the channel
+func (s *SMSSink) Name() string {
+	return s.Channel
+}
+
+// Deliver sends or schedules each part of each message. It returns an error
+// if the provider is misconfigured, as every send would fail.
+func (s *SMSSink) Deliver(ctx context.Context, user config.User, doc *Document, messages []Message) ([]Delivery, error) {
+	mediaURL := notify.MediaURL(user)
+	now := time.Now()
+	if s.Now != nil {
+		now = s.Now()
+	}
+	quietUntil, quiet := user.QuietUntil(now)
+	var deliveries []Delivery
+	for _, message := range messages {
+		for _, part := range afd.SplitSection(message.Text, notify.MaxSMSLength) {
+			delivery := Delivery{Sink: s.Name(), Section: message.Section.Name, Text: part}
+			if quiet {
+				delivery.ID, delivery.Err = s.Sender.Schedule(ctx, user.Phone, part, mediaURL, quietUntil)
+				if delivery.Err == nil {
+					delivery.Scheduled = true
+					deliveries = append(deliveries, delivery)
+					mediaURL = ""
+					continue
+				}
+				if !errors.Is(delivery.Err, notify.ErrSchedulingUnsupported) {
+					s.Logger.Error("Couldn't schedule message", "user", user.ID, "office", user.LocationID, "err", delivery.Err)
+					deliveries = append(deliveries, delivery)
+					continue
+				}
+				// Without scheduling, send now as before
+			}
+
+			sendCtx, span := telemetry.Tracer.Start(ctx, "send", trace.WithAttributes(
+				attribute.String("channel", s.Channel),
+				attribute.Int("segments", notify.CountSegments(part)),
+			))
+			delivery.ID, delivery.Err = s.Sender.SendMMS(sendCtx, user.Phone, part, mediaURL)
+			telemetry.EndSpan(span, delivery.Err)
+			deliveries = append(deliveries, delivery)
+			if notify.IsMisconfigured(delivery.Err) {
+				return deliveries, fmt.Errorf("The SMS provider is misconfigured: %w", delivery.Err)
+			}
+			if delivery.Err != nil {
+				s.Logger.Error("Couldn't send message", "user", user.ID, "office", user.LocationID, "err", delivery.Err)
+				continue
+			}
+			if s.Tracker != nil {
+				s.Tracker.Track(delivery.ID, user.Phone, part, mediaURL, 0)
+			}
+			mediaURL = ""
+		}
+	}
+	return deliveries, nil
+}
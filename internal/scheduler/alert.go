@@ -0,0 +1,113 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/notify"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/telemetry"
+)
+
+// DefaultAdminFailureThreshold is how many failures in a run trigger an
+// admin alert if the threshold isn't configured
+const DefaultAdminFailureThreshold = 3
+
+// DefaultAdminAlertCooldown is the least time between admin alerts, so an
+// outage doesn't page the admin every run
+const DefaultAdminAlertCooldown = time.Hour
+
+// AdminAlerter struct alerts the admin about failing runs. It remembers when
+// it last did so it can be shared by every runner across reloads.
+type AdminAlerter struct {
+	// Now tells the time for the cooldown, time.Now if nil
+	Now func() time.Time
+
+	mu       sync.Mutex
+	lastSent time.Time
+}
+
+// Check alerts the admin in config if report has at least the threshold of
+// failures and the cooldown has passed since the last alert. SMS go through
+// sender, which may be nil if it couldn't be set up.
+func (s *AdminAlerter) Check(ctx context.Context, config config.AdminAlerts, report *RunReport, sender notify.Sender) error {
+	if s == nil || (config.Phone == "" && config.Email == "") {
+		return nil
+	}
+	threshold := config.FailureThreshold
+	if threshold <= 0 {
+		threshold = DefaultAdminFailureThreshold
+	}
+	failures := len(report.Failures) + len(report.FetchFailures)
+	if failures < threshold {
+		return nil
+	}
+
+	cooldown := DefaultAdminAlertCooldown
+	if config.CooldownMinutes > 0 {
+		cooldown = time.Duration(config.CooldownMinutes) * time.Minute
+	}
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now().Sub(s.lastSent) < cooldown {
+		return nil
+	}
+
+	subject := fmt.Sprintf("%s: %d failures in the run at %s", telemetry.ServiceName, failures, report.Started.Format(time.RFC3339))
+	var errs []string
+	alerted := false
+	if config.Phone != "" && sender != nil {
+		body := subject + "\n" + strings.Join(report.failureReasons(3), "\n")
+		if _, err := sender.Send(ctx, config.Phone, body); err != nil {
+			errs = append(errs, "SMS: "+err.Error())
+		} else {
+			alerted = true
+		}
+	}
+	if config.Email != "" {
+		if err := sendAdminEmail(config, subject, report.String()); err != nil {
+			errs = append(errs, "email: "+err.Error())
+		} else {
+			alerted = true
+		}
+	}
+	// The cooldown starts once the admin has been reached one way, so the
+	// channel that works doesn't repeat the alert every run
+	if alerted {
+		s.lastSent = now()
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("Couldn't alert the admin: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func sendAdminEmail(config config.AdminAlerts, subject string, body string) error {
+	if config.SMTPAddr == "" {
+		return fmt.Errorf("adminAlerts.smtpAddr isn't set")
+	}
+	from := config.SMTPFrom
+	if from == "" {
+		from = config.SMTPUsername
+	}
+	var auth smtp.Auth
+	if config.SMTPUsername != "" {
+		host := strings.Split(config.SMTPAddr, ":")[0]
+		auth = smtp.PlainAuth("", config.SMTPUsername, config.SMTPPassword, host)
+	}
+	message := "From: " + from + "\r\n" +
+		"To: " + config.Email + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		strings.Replace(body, "\n", "\r\n", -1)
+	return smtp.SendMail(config.SMTPAddr, auth, from, []string{config.Email}, []byte(message))
+}
@@ -0,0 +1,220 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/notify"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/store"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/telemetry"
+	"github.com/johnwcallahan/forecast-discussion-alerts/nws"
+	"golang.org/x/time/rate"
+)
+
+// NewNWSClientFromConfig returns a client with the settings in config
+// applied
+func NewNWSClientFromConfig(config config.Config, httpClient *http.Client) *nws.Client {
+	client := nws.NewClient(httpClient)
+	if config.NWSBaseURI != "" {
+		client.BaseURI = strings.TrimSuffix(config.NWSBaseURI, "/")
+	}
+	if config.NWSUserAgent != "" {
+		client.UserAgent = config.NWSUserAgent
+	}
+	if config.NWSRequestsPerSecond > 0 {
+		client.Limiter = rate.NewLimiter(rate.Limit(config.NWSRequestsPerSecond), 1)
+	}
+	if config.NWSMaxRetries > 0 {
+		client.MaxRetries = config.NWSMaxRetries
+	}
+	if config.NWSRetryDelayMS > 0 {
+		client.RetryDelay = time.Duration(config.NWSRetryDelayMS) * time.Millisecond
+	}
+	if config.NWSBreakerThreshold > 0 {
+		client.Breaker.Threshold = config.NWSBreakerThreshold
+	}
+	if config.NWSBreakerCooldownSeconds > 0 {
+		client.Breaker.Cooldown = time.Duration(config.NWSBreakerCooldownSeconds) * time.Second
+	}
+	client.Breaker.OnOpen = func(failures int, until time.Time) {
+		slog.Warn("NWS requests are failing, pausing them", "failures", failures, "until", until)
+	}
+	return client
+}
+
+// NWSTimeout bounds how long fetching a user's discussion may take
+const NWSTimeout = 30 * time.Second
+
+// NewHTTPClient returns the client shared by every outgoing request of a run,
+// so connections to the NWS and SMS APIs are pooled and kept alive. Without
+// an HTTPProxy in config, the usual HTTPS_PROXY environment variables apply.
+func NewHTTPClient(config config.Config) (*http.Client, error) {
+	proxy := http.ProxyFromEnvironment
+	if config.HTTPProxy != "" {
+		proxyURL, err := url.Parse(config.HTTPProxy)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid httpProxy: %v", err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+	timeout := 30 * time.Second
+	if config.HTTPTimeoutSeconds > 0 {
+		timeout = time.Duration(config.HTTPTimeoutSeconds) * time.Second
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy: proxy,
+			DialContext: (&net.Dialer{
+				Timeout:   10 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   10,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 20 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+	}, nil
+}
+
+// instrument returns a copy of client that traces its requests and, with
+// debug, logs them to logger. It's a copy so the transports don't pile up on
+// a client kept across reloads.
+func instrument(client *http.Client, debug bool, logger *slog.Logger) *http.Client {
+	instrumented := *client
+	if debug {
+		instrumented.Transport = telemetry.NewDebugTransport(instrumented.Transport, logger)
+	}
+	instrumented.Transport = telemetry.NewTracingTransport(instrumented.Transport)
+	return &instrumented
+}
+
+// LoadConfig loads the config as options say, with its secrets resolved
+// through options.HTTPClient, or a client built from the config, and
+// validates it
+func LoadConfig(ctx context.Context, options RunnerOptions) (config.Config, error) {
+	cfg, err := config.Load(options.ConfigFile, options.Profile, options.Overrides)
+	if err != nil {
+		return cfg, err
+	}
+	if options.Debug {
+		cfg.LogLevel = "debug"
+	}
+	httpClient := options.HTTPClient
+	if httpClient == nil {
+		if httpClient, err = NewHTTPClient(cfg); err != nil {
+			return cfg, err
+		}
+	}
+	secretsCtx, cancel := context.WithTimeout(ctx, config.SecretsTimeout)
+	err = config.ResolveSecrets(secretsCtx, &cfg, httpClient)
+	cancel()
+	if err != nil {
+		return cfg, err
+	}
+	if errs := cfg.Validate(); len(errs) > 0 {
+		lines := make([]string, len(errs))
+		for i, err := range errs {
+			lines[i] = "  " + err.Error()
+		}
+		return cfg, errors.New("Invalid config:\n" + strings.Join(lines, "\n"))
+	}
+	return cfg, nil
+}
+
+// WithClients returns options with cfg and the HTTP client, SMS provider,
+// opt-out list, sent history and sent products built from it, for a command
+// to keep across reloads. Those options already has are kept, unless it was
+// given an earlier config and cfg changes the settings they're built from,
+// so a reload rebuilds only what it changed.
+func WithClients(options RunnerOptions, cfg config.Config) (RunnerOptions, error) {
+	previous := options.Config
+	changed := func(settings func(config.Config) interface{}) bool {
+		return previous != nil && !reflect.DeepEqual(settings(*previous), settings(cfg))
+	}
+	var err error
+	if options.HTTPClient == nil || changed(httpSettings) {
+		if options.HTTPClient, err = NewHTTPClient(cfg); err != nil {
+			return options, err
+		}
+		options.SMSProvider = nil
+	}
+	if !options.DryRun && (options.SMSProvider == nil || changed(smsSettings)) {
+		logger, err := telemetry.NewLogger(cfg, os.Stderr)
+		if err != nil {
+			return options, err
+		}
+		options.SMSProvider, err = notify.NewSMSProvider(cfg, instrument(options.HTTPClient, options.Debug, logger))
+		if err != nil {
+			return options, err
+		}
+	}
+	if options.OptOuts == nil || changed(func(cfg config.Config) interface{} { return cfg.OptOutFile }) {
+		optOutFile := cfg.OptOutFile
+		if optOutFile == "" {
+			optOutFile = store.DefaultOptOutFile
+		}
+		if options.OptOuts, err = store.LoadOptOutList(optOutFile); err != nil {
+			return options, err
+		}
+	}
+	if cfg.DiffMode == "" {
+		options.SentHistory = nil
+	} else if options.SentHistory == nil || changed(func(cfg config.Config) interface{} { return cfg.SentHistoryFile }) {
+		sentHistoryFile := cfg.SentHistoryFile
+		if sentHistoryFile == "" {
+			sentHistoryFile = store.DefaultSentHistoryFile
+		}
+		if options.SentHistory, err = store.LoadSentHistory(sentHistoryFile); err != nil {
+			return options, err
+		}
+	}
+	if options.SentProducts == nil || changed(func(cfg config.Config) interface{} { return cfg.SentProductsFile }) {
+		sentProductsFile := cfg.SentProductsFile
+		if sentProductsFile == "" {
+			sentProductsFile = store.DefaultSentProductsFile
+		}
+		if options.SentProducts, err = store.LoadSentProducts(sentProductsFile); err != nil {
+			return options, err
+		}
+	}
+	options.Config = &cfg
+	return options, nil
+}
+
+// httpSettings are those NewHTTPClient builds a client from
+func httpSettings(cfg config.Config) interface{} {
+	return [2]interface{}{cfg.HTTPProxy, cfg.HTTPTimeoutSeconds}
+}
+
+// smsSettings are those notify.NewSMSProvider builds a provider from
+func smsSettings(cfg config.Config) interface{} {
+	return []interface{}{
+		cfg.SMSProvider, cfg.Vonage, cfg.SNS, cfg.MessageBird,
+		cfg.TwillioAccountSID, cfg.TwillioAuthToken, cfg.TwillioFromPhone, cfg.TwillioFromPhones,
+		cfg.TwillioTestMode, cfg.TwillioTestAccountSID, cfg.TwillioTestAuthToken,
+		cfg.TwillioMessagingServiceSID, cfg.TwillioStatusCallbackURL, cfg.AlphanumericSenderIDs,
+	}
+}
+
+func urlPath(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Path == "" {
+		return "/"
+	}
+	return u.Path
+}
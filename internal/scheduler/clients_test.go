@@ -0,0 +1,57 @@
+package scheduler
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+)
+
+func TestWithClientsRebuildsOnlyWhatChanged(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.Config{
+		TwillioAccountSID: "AC123",
+		TwillioAuthToken:  "token",
+		TwillioFromPhone:  "+15555550100",
+		OptOutFile:        filepath.Join(dir, "optouts.json"),
+		SentProductsFile:  filepath.Join(dir, "sent-products.json"),
+	}
+	options, err := WithClients(RunnerOptions{}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.HTTPClient == nil || options.SMSProvider == nil || options.OptOuts == nil || options.SentProducts == nil {
+		t.Fatalf("WithClients left something unbuilt: %+v", options)
+	}
+
+	// A reload changing nothing they're built from keeps them all
+	unchanged := cfg
+	unchanged.DefaultPhoneRegion = "CA"
+	reloaded, err := WithClients(options, unchanged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.HTTPClient != options.HTTPClient || reloaded.SMSProvider != options.SMSProvider ||
+		reloaded.OptOuts != options.OptOuts || reloaded.SentProducts != options.SentProducts {
+		t.Error("A reload that changed none of their settings rebuilt clients or stores")
+	}
+
+	// A new timeout rebuilds the HTTP client and the provider using it, but
+	// not the stores
+	changed := cfg
+	changed.HTTPTimeoutSeconds = 5
+	changed.OptOutFile = filepath.Join(dir, "other-optouts.json")
+	reloaded, err = WithClients(reloaded, changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.HTTPClient == options.HTTPClient || reloaded.SMSProvider == options.SMSProvider {
+		t.Error("Changing httpTimeoutSeconds didn't rebuild the HTTP client and provider")
+	}
+	if reloaded.OptOuts == options.OptOuts {
+		t.Error("Changing optOutFile didn't reload the opt-out list")
+	}
+	if reloaded.SentProducts != options.SentProducts {
+		t.Error("The sent products were reloaded though sentProductsFile didn't change")
+	}
+}
@@ -0,0 +1,160 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Health struct tracks the last successful NWS poll and send, or run
+// skipped as a standby, for /healthz and /readyz. Its methods do nothing on
+// a nil *Health.
+type Health struct {
+	// StaleAfter is how long after the last successful poll the daemon is
+	// unhealthy, e.g. a few of its intervals. Zero means never.
+	StaleAfter time.Duration
+
+	mu       sync.Mutex
+	started  time.Time
+	lastPoll time.Time
+	lastSend time.Time
+	// lastStandby is the last run skipped because another instance is the
+	// leader
+	lastStandby time.Time
+	// lastFailure is when a run, or renewing the leader lease, last failed,
+	// and lastError why
+	lastFailure time.Time
+	lastError   string
+}
+
+// NewHealth returns a tracker for a daemon that polls every interval, or
+// runs once if interval is zero
+func NewHealth(interval time.Duration) *Health {
+	return &Health{StaleAfter: 3 * interval, started: time.Now()}
+}
+
+// PollSucceeded records a discussion fetched from the NWS
+func (s *Health) PollSucceeded() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.lastPoll = time.Now()
+	s.mu.Unlock()
+}
+
+// StoodBy records a run skipped because another instance is the leader. A
+// standby is as healthy as a daemon polling.
+func (s *Health) StoodBy() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.lastStandby = time.Now()
+	s.mu.Unlock()
+}
+
+// RunFailed records a run, or renewing the leader lease between runs, that
+// failed. It's shown until the next successful poll or standby.
+func (s *Health) RunFailed(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.lastFailure = time.Now()
+	s.lastError = err.Error()
+	s.mu.Unlock()
+}
+
+// SendSucceeded records a message sent
+func (s *Health) SendSucceeded() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.lastSend = time.Now()
+	s.mu.Unlock()
+}
+
+// healthStatus is the body of /healthz and /readyz
+type healthStatus struct {
+	Status   string     `json:"status"`
+	Started  time.Time  `json:"started"`
+	LastPoll *time.Time `json:"lastPoll"`
+	LastSend *time.Time `json:"lastSend"`
+	// Standby is whether the last run was skipped for another instance
+	Standby bool `json:"standby,omitempty"`
+	// LastError is why the last run failed, if nothing has succeeded since
+	LastError string `json:"lastError,omitempty"`
+}
+
+func (s *Health) status(ok bool) healthStatus {
+	status := healthStatus{Status: "ok", Started: s.started}
+	if !ok {
+		status.Status = "unavailable"
+	}
+	if !s.lastPoll.IsZero() {
+		lastPoll := s.lastPoll
+		status.LastPoll = &lastPoll
+	}
+	if !s.lastSend.IsZero() {
+		lastSend := s.lastSend
+		status.LastSend = &lastSend
+	}
+	status.Standby = s.lastStandby.After(s.lastPoll)
+	if s.lastFailure.After(s.lastPoll) && s.lastFailure.After(s.lastStandby) {
+		status.LastError = s.lastError
+	}
+	return status
+}
+
+// Healthy reports whether the daemon is still polling: it's unhealthy once
+// StaleAfter has passed without a successful poll or standby
+func (s *Health) Healthy() bool {
+	if s == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.healthy()
+}
+
+func (s *Health) healthy() bool {
+	since := s.lastPoll
+	if s.lastStandby.After(since) {
+		since = s.lastStandby
+	}
+	if since.IsZero() {
+		since = s.started
+	}
+	return s.StaleAfter == 0 || time.Since(since) < s.StaleAfter
+}
+
+// Healthz answers with whether the daemon is Healthy
+func (s *Health) Healthz(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	ok := s.healthy()
+	status := s.status(ok)
+	s.mu.Unlock()
+	writeHealth(w, status, ok)
+}
+
+// Readyz reports whether a poll has succeeded, or a run was skipped as a
+// standby, since startup
+func (s *Health) Readyz(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	ok := !s.lastPoll.IsZero() || !s.lastStandby.IsZero()
+	status := s.status(ok)
+	s.mu.Unlock()
+	writeHealth(w, status, ok)
+}
+
+func writeHealth(w http.ResponseWriter, status healthStatus, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,34 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HeartbeatTimeout bounds each heartbeat ping, so a slow monitor can't hold
+// up the next run
+const HeartbeatTimeout = 10 * time.Second
+
+// PingHeartbeat tells a dead man's switch monitor, e.g. healthchecks.io, that
+// a run finished by POSTing its report to url
+func PingHeartbeat(ctx context.Context, client *http.Client, url string, report *RunReport) error {
+	ctx, cancel := context.WithTimeout(ctx, HeartbeatTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(report.String()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Heartbeat ping returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RunReport struct summarizes what a run did, printed and logged at the end
+// of it
+type RunReport struct {
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"-"`
+	// Issuances maps each office polled to the discussion found for it
+	Issuances map[string]Issuance `json:"issuances"`
+	// Users counts the users sent to, and UsersMatched those with at least
+	// one section to send
+	Users        int `json:"users"`
+	UsersMatched int `json:"usersMatched"`
+	// UsersSkipped counts the users not started before the run's deadline
+	UsersSkipped int `json:"usersSkipped"`
+	// InvalidUsers are why users were left out when the users file was
+	// loaded
+	InvalidUsers []string `json:"invalidUsers,omitempty"`
+	// MessagesSent and MessagesScheduled count message parts, as billed
+	MessagesSent      int               `json:"messagesSent"`
+	MessagesScheduled int               `json:"messagesScheduled"`
+	Failures          []DeliveryFailure `json:"failures"`
+	// FetchFailures maps each office whose discussion couldn't be fetched to
+	// the reason
+	FetchFailures map[string]string `json:"fetchFailures"`
+	// Outcomes has what happened for each user, by user ID
+	Outcomes []UserOutcome `json:"outcomes"`
+	// Standby is set if nothing was run because another instance holds the
+	// leader lease
+	Standby bool `json:"standby,omitempty"`
+	// Error is why the run failed as a whole, e.g. the leader lease couldn't
+	// be acquired or was lost partway
+	Error string `json:"error,omitempty"`
+
+	// Users are run concurrently, so mu guards the fields they record into
+	mu sync.Mutex
+}
+
+// Issuance struct identifies a discussion found for an office
+type Issuance struct {
+	ProductID    string    `json:"productId"`
+	IssuanceTime time.Time `json:"issuanceTime"`
+}
+
+// DeliveryFailure struct is a message that couldn't be sent to a user
+type DeliveryFailure struct {
+	User   int    `json:"user"`
+	Office string `json:"office"`
+	Reason string `json:"reason"`
+}
+
+// UserOutcome struct is what a run did for one user
+type UserOutcome struct {
+	User   int    `json:"user"`
+	Office string `json:"office"`
+	// Messages counts the sections to send, after leaving out unchanged ones
+	Messages  int `json:"messages"`
+	Sent      int `json:"sent"`
+	Scheduled int `json:"scheduled"`
+	// Errors are the reasons message parts couldn't be sent, or the user
+	// couldn't be sent to at all
+	Errors []string `json:"errors,omitempty"`
+	// Warnings are problems that didn't stop the rest being sent, e.g. a
+	// subscribed section missing from the discussion
+	Warnings        []string `json:"warnings,omitempty"`
+	DurationSeconds float64  `json:"durationSeconds"`
+}
+
+// NewRunReport returns an empty report for a run starting now
+func NewRunReport() *RunReport {
+	return &RunReport{Started: time.Now(), Issuances: make(map[string]Issuance), FetchFailures: make(map[string]string)}
+}
+
+// issuanceFound records the discussion found for an office
+func (s *RunReport) issuanceFound(office string, productID string, issued time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Issuances[strings.ToUpper(office)] = Issuance{ProductID: productID, IssuanceTime: issued}
+}
+
+// fetchFailed records an office whose discussion couldn't be fetched
+func (s *RunReport) fetchFailed(office string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.FetchFailures[strings.ToUpper(office)] = err.Error()
+}
+
+// addOutcome records what was done for a user, adding it to the totals
+func (s *RunReport) addOutcome(outcome UserOutcome) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Outcomes = append(s.Outcomes, outcome)
+	s.Users++
+	if outcome.Messages > 0 {
+		s.UsersMatched++
+	}
+	s.MessagesSent += outcome.Sent
+	s.MessagesScheduled += outcome.Scheduled
+	for _, reason := range outcome.Errors {
+		s.Failures = append(s.Failures, DeliveryFailure{User: outcome.User, Office: outcome.Office, Reason: reason})
+	}
+}
+
+// MarshalJSON adds the run's duration in seconds
+func (s *RunReport) MarshalJSON() ([]byte, error) {
+	type report RunReport
+	return json.Marshal(struct {
+		*report
+		DurationSeconds float64 `json:"durationSeconds"`
+	}{(*report)(s), s.Duration.Seconds()})
+}
+
+// WriteJSON writes the report to path as JSON, replacing it whole so
+// readers never see part of one
+func (s *RunReport) WriteJSON(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// String describes the run over a few lines, then each failure
+func (s *RunReport) String() string {
+	offices := make([]string, 0, len(s.Issuances))
+	for office := range s.Issuances {
+		offices = append(offices, office)
+	}
+	sort.Strings(offices)
+
+	var b strings.Builder
+	if s.Standby {
+		fmt.Fprintf(&b, "Run at %s skipped, another instance is the leader\n", s.Started.Format(time.RFC3339))
+		return b.String()
+	}
+	fmt.Fprintf(&b, "Run at %s took %s\n", s.Started.Format(time.RFC3339), s.Duration.Round(time.Millisecond))
+	if s.Error != "" {
+		fmt.Fprintf(&b, "Failed: %s\n", s.Error)
+	}
+	fmt.Fprintf(&b, "Offices polled: %d", len(offices))
+	if len(offices) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(offices, ", "))
+	}
+	fmt.Fprintf(&b, "\nUsers matched: %d of %d\n", s.UsersMatched, s.Users)
+	if s.UsersSkipped > 0 {
+		fmt.Fprintf(&b, "Users skipped at the deadline: %d\n", s.UsersSkipped)
+	}
+	fmt.Fprintf(&b, "Messages sent: %d, scheduled: %d, failed: %d\n", s.MessagesSent, s.MessagesScheduled, len(s.Failures))
+	for _, reason := range s.failureReasons(-1) {
+		fmt.Fprintf(&b, "  %s\n", reason)
+	}
+	if warnings := s.warnings(); len(warnings) > 0 {
+		fmt.Fprintf(&b, "Warnings: %d\n", len(warnings))
+		for _, warning := range warnings {
+			fmt.Fprintf(&b, "  %s\n", warning)
+		}
+	}
+	return b.String()
+}
+
+// failureReasons describes up to max failures, or all of them if max is
+// negative, fetches first
+func (s *RunReport) failureReasons(max int) []string {
+	offices := make([]string, 0, len(s.FetchFailures))
+	for office := range s.FetchFailures {
+		offices = append(offices, office)
+	}
+	sort.Strings(offices)
+
+	var reasons []string
+	for _, office := range offices {
+		reasons = append(reasons, fmt.Sprintf("Office %s: %s", office, s.FetchFailures[office]))
+	}
+	for _, failure := range s.Failures {
+		reasons = append(reasons, fmt.Sprintf("User %d (%s): %s", failure.User, failure.Office, failure.Reason))
+	}
+	if max >= 0 && len(reasons) > max {
+		reasons = append(reasons[:max], fmt.Sprintf("and %d more", len(reasons)-max))
+	}
+	return reasons
+}
+
+// warnings describes the users left out when loading and the problems that
+// didn't stop users being sent to
+func (s *RunReport) warnings() []string {
+	var warnings []string
+	for _, reason := range s.InvalidUsers {
+		warnings = append(warnings, "Left out: "+reason)
+	}
+	for _, outcome := range s.Outcomes {
+		for _, warning := range outcome.Warnings {
+			warnings = append(warnings, fmt.Sprintf("User %d (%s): %s", outcome.User, outcome.Office, warning))
+		}
+	}
+	return warnings
+}
+
+// Log logs the report's counts at info level, or warn if anything failed
+func (s *RunReport) Log(logger *slog.Logger) {
+	level := slog.LevelInfo
+	if len(s.Failures) > 0 || s.UsersSkipped > 0 {
+		level = slog.LevelWarn
+	}
+	if s.Error != "" {
+		logger = logger.With("err", s.Error)
+		level = slog.LevelError
+	}
+	logger.Log(context.Background(), level, "Run finished",
+		"duration", s.Duration,
+		"offices", len(s.Issuances),
+		"users", s.Users,
+		"usersMatched", s.UsersMatched,
+		"usersSkipped", s.UsersSkipped,
+		"sent", s.MessagesSent,
+		"scheduled", s.MessagesScheduled,
+		"failed", len(s.Failures),
+		"fetchesFailed", len(s.FetchFailures),
+		"warnings", len(s.warnings()))
+}
@@ -0,0 +1,705 @@
+// Package scheduler runs the polls and sends, and reports on each run.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/afd"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/events"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/notify"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/pipeline"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/store"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/telemetry"
+	"github.com/johnwcallahan/forecast-discussion-alerts/nws"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultConcurrency is how many users are sent to at once when the config
+// doesn't set concurrency
+const DefaultConcurrency = 8
+
+// DefaultRunTimeout bounds fetching and sending for all users in a run when
+// the config doesn't set runTimeoutSeconds
+const DefaultRunTimeout = 15 * time.Minute
+
+// Runner struct holds the config, users and clients for sending the
+// discussions, built from one load of the config and user files
+type Runner struct {
+	Config     config.Config
+	Logger     *slog.Logger
+	Users      config.Users
+	HTTPClient *http.Client
+	NWSClient  nws.API
+	// Fetcher fetches AFDs through NWSClient, falling back to IEM if the
+	// config says to
+	Fetcher nws.AFDFetcher
+	OptOuts *store.OptOutList
+	Sender  notify.Sender
+	// Usage, if set, is printed after each run
+	Usage       *notify.UsageTracker
+	Tracker     *notify.DeliveryTracker
+	Linker      *afd.AFDLinker
+	Summarizer  afd.Summarizer
+	Translator  afd.Translator
+	SentHistory *store.SentHistory
+	// SentProducts, if set, is the last document sent to each user, which
+	// isn't sent again
+	SentProducts *store.SentProducts
+	Metrics      *telemetry.Metrics
+	Health       *Health
+	Alerter      *AdminAlerter
+	// Events, if set, is published what happens in each run
+	Events *events.Bus
+	// DryRun prints messages instead of sending them
+	DryRun bool
+	// SummaryJSON is the file to write each run's report to as JSON, if set
+	SummaryJSON string
+	// InvalidUsers are why users were left out when loading, reported with
+	// every run
+	InvalidUsers []string
+	// Sources are the config's sources by name, for users with a source set.
+	// Sinks are delivered to after SMS.
+	Sources map[string]PluginSource
+	Sinks   []pipeline.Sink
+	// Now tells the time for quiet hours, time.Now if nil
+	Now func() time.Time
+	// Lease, if set, is the leader lease a run must hold to send
+	Lease *store.Lease
+
+	issuancesMu sync.Mutex
+	// issuances maps each office to the ID of the last discussion fetched
+	issuances map[string]string
+}
+
+// PluginSource struct is a source from the config and the parser for its
+// documents
+type PluginSource struct {
+	Source pipeline.Source
+	Parser pipeline.Parser
+}
+
+// RunnerOptions struct says where NewRunner loads the config and users from
+type RunnerOptions struct {
+	ConfigFile string
+	UsersFile  string
+	Profile    string
+	// Overrides are the config settings given as flags, from Flags
+	Overrides map[string]string
+	// Config, if set, is used instead of loading ConfigFile, e.g. as
+	// LoadConfig loaded it
+	Config *config.Config
+	// Metrics, Health, Alerter and Events may be nil. They're shared by
+	// every runner so they survive reloads.
+	Metrics *telemetry.Metrics
+	Health  *Health
+	Alerter *AdminAlerter
+	Events  *events.Bus
+	// The clients and stores below are built from the config if nil.
+	// WithClients builds them for a command to keep across reloads, and
+	// setting them substitutes other implementations, e.g. a fake NWS
+	// server's client in tests.
+	HTTPClient   *http.Client
+	NWSClient    nws.API
+	SMSProvider  notify.SMSProvider
+	OptOuts      *store.OptOutList
+	SentHistory  *store.SentHistory
+	SentProducts *store.SentProducts
+	// Now tells the time for quiet hours, scheduling and the audit log,
+	// time.Now if nil
+	Now func() time.Time
+	// DryRun prints the messages to stdout instead of sending them, and
+	// doesn't record them as sent
+	DryRun bool
+	// Debug logs at debug level, including every HTTP request and response
+	// with credentials redacted
+	Debug bool
+	// SummaryJSON is the file to write each run's report to as JSON, if set
+	SummaryJSON string
+}
+
+// NewRunner loads the config and user files and sets up everything a run
+// needs. Invalid users are skipped with a message, but an invalid config is an
+// error. ctx bounds the requests made while setting up, e.g. to resolve
+// secrets and user locations.
+func NewRunner(ctx context.Context, options RunnerOptions) (*Runner, error) {
+	var users config.Users
+	if err := config.LoadFile(config.FindFile(options.UsersFile), &users); err != nil {
+		return nil, err
+	}
+
+	var cfg config.Config
+	var err error
+	if options.Config != nil {
+		cfg = *options.Config
+	} else if cfg, err = LoadConfig(ctx, options); err != nil {
+		return nil, err
+	}
+	logger, err := telemetry.NewLogger(cfg, os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := options.HTTPClient
+	if httpClient == nil {
+		if httpClient, err = NewHTTPClient(cfg); err != nil {
+			return nil, err
+		}
+	}
+	// The secrets are resolved by now, so their values aren't logged
+	httpClient = instrument(httpClient, options.Debug, logger)
+
+	var invalidUsers []string
+	for _, err := range users.Validate() {
+		logger.Warn("Skipping invalid user", "err", err)
+		invalidUsers = append(invalidUsers, err.Error())
+	}
+	for _, err := range users.CheckSubscriptions(cfg) {
+		logger.Warn("Subscription may be misspelled", "err", err)
+	}
+
+	nwsClient := options.NWSClient
+	if nwsClient == nil {
+		client := NewNWSClientFromConfig(cfg, httpClient)
+		client.Logger = logger
+		client.OnRequest = func(req *http.Request, status int, duration time.Duration) {
+			options.Metrics.ObserveNWSRequest(status, duration)
+		}
+		client.OnRetry = func(req *http.Request, err error) {
+			options.Metrics.NWSRetried()
+		}
+		nwsClient = client
+	}
+	var fetcher nws.AFDFetcher = nwsClient
+	if cfg.IEMFallback {
+		iemClient := nws.NewIEMClient(httpClient)
+		if client, ok := nwsClient.(*nws.Client); ok {
+			iemClient.UserAgent = client.UserAgent
+		}
+		fetcher = &nws.FallbackFetcher{
+			Primary:  nwsClient,
+			Fallback: iemClient,
+			OnFallback: func(locationID string, err error) {
+				logger.Warn("Couldn't fetch the discussion, trying IEM", "office", locationID, "err", err)
+			},
+		}
+	}
+
+	zips := config.DefaultZipTable()
+	if cfg.ZIPCodeFile != "" {
+		zips, err = config.LoadZipTable(cfg.ZIPCodeFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, err := range users.ResolveLocations(ctx, nwsClient, zips) {
+		logger.Warn("Skipping user without a location", "err", err)
+		invalidUsers = append(invalidUsers, err.Error())
+	}
+
+	officeCacheFile := cfg.OfficeCacheFile
+	if officeCacheFile == "" {
+		officeCacheFile = store.DefaultOfficeCacheFile
+	}
+	offices, err := store.LoadOffices(ctx, nwsClient, officeCacheFile, logger)
+	if err != nil {
+		logger.Warn("Couldn't load the office list, not validating locations", "err", err)
+	} else {
+		for _, err := range users.ValidateLocations(offices) {
+			logger.Warn("Skipping user with invalid location", "err", err)
+			invalidUsers = append(invalidUsers, err.Error())
+		}
+	}
+
+	phoneRegion := cfg.DefaultPhoneRegion
+	if phoneRegion == "" {
+		phoneRegion = config.DefaultPhoneRegion
+	}
+	for _, err := range users.NormalizePhones(phoneRegion) {
+		logger.Warn("Skipping user with invalid phone number", "err", err)
+		invalidUsers = append(invalidUsers, err.Error())
+	}
+	if cfg.AdminAlerts.Phone != "" {
+		cfg.AdminAlerts.Phone, err = config.NormalizePhone(cfg.AdminAlerts.Phone, phoneRegion)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid adminAlerts.phone: %v", err)
+		}
+	}
+	for _, err := range users.CompileKeywords() {
+		logger.Warn("Skipping invalid keyword", "err", err)
+	}
+	for _, err := range users.ValidateSources(cfg) {
+		logger.Warn("Skipping user with unknown source", "err", err)
+		invalidUsers = append(invalidUsers, err.Error())
+	}
+
+	sources := make(map[string]PluginSource, len(cfg.Sources))
+	for name, plugin := range cfg.Sources {
+		source, parser, err := pipeline.NewSource(pipeline.PluginEnv{
+			Name: "sources." + name, Plugin: plugin, Config: cfg, HTTPClient: httpClient, Logger: logger,
+		})
+		if err != nil {
+			return nil, err
+		}
+		sources[name] = PluginSource{Source: source, Parser: parser}
+	}
+	var sinks []pipeline.Sink
+	for i, plugin := range cfg.Sinks {
+		sink, err := pipeline.NewSink(pipeline.PluginEnv{
+			Name: fmt.Sprintf("sinks[%d]", i), Plugin: plugin, Config: cfg, HTTPClient: httpClient, Logger: logger,
+		})
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	optOuts := options.OptOuts
+	if optOuts == nil {
+		optOutFile := cfg.OptOutFile
+		if optOutFile == "" {
+			optOutFile = store.DefaultOptOutFile
+		}
+		if optOuts, err = store.LoadOptOutList(optOutFile); err != nil {
+			return nil, err
+		}
+	}
+
+	provider := options.SMSProvider
+	switch {
+	case options.DryRun:
+		provider = &notify.DryRunProvider{Out: os.Stdout}
+	case provider == nil:
+		if provider, err = notify.NewSMSProvider(cfg, httpClient); err != nil {
+			return nil, err
+		}
+	}
+	sender := notify.NewSMSSender(cfg, provider, optOuts)
+	if !options.DryRun {
+		if err := sender.Verify(ctx); err != nil {
+			return nil, err
+		}
+	}
+	sender.Metrics = options.Metrics
+	sender.Now = options.Now
+	if cfg.AuditLogFile != "" && !options.DryRun {
+		sender.Audit = &store.AuditLog{Path: cfg.AuditLogFile, Now: options.Now}
+	}
+
+	summarizer, err := afd.NewSummarizer(cfg.Summarizer, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	translator, err := afd.NewTranslator(cfg.Translator, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	var sentHistory *store.SentHistory
+	if cfg.DiffMode != "" {
+		sentHistory = options.SentHistory
+	}
+	if cfg.DiffMode != "" && sentHistory == nil {
+		sentHistoryFile := cfg.SentHistoryFile
+		if sentHistoryFile == "" {
+			sentHistoryFile = store.DefaultSentHistoryFile
+		}
+		sentHistory, err = store.LoadSentHistory(sentHistoryFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sentProducts := options.SentProducts
+	if sentProducts == nil {
+		sentProductsFile := cfg.SentProductsFile
+		if sentProductsFile == "" {
+			sentProductsFile = store.DefaultSentProductsFile
+		}
+		sentProducts, err = store.LoadSentProducts(sentProductsFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var lease *store.Lease
+	if cfg.LeaderLeaseFile != "" && !options.DryRun {
+		lease = store.NewLease(cfg.LeaderLeaseFile, time.Duration(cfg.LeaderLeaseSeconds)*time.Second)
+		lease.Now = options.Now
+	}
+
+	return &Runner{
+		Config:       cfg,
+		Logger:       logger,
+		Users:        users,
+		HTTPClient:   httpClient,
+		NWSClient:    nwsClient,
+		Fetcher:      fetcher,
+		OptOuts:      optOuts,
+		Sender:       sender,
+		Usage:        sender.Usage,
+		Tracker:      notify.NewDeliveryTracker(sender, cfg),
+		Linker:       afd.NewAFDLinker(cfg, httpClient),
+		Summarizer:   summarizer,
+		Translator:   translator,
+		SentHistory:  sentHistory,
+		SentProducts: sentProducts,
+		Metrics:      options.Metrics,
+		Health:       options.Health,
+		Alerter:      options.Alerter,
+		Events:       options.Events,
+		DryRun:       options.DryRun,
+		SummaryJSON:  options.SummaryJSON,
+		InvalidUsers: invalidUsers,
+		Sources:      sources,
+		Sinks:        sinks,
+		Now:          options.Now,
+		Lease:        lease,
+	}, nil
+}
+
+// Handler returns the handler for Twilio's status callbacks and inbound
+// messages, served on StatusCallbackAddr
+func (s *Runner) Handler() http.Handler {
+	mux := http.NewServeMux()
+	if s.Config.TwillioStatusCallbackURL != "" {
+		mux.Handle(urlPath(s.Config.TwillioStatusCallbackURL), s.Tracker)
+	}
+	if s.Config.TwillioInboundURL != "" {
+		mux.Handle(urlPath(s.Config.TwillioInboundURL), notify.InboundHandler(s.OptOuts, s.Config.TwillioAuthToken, s.Config.TwillioInboundURL))
+	}
+	return mux
+}
+
+// Run sends every user their subscribed sections of the latest discussions
+// and reports what was sent. A user whose discussion can't be fetched is
+// skipped, but an error that would fail every send, such as a misconfigured
+// SMS provider, stops the run and is returned with the report so far.
+// Fetching and sending stop at the run's deadline or when ctx is canceled,
+// and the users not yet started are counted as skipped. If another instance
+// holds the leader lease, nothing is run and the report is marked standby;
+// if the lease can't be acquired, the run fails, and if it's lost partway,
+// sending stops and the run fails with store.ErrLeaseLost.
+func (s *Runner) Run(ctx context.Context) (*RunReport, error) {
+	cfg := s.Config
+	report := NewRunReport()
+	report.InvalidUsers = s.InvalidUsers
+
+	leader, err := s.Lease.Acquire()
+	if err != nil {
+		// Not knowing who the leader is fails the run rather than standing
+		// by, so it's seen
+		s.Logger.Error("Couldn't acquire the leader lease", "path", s.Lease.Path, "err", err)
+		runErr := fmt.Errorf("Couldn't acquire the leader lease: %v", err)
+		s.finish(ctx, report, runErr)
+		return report, runErr
+	}
+	if !leader {
+		s.Logger.Info("Another instance is the leader, skipping the run")
+		report.Standby = true
+		s.Health.StoodBy()
+		return report, nil
+	}
+
+	afds := nws.NewAFDCache(&observedFetcher{AFDFetcher: s.Fetcher, runner: s, report: report})
+
+	runCtx, span := telemetry.Tracer.Start(ctx, "run", trace.WithAttributes(attribute.Int("users", len(s.Users.Users))))
+	timeout := DefaultRunTimeout
+	if cfg.RunTimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.RunTimeoutSeconds) * time.Second
+	}
+	runCtx, cancel := context.WithTimeout(runCtx, timeout)
+	runErr := s.runUsers(runCtx, s.newPipeline(afds), report)
+	if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		s.Logger.Error("The run hit its deadline", "timeout", timeout, "usersSkipped", report.UsersSkipped)
+	}
+	cancel()
+
+	if s.tracksDelivery() {
+		s.Tracker.Wait(ctx)
+	}
+
+	span.SetAttributes(
+		attribute.Int("messages.sent", report.MessagesSent),
+		attribute.Int("messages.failed", len(report.Failures)),
+	)
+	telemetry.EndSpan(span, runErr)
+	if errors.Is(runErr, store.ErrLeaseLost) {
+		s.Logger.Error("Lost the leader lease, stopped sending", "path", s.Lease.Path, "usersSkipped", report.UsersSkipped)
+	}
+
+	s.finish(ctx, report, runErr)
+	return report, runErr
+}
+
+// finish records how a run went, in the report and health, prints and logs
+// the report and sends the admin alert and heartbeat
+func (s *Runner) finish(ctx context.Context, report *RunReport, runErr error) {
+	cfg := s.Config
+	sender := s.Sender
+	if runErr != nil {
+		report.Error = runErr.Error()
+		s.Health.RunFailed(runErr)
+	}
+	report.Duration = time.Since(report.Started)
+	if s.Usage != nil {
+		fmt.Print(s.Usage.Summary())
+	}
+	fmt.Print(report)
+	report.Log(s.Logger)
+	if s.SummaryJSON != "" {
+		if err := report.WriteJSON(s.SummaryJSON); err != nil {
+			s.Logger.Error("Couldn't write the run summary", "path", s.SummaryJSON, "err", err)
+		}
+	}
+	if !s.DryRun {
+		if err := s.Alerter.Check(ctx, cfg.AdminAlerts, report, sender); err != nil {
+			s.Logger.Error("Couldn't send the admin alert", "err", err)
+		}
+		heartbeatURL := cfg.HeartbeatURL
+		if len(report.Failures) > 0 || len(report.FetchFailures) > 0 || report.Error != "" {
+			heartbeatURL = cfg.HeartbeatFailURL
+		}
+		if heartbeatURL != "" {
+			if err := PingHeartbeat(ctx, s.HTTPClient, heartbeatURL, report); err != nil {
+				s.Logger.Warn("Couldn't ping the heartbeat URL", "err", err)
+			}
+		}
+	}
+}
+
+// runUsers runs every user through p with a pool of cfg.Concurrency
+// workers. If a user returns an error, no more users are started and the
+// first error is returned.
+func (s *Runner) runUsers(ctx context.Context, p *pipeline.Pipeline, report *RunReport) error {
+	concurrency := s.Config.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var runErr error
+	users := make(chan config.User)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for user := range users {
+				if err := s.runUser(ctx, user, p, report); err != nil {
+					errOnce.Do(func() {
+						runErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+feed:
+	for i, user := range s.Users.Users {
+		select {
+		case users <- user:
+		case <-ctx.Done():
+			report.UsersSkipped = len(s.Users.Users) - i
+			break feed
+		}
+	}
+	close(users)
+	wg.Wait()
+
+	sort.SliceStable(report.Outcomes, func(i, j int) bool {
+		return report.Outcomes[i].User < report.Outcomes[j].User
+	})
+	return runErr
+}
+
+// runUser sends a user their messages through p, or p with the user's source
+// if they have one, traced as a child of ctx.
+// Anything that goes wrong for the user, even a panic, is recorded in their
+// outcome; it only returns an error if the run can't go on.
+func (s *Runner) runUser(ctx context.Context, user config.User, p *pipeline.Pipeline, report *RunReport) error {
+	ctx, span := telemetry.Tracer.Start(ctx, "user", trace.WithAttributes(
+		attribute.Int("user.id", user.ID),
+		attribute.String("office", user.LocationID),
+	))
+	defer span.End()
+
+	outcome := UserOutcome{User: user.ID, Office: user.LocationID}
+	started := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			err := fmt.Errorf("Panic: %v", r)
+			s.Logger.Error("Panic sending to user", "user", user.ID, "office", user.LocationID, "err", err, "stack", string(debug.Stack()))
+			outcome.Errors = append(outcome.Errors, err.Error())
+		}
+		outcome.DurationSeconds = time.Since(started).Seconds()
+		report.addOutcome(outcome)
+	}()
+
+	if source, ok := s.Sources[user.Source]; ok {
+		userPipeline := *p
+		userPipeline.Source = source.Source
+		userPipeline.Parser = source.Parser
+		p = &userPipeline
+	}
+	result, err := p.Run(ctx, user)
+	if len(result.Warnings) > 0 {
+		s.Logger.Warn("Some subscribed sections are missing", "user", user.ID, "office", user.LocationID, "err", errors.Join(result.Warnings...))
+	}
+	for _, warning := range result.Warnings {
+		outcome.Warnings = append(outcome.Warnings, warning.Error())
+	}
+	outcome.Messages = len(result.Messages)
+	for _, message := range result.Messages {
+		s.Events.Publish(events.SectionChanged{User: user.ID, Office: user.LocationID, Section: message.Section.Name, Text: message.Section.Text})
+	}
+	for _, delivery := range result.Deliveries {
+		switch {
+		case delivery.Err != nil:
+			outcome.Errors = append(outcome.Errors, delivery.Err.Error())
+			s.Events.Publish(events.SendFailed{User: user.ID, Office: user.LocationID, Sink: delivery.Sink, Section: delivery.Section, Err: delivery.Err})
+		case delivery.Scheduled:
+			outcome.Scheduled++
+		default:
+			outcome.Sent++
+			s.Health.SendSucceeded()
+		}
+	}
+	if notify.IsMisconfigured(err) || errors.Is(err, store.ErrLeaseLost) {
+		return err
+	}
+	if err != nil {
+		s.Logger.Error("Skipping user", "user", user.ID, "office", user.LocationID, "err", err)
+		outcome.Errors = append(outcome.Errors, err.Error())
+		return nil
+	}
+
+	if s.SentHistory != nil && !s.DryRun {
+		for _, section := range result.Delivered() {
+			if err := s.SentHistory.Record(user.Phone, section.Text); err != nil {
+				s.Logger.Error("Couldn't save sent history", "user", user.ID, "err", err)
+			}
+		}
+	}
+	// Only once everything is delivered, so what failed is tried again
+	if doc := result.Document; doc != nil && len(outcome.Errors) == 0 && !s.DryRun {
+		if err := s.SentProducts.Record(user.Phone, doc.Key(), doc.ID); err != nil {
+			s.Logger.Error("Couldn't save the sent product", "user", user.ID, "err", err)
+		}
+	}
+	return nil
+}
+
+// tracksDelivery reports whether messages sent are tracked until Twilio
+// reports their delivery, which needs somewhere to receive its callbacks.
+// Twilio doesn't send them for test credentials.
+func (s *Runner) tracksDelivery() bool {
+	cfg := s.Config
+	return cfg.TwillioStatusCallbackURL != "" && cfg.StatusCallbackAddr != "" && !cfg.TwillioTestMode && !s.DryRun
+}
+
+// newPipeline returns the stages each user's messages go through in a run,
+// fetching AFDs through afds
+func (s *Runner) newPipeline(afds nws.AFDFetcher) *pipeline.Pipeline {
+	p := &pipeline.Pipeline{
+		Source:  &pipeline.AFDSource{Fetcher: afds, Timeout: NWSTimeout},
+		Parser:  &pipeline.AFDParser{Config: s.Config},
+		Filters: []pipeline.Filter{&pipeline.ProductFilter{Products: s.SentProducts}},
+	}
+	if s.SentHistory != nil {
+		p.Filters = append(p.Filters, &pipeline.HistoryFilter{History: s.SentHistory, Mode: s.Config.DiffMode})
+	}
+	if s.Config.ExpandAbbreviations {
+		p.Filters = append(p.Filters, pipeline.AbbreviationFilter)
+	}
+	if s.Summarizer != nil {
+		p.Filters = append(p.Filters, &pipeline.SummaryFilter{
+			Summarizer: s.Summarizer,
+			Sections:   s.Config.Summarizer.Sections,
+			MaxLength:  s.Config.Summarizer.MaxLength,
+			Timeout:    NWSTimeout,
+			Logger:     s.Logger,
+		})
+	}
+	if s.Translator != nil {
+		p.Filters = append(p.Filters, &pipeline.TranslateFilter{Translator: s.Translator, Timeout: NWSTimeout, Logger: s.Logger})
+	}
+	p.Filters = append(p.Filters, &pipeline.LinkFilter{Linker: s.Linker, AppendAFDLink: s.Config.AppendAFDLink})
+	var tracker *notify.DeliveryTracker
+	if s.tracksDelivery() {
+		tracker = s.Tracker
+	}
+	p.Sinks = append(p.Sinks, &pipeline.SMSSink{
+		Sender:  s.Sender,
+		Channel: notify.ChannelName(s.Config),
+		Tracker: tracker,
+		Logger:  s.Logger,
+		Now:     s.Now,
+	})
+	p.Sinks = append(p.Sinks, s.Sinks...)
+	if s.Lease != nil {
+		p.Guard = func() error {
+			if !s.Lease.Held() {
+				return store.ErrLeaseLost
+			}
+			return nil
+		}
+	}
+	return p
+}
+
+// observedFetcher struct records each discussion fetched in metrics, health
+// and the run's report, and publishes the new ones
+type observedFetcher struct {
+	nws.AFDFetcher
+	runner *Runner
+	report *RunReport
+}
+
+func (s *observedFetcher) GetAFD(ctx context.Context, locationID string) (*nws.Product, error) {
+	ctx, span := telemetry.Tracer.Start(ctx, "fetch", trace.WithAttributes(attribute.String("office", strings.ToUpper(locationID))))
+	product, err := s.AFDFetcher.GetAFD(ctx, locationID)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		s.report.fetchFailed(locationID, err)
+	}
+	if err == nil {
+		office := strings.ToUpper(locationID)
+		s.runner.Metrics.ProductFetched(office)
+		s.runner.Health.PollSucceeded()
+		s.report.issuanceFound(locationID, product.ID, product.IssuanceTime)
+		if s.runner.newIssuance(office, product.ID) {
+			s.runner.Events.Publish(events.NewIssuance{Office: office, ProductID: product.ID, Issued: product.IssuanceTime})
+		}
+	}
+	return product, err
+}
+
+// newIssuance records the discussion fetched for an office, reporting
+// whether it differs from the last one
+func (s *Runner) newIssuance(office string, productID string) bool {
+	s.issuancesMu.Lock()
+	defer s.issuancesMu.Unlock()
+	if s.issuances == nil {
+		s.issuances = make(map[string]string)
+	}
+	if s.issuances[office] == productID {
+		return false
+	}
+	s.issuances[office] = productID
+	return true
+}
@@ -0,0 +1,394 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/notify"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/store"
+	"github.com/johnwcallahan/forecast-discussion-alerts/nws"
+	"github.com/johnwcallahan/forecast-discussion-alerts/nws/nwstest"
+)
+
+// testNow is when the test runs happen, outside anyone's quiet hours in the
+// US: 2 PM in Boston
+var testNow = time.Date(2024, 10, 15, 18, 0, 0, 0, time.UTC)
+
+// sentMessage struct is a message the recording provider was given
+type sentMessage struct {
+	To     string
+	Body   string
+	SendAt time.Time
+}
+
+// recordingProvider struct records what it's asked to send and schedule,
+// failing or panicking for the numbers it's told to
+type recordingProvider struct {
+	// fail maps numbers to the error sending to them returns, and panic
+	// lists those sending to panics
+	fail  map[string]error
+	panic map[string]bool
+	// delay is how long each send takes
+	delay time.Duration
+	// onSend, if set, is called after each message is recorded
+	onSend func()
+
+	mu          sync.Mutex
+	sent        []sentMessage
+	inFlight    int
+	maxInFlight int
+}
+
+func (s *recordingProvider) SendSMS(ctx context.Context, to string, body string) (string, error) {
+	return s.record(to, body, time.Time{})
+}
+
+func (s *recordingProvider) ScheduleMMS(ctx context.Context, to string, body string, mediaURL string, sendAt time.Time) (string, error) {
+	return s.record(to, body, sendAt)
+}
+
+func (s *recordingProvider) record(to string, body string, sendAt time.Time) (string, error) {
+	if s.panic[to] {
+		panic("provider exploded")
+	}
+	if err := s.fail[to]; err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	s.inFlight++
+	if s.inFlight > s.maxInFlight {
+		s.maxInFlight = s.inFlight
+	}
+	s.mu.Unlock()
+	time.Sleep(s.delay)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight--
+	s.sent = append(s.sent, sentMessage{To: to, Body: body, SendAt: sendAt})
+	if s.onSend != nil {
+		s.onSend()
+	}
+	return fmt.Sprintf("SM%d", len(s.sent)), nil
+}
+
+// to returns the messages sent or scheduled to a number, in order
+func (s *recordingProvider) to(phone string) []sentMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var messages []sentMessage
+	for _, message := range s.sent {
+		if message.To == phone {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+// newTestRunner returns a runner for users, fetching from server and
+// sending through provider, with its files in a temporary directory
+func newTestRunner(t *testing.T, server *nwstest.Server, provider *recordingProvider, cfg config.Config, users ...config.User) *Runner {
+	t.Helper()
+	dir := t.TempDir()
+	usersFile := filepath.Join(dir, "users.json")
+	data, err := json.Marshal(config.Users{Users: users})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(usersFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.TwillioAccountSID = "AC123"
+	cfg.TwillioAuthToken = "token"
+	cfg.TwillioFromPhone = "+16175550100"
+	cfg.LogLevel = "error"
+	cfg.OptOutFile = filepath.Join(dir, "optouts.json")
+	cfg.OfficeCacheFile = filepath.Join(dir, "offices.json")
+	cfg.SentProductsFile = filepath.Join(dir, "sent-products.json")
+	runner, err := NewRunner(context.Background(), RunnerOptions{
+		Config:      &cfg,
+		UsersFile:   usersFile,
+		NWSClient:   server.NWSClient(),
+		SMSProvider: provider,
+		Now:         func() time.Time { return testNow },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runner
+}
+
+func testUser(id int, office string, subscriptions ...string) config.User {
+	return config.User{
+		ID:            id,
+		FirstName:     "User",
+		LastName:      fmt.Sprint(id),
+		LocationID:    office,
+		Phone:         fmt.Sprintf("+1617555%04d", 1000+id),
+		Subscriptions: subscriptions,
+	}
+}
+
+func TestRunSendsSubscribedSections(t *testing.T) {
+	server := nwstest.NewServer()
+	defer server.Close()
+	provider := &recordingProvider{}
+	box := testUser(1, "BOX", "SHORT TERM", "SYNOPSIS")
+	oax := testUser(2, "oax", "KEY MESSAGES")
+	runner := newTestRunner(t, server, provider, config.Config{}, box, oax)
+
+	report, err := runner.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := provider.to(box.Phone)
+	if len(sent) != 2 || !strings.HasPrefix(sent[0].Body, "SHORT TERM:") || !strings.HasPrefix(sent[1].Body, "SYNOPSIS:") {
+		t.Errorf("BOX user was sent %q, want SHORT TERM then SYNOPSIS", sent)
+	}
+	if sent := provider.to(oax.Phone); len(sent) != 1 || !strings.HasPrefix(sent[0].Body, "KEY MESSAGES:") {
+		t.Errorf("OAX user was sent %q, want KEY MESSAGES", sent)
+	}
+	if report.MessagesSent != 3 || report.UsersMatched != 2 || len(report.Failures) != 0 {
+		t.Errorf("Report has %d sent to %d users with failures %v, want 3 to 2", report.MessagesSent, report.UsersMatched, report.Failures)
+	}
+
+	// Polling again finds the same discussions, already sent
+	if report, err = runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if report.MessagesSent != 0 || len(provider.to(box.Phone)) != 2 {
+		t.Errorf("Rerunning on the same discussions sent %d messages, want none", report.MessagesSent)
+	}
+
+	// Until a new one is issued
+	server.AddAFD("BOX", nwstest.Fixture("BOX"), nwstest.FixtureIssuanceTime.Add(time.Hour))
+	if report, err = runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if report.MessagesSent != 2 || len(provider.to(box.Phone)) != 4 || len(provider.to(oax.Phone)) != 1 {
+		t.Errorf("A new BOX discussion sent %d messages, want the BOX user's 2", report.MessagesSent)
+	}
+}
+
+func TestRunSendsEachIEMFallbackIssuance(t *testing.T) {
+	server := nwstest.NewServer()
+	defer server.Close()
+	server.Fail("BOX", 500)
+	var mu sync.Mutex
+	archived := nwstest.Fixture("BOX")
+	iem := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprint(w, archived)
+	}))
+	defer iem.Close()
+
+	provider := &recordingProvider{}
+	box := testUser(1, "BOX", "SHORT TERM")
+	runner := newTestRunner(t, server, provider, config.Config{}, box)
+	runner.Fetcher = &nws.FallbackFetcher{
+		Primary:  runner.NWSClient,
+		Fallback: &nws.IEMClient{BaseURI: iem.URL, HTTPClient: iem.Client()},
+	}
+
+	for i, issued := range []string{"150745", "150745", "151415"} {
+		mu.Lock()
+		archived = strings.Replace(nwstest.Fixture("BOX"), "KBOX 150745", "KBOX "+issued, 1)
+		mu.Unlock()
+		if _, err := runner.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		// The second run finds the same issuance, already sent
+		want := map[int]int{0: 1, 1: 1, 2: 2}[i]
+		if sent := provider.to(box.Phone); len(sent) != want {
+			t.Errorf("After archived issuance %d the user was sent %d messages, want %d", i+1, len(sent), want)
+		}
+	}
+}
+
+func TestRunSplitsLongSections(t *testing.T) {
+	server := nwstest.NewServer()
+	defer server.Close()
+	sentence := "Showers and thunderstorms continue across the area with locally heavy rain. "
+	server.AddAFD("GYX", "FXUS61 KGYX 151200\nAFDGYX\n\nArea Forecast Discussion\nNational Weather Service Gray ME\n800 AM EDT Tue Oct 15 2024\n\n"+
+		".DISCUSSION...\n"+strings.Repeat(sentence, 60)+"\n\n&&\n\n$$\n", nwstest.FixtureIssuanceTime)
+	provider := &recordingProvider{}
+	user := testUser(1, "GYX", "DISCUSSION")
+	runner := newTestRunner(t, server, provider, config.Config{}, user)
+
+	if _, err := runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	sent := provider.to(user.Phone)
+	if len(sent) < 3 {
+		t.Fatalf("A %d character section was sent in %d messages", 60*len(sentence), len(sent))
+	}
+	for i, message := range sent {
+		if len(message.Body) > notify.MaxSMSLength {
+			t.Errorf("Part %d is %d characters, over %d", i+1, len(message.Body), notify.MaxSMSLength)
+		}
+		if prefix := fmt.Sprintf("(%d/%d) DISCUSSION:", i+1, len(sent)); !strings.HasPrefix(message.Body, prefix) {
+			t.Errorf("Part %d starts %q, want %q", i+1, message.Body[:30], prefix)
+		}
+	}
+}
+
+func TestRunSchedulesInQuietHours(t *testing.T) {
+	server := nwstest.NewServer()
+	defer server.Close()
+	provider := &recordingProvider{}
+	// 2 PM in Boston is 11 AM in Portland, Oregon
+	awake := testUser(1, "BOX", "SYNOPSIS")
+	asleep := testUser(2, "PQR", "SYNOPSIS")
+	asleep.QuietHoursStart = "09:00"
+	asleep.QuietHoursEnd = "12:30"
+	asleep.TimeZone = "America/Los_Angeles"
+	runner := newTestRunner(t, server, provider, config.Config{}, awake, asleep)
+
+	report, err := runner.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent := provider.to(awake.Phone); len(sent) != 1 || !sent[0].SendAt.IsZero() {
+		t.Errorf("The user outside quiet hours was sent %+v, want one message now", sent)
+	}
+	want := time.Date(2024, 10, 15, 12, 30, 0, 0, mustLoadLocation(t, "America/Los_Angeles"))
+	if sent := provider.to(asleep.Phone); len(sent) != 1 || !sent[0].SendAt.Equal(want) {
+		t.Errorf("The user in quiet hours was sent %+v, want one message scheduled for %s", sent, want)
+	}
+	if report.MessagesSent != 1 || report.MessagesScheduled != 1 {
+		t.Errorf("Report has %d sent and %d scheduled, want 1 and 1", report.MessagesSent, report.MessagesScheduled)
+	}
+}
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("No time zone data: %v", err)
+	}
+	return location
+}
+
+func TestRunIsolatesUserFailures(t *testing.T) {
+	server := nwstest.NewServer()
+	defer server.Close()
+	server.Fail("MFL", 500)
+	ok := testUser(1, "BOX", "SYNOPSIS")
+	failing := testUser(2, "BOX", "SYNOPSIS")
+	panicking := testUser(3, "BOX", "SYNOPSIS")
+	fetchFails := testUser(4, "MFL", "MARINE")
+	missing := testUser(5, "OAX", "MARINE", "KEY MESSAGES")
+	provider := &recordingProvider{
+		fail:  map[string]error{failing.Phone: errors.New("Number is unreachable")},
+		panic: map[string]bool{panicking.Phone: true},
+	}
+	runner := newTestRunner(t, server, provider, config.Config{}, ok, failing, panicking, fetchFails, missing)
+
+	report, err := runner.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(provider.to(ok.Phone)) != 1 {
+		t.Error("The user with nothing wrong wasn't sent their section")
+	}
+	if sent := provider.to(missing.Phone); len(sent) != 1 || !strings.HasPrefix(sent[0].Body, "KEY MESSAGES:") {
+		t.Errorf("The user subscribed to a missing section was sent %q, want the other section", sent)
+	}
+	if _, ok := report.FetchFailures["MFL"]; !ok {
+		t.Errorf("The MFL fetch failure isn't reported: %v", report.FetchFailures)
+	}
+
+	outcomes := make(map[int]UserOutcome)
+	for _, outcome := range report.Outcomes {
+		outcomes[outcome.User] = outcome
+	}
+	if len(outcomes) != 5 {
+		t.Fatalf("Report has outcomes for %d users, want 5", len(outcomes))
+	}
+	for _, id := range []int{failing.ID, panicking.ID, fetchFails.ID} {
+		if len(outcomes[id].Errors) == 0 {
+			t.Errorf("User %d's failure isn't in their outcome: %+v", id, outcomes[id])
+		}
+	}
+	if len(outcomes[missing.ID].Warnings) != 1 || len(outcomes[missing.ID].Errors) != 0 {
+		t.Errorf("The missing section should be a warning: %+v", outcomes[missing.ID])
+	}
+	if len(outcomes[ok.ID].Errors) != 0 || outcomes[ok.ID].Sent != 1 {
+		t.Errorf("The user with nothing wrong has outcome %+v", outcomes[ok.ID])
+	}
+}
+
+func TestRunUsesAWorkerPool(t *testing.T) {
+	server := nwstest.NewServer()
+	defer server.Close()
+	provider := &recordingProvider{delay: 20 * time.Millisecond}
+	var users []config.User
+	for id := 1; id <= 12; id++ {
+		users = append(users, testUser(id, "BOX", "SYNOPSIS"))
+	}
+	runner := newTestRunner(t, server, provider, config.Config{Concurrency: 3}, users...)
+
+	requests := server.Requests()
+	report, err := runner.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.MessagesSent != len(users) {
+		t.Errorf("Sent %d messages, want %d", report.MessagesSent, len(users))
+	}
+	if provider.maxInFlight < 2 || provider.maxInFlight > 3 {
+		t.Errorf("%d messages were sent at once, want 2 or 3", provider.maxInFlight)
+	}
+	// Everyone shares one fetch of the office's discussion
+	if fetches := server.Requests() - requests; fetches > 2 {
+		t.Errorf("The run made %d NWS requests for one office", fetches)
+	}
+}
+
+func TestRunStopsWhenTheLeaseIsLost(t *testing.T) {
+	server := nwstest.NewServer()
+	defer server.Close()
+	now := testNow
+	var mu sync.Mutex
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	// The first send takes longer than the lease lasts
+	provider := &recordingProvider{onSend: func() {
+		mu.Lock()
+		now = now.Add(2 * time.Minute)
+		mu.Unlock()
+	}}
+	var users []config.User
+	for id := 1; id <= 4; id++ {
+		users = append(users, testUser(id, "BOX", "SYNOPSIS"))
+	}
+	runner := newTestRunner(t, server, provider, config.Config{Concurrency: 1}, users...)
+	runner.Lease = &store.Lease{Path: filepath.Join(t.TempDir(), "leader.json"), Holder: "test", Duration: time.Minute, Now: clock}
+
+	report, err := runner.Run(context.Background())
+	if !errors.Is(err, store.ErrLeaseLost) {
+		t.Fatalf("Run returned %v, want ErrLeaseLost", err)
+	}
+	if report.Error == "" || report.Standby {
+		t.Errorf("The report doesn't show the failure: error %q, standby %v", report.Error, report.Standby)
+	}
+	if len(provider.sent) != 1 {
+		t.Errorf("Sent %d messages after losing the lease, want only the first", len(provider.sent))
+	}
+}
@@ -0,0 +1,54 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// RunHandler returns a handler that loads the config and users with options
+// and runs once for each POST to path, answering with the run's report as
+// JSON. Anything else, any other path or method, is answered 404 Not Found,
+// so crawlers and health checks don't send alerts. It's for platforms that
+// start runs with HTTP requests, such as Cloud Scheduler with Cloud Run. A
+// request made while a run is in progress is refused with 409 Conflict, and a
+// run that fails answers 500 with the error and the report so far.
+func RunHandler(path string, options RunnerOptions) http.Handler {
+	var running sync.Mutex
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path || r.Method != http.MethodPost {
+			writeRunResult(w, http.StatusNotFound, runResult{Error: "Not found, POST to " + path + " to run"})
+			return
+		}
+		if !running.TryLock() {
+			writeRunResult(w, http.StatusConflict, runResult{Error: "A run is already in progress"})
+			return
+		}
+		defer running.Unlock()
+
+		runner, err := NewRunner(r.Context(), options)
+		if err != nil {
+			writeRunResult(w, http.StatusInternalServerError, runResult{Error: err.Error()})
+			return
+		}
+		report, err := runner.Run(r.Context())
+		if err != nil {
+			writeRunResult(w, http.StatusInternalServerError, runResult{Error: err.Error(), Report: report})
+			return
+		}
+		writeRunResult(w, http.StatusOK, runResult{Report: report})
+	})
+}
+
+// runResult is the body RunHandler answers with
+type runResult struct {
+	Error  string     `json:"error,omitempty"`
+	Report *RunReport `json:"report,omitempty"`
+}
+
+func writeRunResult(w http.ResponseWriter, status int, result runResult) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,31 @@
+package scheduler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRunHandlerOnlyRunsOnPOST(t *testing.T) {
+	handler := RunHandler("/run", RunnerOptions{ConfigFile: "missing.json", UsersFile: "missing.json"})
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodGet, "/run", http.StatusNotFound},
+		{http.MethodHead, "/run", http.StatusNotFound},
+		{http.MethodPost, "/", http.StatusNotFound},
+		{http.MethodPost, "/run/", http.StatusNotFound},
+		{http.MethodGet, "/favicon.ico", http.StatusNotFound},
+		// Reaches the runner, which fails on the missing config
+		{http.MethodPost, "/run", http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+		if w.Code != test.status {
+			t.Errorf("%s %s answered %d, want %d", test.method, test.path, w.Code, test.status)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditEntry struct is one line of the send audit log: a send attempt, or a
+// final delivery status reported later for the same SID
+type AuditEntry struct {
+	Time    time.Time `json:"time"`
+	To      string    `json:"to"`
+	Channel string    `json:"channel"`
+	// SID is the ID the provider assigned to the message, empty if it was
+	// never accepted
+	SID string `json:"sid,omitempty"`
+	// MessageHash is the SHA-256 of the body, so a disputed message can be
+	// matched without the log holding forecasts
+	MessageHash string `json:"messageHash"`
+	MMS         bool   `json:"mms,omitempty"`
+	// Status is "sent", "scheduled", "failed" or "unsubscribed" for an
+	// attempt, or the provider's final status, e.g. "delivered"
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// AuditLog struct appends an entry for every send to a JSON lines file. Its
+// methods do nothing on a nil *AuditLog.
+type AuditLog struct {
+	Path string
+	// Now timestamps entries, time.Now if nil
+	Now func() time.Time
+
+	mu sync.Mutex
+}
+
+// MessageHash returns the hex SHA-256 of a message body
+func MessageHash(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// Record appends entry to the log, timestamped now if it isn't already. The
+// file is opened for each entry, so it can be rotated underneath us.
+func (s *AuditLog) Record(entry AuditEntry) error {
+	if s == nil {
+		return nil
+	}
+	if entry.Time.IsZero() && s.Now != nil {
+		entry.Time = s.Now().UTC()
+	} else if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,76 @@
+// Package store keeps the files that persist between runs: the sent
+// history and products, opt-outs, office cache, leader lease and audit log.
+package store
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/nws"
+)
+
+// DefaultSentHistoryFile is where the last section sent to each user is kept
+// when the config doesn't say otherwise
+const DefaultSentHistoryFile = "sent.json"
+
+// SentHistory struct is a persistent record of the last version of each
+// section sent to each phone number
+type SentHistory struct {
+	Path string
+
+	mu       sync.Mutex
+	sections map[string]map[string]string
+}
+
+// LoadSentHistory reads the history at path. A missing file is an empty
+// history.
+func LoadSentHistory(path string) (*SentHistory, error) {
+	history := &SentHistory{
+		Path:     path,
+		sections: make(map[string]map[string]string),
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return history, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &history.sections); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// Last returns the last version of a section sent to a phone number
+func (s *SentHistory) Last(phone string, section string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	text, ok := s.sections[phone][nws.FormattedSectionName(section)]
+	return text, ok
+}
+
+// Record saves section as the last version sent to a phone number
+func (s *SentHistory) Record(phone string, section string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sections[phone] == nil {
+		s.sections[phone] = make(map[string]string)
+	}
+	s.sections[phone][nws.FormattedSectionName(section)] = section
+	return s.save()
+}
+
+func (s *SentHistory) save() error {
+	data, err := json.MarshalIndent(s.sections, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.Path)
+}
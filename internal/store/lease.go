@@ -0,0 +1,198 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultLeaseDuration is how long a leader lease lasts without being renewed
+// when the config doesn't say otherwise
+const DefaultLeaseDuration = time.Minute
+
+// ErrLeaseLost is returned for work stopped because the leader lease expired
+// without being renewed, so another instance may have taken over
+var ErrLeaseLost = errors.New("The leader lease was lost")
+
+// Lease struct is a leader lease kept in a file on storage shared by every
+// instance. Whoever holds it is the leader until it expires, so one instance
+// sends and the others take over if it stops renewing the lease.
+type Lease struct {
+	Path string
+	// Holder names this instance in the lease file
+	Holder   string
+	Duration time.Duration
+	// Now tells the time, time.Now if nil
+	Now func() time.Time
+
+	mu sync.Mutex
+	// expires is when the lease this instance last wrote runs out, zero if
+	// it isn't held
+	expires time.Time
+}
+
+// leaseRecord is what a lease file holds
+type leaseRecord struct {
+	Holder  string    `json:"holder"`
+	Expires time.Time `json:"expires"`
+}
+
+// NewLease returns a lease kept at path lasting duration, or
+// DefaultLeaseDuration if it's 0, held as this host and process
+func NewLease(path string, duration time.Duration) *Lease {
+	if duration <= 0 {
+		duration = DefaultLeaseDuration
+	}
+	host, _ := os.Hostname()
+	return &Lease{Path: path, Holder: fmt.Sprintf("%s:%d", host, os.Getpid()), Duration: duration}
+}
+
+// Acquire takes the lease if it's free or has expired, or renews it if it's
+// already held, and reports whether it's held. If it can't be renewed, it's
+// still Held until it expires. A nil lease is always held, so a lone
+// instance is always the leader.
+func (s *Lease) Acquire() (bool, error) {
+	if s == nil {
+		return true, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	locked, err := s.lock()
+	if err != nil {
+		return false, err
+	}
+	if !locked {
+		// Another instance is acquiring it right now, so it's only held if
+		// it was and hasn't expired
+		return s.now().Before(s.expires), nil
+	}
+	defer os.Remove(s.lockPath())
+
+	record, err := s.read()
+	if err != nil {
+		return false, err
+	}
+	now := s.now()
+	if record.Holder != s.Holder && now.Before(record.Expires) {
+		s.expires = time.Time{}
+		return false, nil
+	}
+	expires := now.Add(s.Duration)
+	if err := s.write(leaseRecord{Holder: s.Holder, Expires: expires}); err != nil {
+		return false, err
+	}
+	s.expires = expires
+	return true, nil
+}
+
+// Held reports whether the lease is still held as of the last Acquire, i.e.
+// it hasn't expired since. It doesn't read the lease file, so it's cheap
+// enough to check before every send. A nil lease is always held.
+func (s *Lease) Held() bool {
+	if s == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.now().Before(s.expires)
+}
+
+// Release gives the lease up if it's held, so another instance can take over
+// without waiting for it to expire
+func (s *Lease) Release() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expires = time.Time{}
+	locked, err := s.lock()
+	if err != nil || !locked {
+		return err
+	}
+	defer os.Remove(s.lockPath())
+
+	record, err := s.read()
+	if err != nil || record.Holder != s.Holder {
+		return err
+	}
+	return s.write(leaseRecord{})
+}
+
+func (s *Lease) lockPath() string {
+	return s.Path + ".lock"
+}
+
+// lockWait is how long lock waits for another instance to finish with the
+// lease file
+const lockWait = time.Second
+
+// lock creates the lock file guarding the lease file while it's read and
+// written, waiting up to lockWait if another instance has it and then
+// reporting false. A lock file left by an instance that died while holding it
+// is removed once it's older than the lease.
+func (s *Lease) lock() (bool, error) {
+	deadline := time.Now().Add(lockWait)
+	for {
+		file, err := os.OpenFile(s.lockPath(), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			return true, file.Close()
+		}
+		if !os.IsExist(err) {
+			return false, err
+		}
+		info, err := os.Stat(s.lockPath())
+		if err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+		if err == nil && time.Since(info.ModTime()) >= s.Duration {
+			if err := os.Remove(s.lockPath()); err != nil && !os.IsNotExist(err) {
+				return false, err
+			}
+			continue
+		}
+		if time.Now().After(deadline) {
+			return false, nil
+		}
+		time.Sleep(lockWait / 20)
+	}
+}
+
+// read returns the lease file's record, empty if there's no file
+func (s *Lease) read() (leaseRecord, error) {
+	var record leaseRecord
+	data, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return record, nil
+	}
+	if err != nil {
+		return record, err
+	}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return record, fmt.Errorf("Invalid lease file %s: %v", s.Path, err)
+	}
+	return record, nil
+}
+
+func (s *Lease) write(record leaseRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	tmp := s.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.Path)
+}
+
+func (s *Lease) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
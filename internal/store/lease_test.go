@@ -0,0 +1,129 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testLeases returns two instances' leases on the same file, both telling
+// the time from *now
+func testLeases(t *testing.T, now *time.Time) (*Lease, *Lease) {
+	path := filepath.Join(t.TempDir(), "leader.json")
+	clock := func() time.Time { return *now }
+	a := &Lease{Path: path, Holder: "a", Duration: time.Minute, Now: clock}
+	b := &Lease{Path: path, Holder: "b", Duration: time.Minute, Now: clock}
+	return a, b
+}
+
+func mustAcquire(t *testing.T, lease *Lease, want bool) {
+	t.Helper()
+	held, err := lease.Acquire()
+	if err != nil {
+		t.Fatalf("%s: Acquire: %v", lease.Holder, err)
+	}
+	if held != want {
+		t.Fatalf("%s: Acquire = %v, want %v", lease.Holder, held, want)
+	}
+}
+
+func TestLeaseOneLeader(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	a, b := testLeases(t, &now)
+
+	mustAcquire(t, a, true)
+	mustAcquire(t, b, false)
+	if !a.Held() || b.Held() {
+		t.Fatalf("Held = %v, %v after a acquired, want true, false", a.Held(), b.Held())
+	}
+
+	// Renewing keeps it past the first expiry
+	now = now.Add(40 * time.Second)
+	mustAcquire(t, a, true)
+	now = now.Add(40 * time.Second)
+	mustAcquire(t, b, false)
+	if !a.Held() {
+		t.Error("a's renewed lease isn't held")
+	}
+}
+
+func TestLeaseTakenOverAfterExpiry(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	a, b := testLeases(t, &now)
+
+	mustAcquire(t, a, true)
+	now = now.Add(time.Minute)
+	if a.Held() {
+		t.Error("a's lease is held after expiring")
+	}
+	mustAcquire(t, b, true)
+	mustAcquire(t, a, false)
+	if a.Held() || !b.Held() {
+		t.Errorf("Held = %v, %v after b took over, want false, true", a.Held(), b.Held())
+	}
+}
+
+func TestLeaseRelease(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	a, b := testLeases(t, &now)
+
+	mustAcquire(t, a, true)
+	// Releasing a lease held by another does nothing
+	if err := b.Release(); err != nil {
+		t.Fatalf("b: Release: %v", err)
+	}
+	mustAcquire(t, b, false)
+
+	if err := a.Release(); err != nil {
+		t.Fatalf("a: Release: %v", err)
+	}
+	if a.Held() {
+		t.Error("a's lease is held after releasing it")
+	}
+	mustAcquire(t, b, true)
+}
+
+func TestLeaseStaleLock(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	a, _ := testLeases(t, &now)
+
+	// Left by an instance that died holding it
+	if err := ioutil.WriteFile(a.lockPath(), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * a.Duration)
+	if err := os.Chtimes(a.lockPath(), old, old); err != nil {
+		t.Fatal(err)
+	}
+	mustAcquire(t, a, true)
+	if _, err := os.Stat(a.lockPath()); !os.IsNotExist(err) {
+		t.Errorf("The lock file is still there: %v", err)
+	}
+}
+
+func TestLeaseInvalidFile(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	a, _ := testLeases(t, &now)
+
+	if err := ioutil.WriteFile(a.Path, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if held, err := a.Acquire(); err == nil || held {
+		t.Errorf("Acquire of an invalid lease file = %v, %v, want an error", held, err)
+	}
+}
+
+func TestNilLease(t *testing.T) {
+	var lease *Lease
+	if held, err := lease.Acquire(); err != nil || !held {
+		t.Errorf("Acquire of a nil lease = %v, %v, want true", held, err)
+	}
+	if !lease.Held() {
+		t.Error("A nil lease isn't held")
+	}
+	if err := lease.Release(); err != nil {
+		t.Errorf("Release of a nil lease: %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/nws"
+)
+
+// DefaultOfficeCacheFile is where the office list is cached when the config
+// doesn't say otherwise
+const DefaultOfficeCacheFile = "offices.json"
+
+// OfficeCacheTTL is how long the cached office list is used before it is
+// fetched again. Offices almost never change.
+const OfficeCacheTTL = 7 * 24 * time.Hour
+
+// LoadOffices returns the list of valid offices, from the cache file at path
+// if it is fresh enough and from the API otherwise. A stale cache is used if
+// the API can't be reached. Failing to write the cache is only logged, as
+// the list fetched is still good.
+func LoadOffices(ctx context.Context, client nws.API, path string, logger *slog.Logger) ([]nws.Office, error) {
+	var cached []nws.Office
+	info, statErr := os.Stat(path)
+	if statErr == nil {
+		data, err := ioutil.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(data, &cached)
+		}
+		if err == nil && time.Since(info.ModTime()) < OfficeCacheTTL {
+			return cached, nil
+		}
+	}
+
+	offices, err := client.ListOffices(ctx)
+	if err != nil {
+		if len(cached) > 0 {
+			return cached, nil
+		}
+		return nil, err
+	}
+	data, err := json.MarshalIndent(offices, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(path, data, 0644)
+	}
+	if err != nil {
+		logger.Warn("Couldn't cache the office list", "path", path, "err", err)
+	}
+	return offices, nil
+}
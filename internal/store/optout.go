@@ -0,0 +1,90 @@
+package store
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// DefaultOptOutFile is where the opt-out list is kept when the config doesn't
+// say otherwise
+const DefaultOptOutFile = "optouts.json"
+
+// OptOutList struct is a persistent set of phone numbers that must never be
+// texted
+type OptOutList struct {
+	Path string
+
+	mu      sync.Mutex
+	numbers map[string]bool
+}
+
+// LoadOptOutList reads the opt-out list at path. A missing file is an empty
+// list.
+func LoadOptOutList(path string) (*OptOutList, error) {
+	list := &OptOutList{
+		Path:    path,
+		numbers: make(map[string]bool),
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return list, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var numbers []string
+	if err := json.Unmarshal(data, &numbers); err != nil {
+		return nil, err
+	}
+	for _, number := range numbers {
+		list.numbers[number] = true
+	}
+	return list, nil
+}
+
+// Contains reports whether a number has opted out
+func (s *OptOutList) Contains(phone string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.numbers[phone]
+}
+
+// Add opts a number out and saves the list
+func (s *OptOutList) Add(phone string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.numbers[phone] {
+		return nil
+	}
+	s.numbers[phone] = true
+	return s.save()
+}
+
+// Remove opts a number back in and saves the list
+func (s *OptOutList) Remove(phone string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.numbers[phone] {
+		return nil
+	}
+	delete(s.numbers, phone)
+	return s.save()
+}
+
+func (s *OptOutList) save() error {
+	numbers := make([]string, 0, len(s.numbers))
+	for number := range s.numbers {
+		numbers = append(numbers, number)
+	}
+	data, err := json.MarshalIndent(numbers, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.Path)
+}
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// DefaultSentProductsFile is where the last product sent to each user for
+// each location is kept when the config doesn't say otherwise
+const DefaultSentProductsFile = "sent-products.json"
+
+// SentProducts struct is a persistent record of the last product, e.g. an
+// AFD, sent to each phone number for each location, so a product is sent
+// once however often it's polled. Its methods do nothing on a nil
+// *SentProducts.
+type SentProducts struct {
+	Path string
+
+	mu       sync.Mutex
+	products map[string]map[string]string
+}
+
+// LoadSentProducts reads the record at path. A missing file is an empty
+// record.
+func LoadSentProducts(path string) (*SentProducts, error) {
+	products := &SentProducts{
+		Path:     path,
+		products: make(map[string]map[string]string),
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return products, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &products.products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// Last returns the ID of the last product sent to a phone number for a
+// location, or "" if none has been
+func (s *SentProducts) Last(phone string, location string) string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.products[phone][location]
+}
+
+// Record saves id as the last product sent to a phone number for a location
+func (s *SentProducts) Record(phone string, location string, id string) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.products[phone] == nil {
+		s.products[phone] = make(map[string]string)
+	}
+	if s.products[phone][location] == id {
+		return nil
+	}
+	s.products[phone][location] = id
+	data, err := json.MarshalIndent(s.products, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.Path)
+}
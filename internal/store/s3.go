@@ -0,0 +1,91 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3State struct keeps the state files in an S3 bucket where the local disk
+// doesn't last between runs, as on AWS Lambda. Download fetches them before
+// a run and Upload saves them after it. Each file is kept under Prefix plus
+// its base name.
+type S3State struct {
+	Client *s3.Client
+	Bucket string
+	Prefix string
+}
+
+// NewS3State returns a state store for bucket using the default AWS
+// credential chain
+func NewS3State(ctx context.Context, bucket string, prefix string, httpClient *http.Client) (*S3State, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithHTTPClient(httpClient))
+	if err != nil {
+		return nil, err
+	}
+	return &S3State{Client: s3.NewFromConfig(cfg), Bucket: bucket, Prefix: prefix}, nil
+}
+
+// Download writes each file from the bucket to its path. Files not in the
+// bucket yet, as on the first run, are skipped.
+func (s *S3State) Download(ctx context.Context, paths ...string) error {
+	for _, path := range paths {
+		out, err := s.Client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(s.Bucket),
+			Key:    aws.String(s.key(path)),
+		})
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("Couldn't download s3://%s/%s: %w", s.Bucket, s.key(path), err)
+		}
+		data, err := ioutil.ReadAll(out.Body)
+		out.Body.Close()
+		if err != nil {
+			return fmt.Errorf("Couldn't download s3://%s/%s: %w", s.Bucket, s.key(path), err)
+		}
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Upload saves each file at paths to the bucket. Files that don't exist,
+// because nothing was written to them, are skipped.
+func (s *S3State) Upload(ctx context.Context, paths ...string) error {
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		_, err = s.Client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(s.Bucket),
+			Key:    aws.String(s.key(path)),
+			Body:   bytes.NewReader(data),
+		})
+		if err != nil {
+			return fmt.Errorf("Couldn't upload s3://%s/%s: %w", s.Bucket, s.key(path), err)
+		}
+	}
+	return nil
+}
+
+func (s *S3State) key(path string) string {
+	return s.Prefix + filepath.Base(path)
+}
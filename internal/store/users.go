@@ -0,0 +1,59 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+)
+
+// ErrUsersNotJSON is returned when adding to a YAML or TOML users file,
+// which rewriting would strip of its comments and formatting
+var ErrUsersNotJSON = errors.New("Users can only be added to a JSON users file")
+
+// UserStore struct adds users to the users file, as the init command and the
+// admin API's signup do. Users are otherwise only read.
+type UserStore struct {
+	// Path is the users file as given, found with config.FindFile
+	Path string
+
+	mu sync.Mutex
+}
+
+// Add appends user to the users file, creating it if needed, with the ID
+// after the highest existing one, and returns the user as saved
+func (s *UserStore) Add(user config.User) (config.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := config.FindFile(s.Path)
+	if strings.ToLower(filepath.Ext(path)) != ".json" {
+		return user, ErrUsersNotJSON
+	}
+
+	var users config.Users
+	if err := config.LoadFile(path, &users); err != nil && !os.IsNotExist(err) {
+		return user, err
+	}
+	user.ID = 1
+	for _, existing := range users.Users {
+		if existing.ID >= user.ID {
+			user.ID = existing.ID + 1
+		}
+	}
+	users.Users = append(users.Users, user)
+
+	data, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return user, err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return user, err
+	}
+	return user, os.Rename(tmp, path)
+}
@@ -0,0 +1,43 @@
+package store
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+)
+
+func TestUserStoreAdd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	users := &UserStore{Path: path}
+	first, err := users.Add(config.User{FirstName: "Pat", Phone: "+15035550100", LocationID: "PQR", Subscriptions: []string{"SHORT TERM"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := users.Add(config.User{ID: 1, FirstName: "Sam", Phone: "+16175550100", ZIPCode: "02134", Subscriptions: []string{"SYNOPSIS"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID != 1 || second.ID != 2 {
+		t.Errorf("Added users with IDs %d and %d, want 1 and 2", first.ID, second.ID)
+	}
+
+	var saved config.Users
+	if err := config.LoadFile(path, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Users) != 2 || saved.Users[1].ZIPCode != "02134" {
+		t.Errorf("Saved %+v", saved.Users)
+	}
+}
+
+func TestUserStoreAddToYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.yaml")
+	if err := ioutil.WriteFile(path, []byte("# Subscribers\nusers: []\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&UserStore{Path: path}).Add(config.User{FirstName: "Pat"}); err != ErrUsersNotJSON {
+		t.Errorf("Adding to a YAML users file returned %v, want ErrUsersNotJSON", err)
+	}
+}
@@ -0,0 +1,142 @@
+package telemetry
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DebugBodyLimit is how much of each request and response body --debug logs
+const DebugBodyLimit = 64 * 1024
+
+// redacted replaces credentials in debug logs
+const redacted = "REDACTED"
+
+// sensitiveName matches the names of headers, form fields, query parameters
+// and JSON keys whose values are credentials
+var sensitiveName = regexp.MustCompile(`(?i)(auth|token|secret|password|signature|api[_-]?key|credential|cookie)`)
+
+// sensitiveJSON matches a JSON string value with a sensitive key
+var sensitiveJSON = regexp.MustCompile(`("[^"]*(?i:auth|token|secret|password|signature|api_?key|credential)[^"]*"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+// debugTransport struct logs every request and response in full, with
+// credentials redacted, for --debug
+type debugTransport struct {
+	next   http.RoundTripper
+	logger *slog.Logger
+}
+
+// NewDebugTransport wraps next to log each request's method, URL, headers
+// and body, and each response's status, headers and body, at debug level
+func NewDebugTransport(next http.RoundTripper, logger *slog.Logger) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &debugTransport{next: next, logger: logger}
+}
+
+func (s *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			reqBody, _ = ioutil.ReadAll(body)
+			body.Close()
+		}
+	}
+	s.logger.Debug("HTTP request",
+		"method", req.Method,
+		"url", redactURL(req.URL),
+		"headers", redactHeaders(req.Header),
+		"body", redactBody(reqBody, req.Header.Get("Content-Type")))
+
+	start := time.Now()
+	resp, err := s.next.RoundTrip(req)
+	if err != nil {
+		s.logger.Debug("HTTP request failed", "method", req.Method, "url", redactURL(req.URL), "duration", time.Since(start), "err", err)
+		return resp, err
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+	if err != nil {
+		return resp, err
+	}
+	logged := respBody
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		if reader, err := gzip.NewReader(bytes.NewReader(respBody)); err == nil {
+			logged, _ = ioutil.ReadAll(reader)
+		}
+	}
+	s.logger.Debug("HTTP response",
+		"method", req.Method,
+		"url", redactURL(req.URL),
+		"status", resp.StatusCode,
+		"duration", time.Since(start),
+		"headers", redactHeaders(resp.Header),
+		"body", redactBody(logged, resp.Header.Get("Content-Type")))
+	return resp, nil
+}
+
+// redactURL returns u without its password or sensitive query parameters
+func redactURL(u *url.URL) string {
+	copied := *u
+	if _, ok := copied.User.Password(); ok {
+		copied.User = url.UserPassword(copied.User.Username(), redacted)
+	}
+	if copied.RawQuery != "" {
+		copied.RawQuery = redactValues(copied.Query()).Encode()
+	}
+	return copied.String()
+}
+
+func redactHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string, len(header))
+	for name, values := range header {
+		value := strings.Join(values, ", ")
+		if sensitiveName.MatchString(name) {
+			value = redacted
+		}
+		headers[name] = value
+	}
+	return headers
+}
+
+func redactValues(values url.Values) url.Values {
+	redactedValues := make(url.Values, len(values))
+	for name, list := range values {
+		if sensitiveName.MatchString(name) {
+			redactedValues[name] = []string{redacted}
+			continue
+		}
+		redactedValues[name] = list
+	}
+	return redactedValues
+}
+
+// redactBody returns a form or JSON body with its credentials replaced,
+// truncated to DebugBodyLimit
+func redactBody(body []byte, contentType string) string {
+	if len(body) == 0 {
+		return ""
+	}
+	text := string(body)
+	switch {
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
+		if values, err := url.ParseQuery(text); err == nil {
+			text = redactValues(values).Encode()
+		}
+	case strings.Contains(contentType, "json"):
+		text = sensitiveJSON.ReplaceAllString(text, `${1}"`+redacted+`"`)
+	}
+	if len(text) > DebugBodyLimit {
+		text = text[:DebugBodyLimit] + "...(truncated)"
+	}
+	return text
+}
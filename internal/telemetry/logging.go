@@ -0,0 +1,48 @@
+// Package telemetry sets up logging, metrics, tracing and error reporting.
+package telemetry
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+)
+
+// NewLogger returns a logger writing to w at the config's LogLevel, "info"
+// by default, as text or, with LogFormat "json", as JSON lines for log
+// aggregation
+func NewLogger(config config.Config, w io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	if config.LogLevel != "" {
+		if err := level.UnmarshalText([]byte(config.LogLevel)); err != nil {
+			return nil, errors.New("Invalid logLevel " + config.LogLevel)
+		}
+	}
+	options := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(config.LogFormat) {
+	case "", "text":
+		handler = slog.NewTextHandler(w, options)
+	case "json":
+		handler = slog.NewJSONHandler(w, options)
+	default:
+		return nil, errors.New("Unknown logFormat " + config.LogFormat)
+	}
+	if config.SentryDSN != "" {
+		handler = &sentryHandler{next: handler}
+	}
+	return slog.New(handler), nil
+}
+
+// Fatal logs msg at error level with the key-value pairs in args and exits,
+// once the error has reached Sentry if it's set up
+func Fatal(msg string, args ...interface{}) {
+	slog.Error(msg, args...)
+	sentry.Flush(SentryFlushTimeout)
+	os.Exit(1)
+}
@@ -0,0 +1,233 @@
+package telemetry
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/events"
+)
+
+// DefaultDurationBuckets are the upper bounds, in seconds, of the request
+// duration histograms
+var DefaultDurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Metrics struct counts what the pipeline does, served in the Prometheus
+// text format for operators to graph and alert on. Its methods do nothing on
+// a nil *Metrics, so it's optional wherever it's used.
+type Metrics struct {
+	NWSRequests         *Metric
+	NWSRequestDuration  *Metric
+	NWSRetries          *Metric
+	ProductsFetched     *Metric
+	Issuances           *Metric
+	NotificationsSent   *Metric
+	NotificationsFailed *Metric
+	SMSSegments         *Metric
+	SMSRetries          *Metric
+}
+
+// NewMetrics returns the pipeline's metrics, all zero
+func NewMetrics() *Metrics {
+	return &Metrics{
+		NWSRequests:         newMetric("nws_requests_total", "NWS API requests by HTTP status, 0 for network errors.", "counter", "status"),
+		NWSRequestDuration:  newMetric("nws_request_duration_seconds", "NWS API request latency.", "histogram"),
+		NWSRetries:          newMetric("nws_retries_total", "NWS API requests retried.", "counter"),
+		ProductsFetched:     newMetric("afd_products_fetched_total", "Area forecast discussions fetched by office.", "counter", "office"),
+		Issuances:           newMetric("afd_issuances_total", "New area forecast discussions seen by office.", "counter", "office"),
+		NotificationsSent:   newMetric("notifications_sent_total", "Messages sent by channel.", "counter", "channel"),
+		NotificationsFailed: newMetric("notifications_failed_total", "Messages that couldn't be sent by channel.", "counter", "channel"),
+		SMSSegments:         newMetric("sms_segments_total", "SMS segments sent by channel.", "counter", "channel"),
+		SMSRetries:          newMetric("sms_retries_total", "Sends retried after a temporary error by channel.", "counter", "channel"),
+	}
+}
+
+// ObserveNWSRequest records an NWS request, with status 0 if it failed
+// without a response
+func (s *Metrics) ObserveNWSRequest(status int, duration time.Duration) {
+	if s == nil {
+		return
+	}
+	s.NWSRequests.Add(1, strconv.Itoa(status))
+	s.NWSRequestDuration.Observe(duration.Seconds())
+}
+
+// NWSRetried records a retried NWS request
+func (s *Metrics) NWSRetried() {
+	if s != nil {
+		s.NWSRetries.Add(1)
+	}
+}
+
+// ProductFetched records a discussion fetched for an office
+func (s *Metrics) ProductFetched(office string) {
+	if s != nil {
+		s.ProductsFetched.Add(1, office)
+	}
+}
+
+// MessageSent records a message sent through a channel
+func (s *Metrics) MessageSent(channel string, segments int) {
+	if s != nil {
+		s.NotificationsSent.Add(1, channel)
+		s.SMSSegments.Add(float64(segments), channel)
+	}
+}
+
+// MessageFailed records a message that couldn't be sent through a channel
+func (s *Metrics) MessageFailed(channel string) {
+	if s != nil {
+		s.NotificationsFailed.Add(1, channel)
+	}
+}
+
+// HandleEvent counts new issuances and failed sends, for subscribing to the
+// runner's events
+func (s *Metrics) HandleEvent(event interface{}) {
+	if s == nil {
+		return
+	}
+	switch event := event.(type) {
+	case events.NewIssuance:
+		s.Issuances.Add(1, event.Office)
+	case events.SendFailed:
+		s.MessageFailed(event.Sink)
+	}
+}
+
+// MessageRetried records a send retried after a temporary error
+func (s *Metrics) MessageRetried(channel string) {
+	if s != nil {
+		s.SMSRetries.Add(1, channel)
+	}
+}
+
+// ServeHTTP writes every metric in the Prometheus text format
+func (s *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, metric := range []*Metric{
+		s.NWSRequests, s.NWSRequestDuration, s.NWSRetries, s.ProductsFetched, s.Issuances,
+		s.NotificationsSent, s.NotificationsFailed, s.SMSSegments, s.SMSRetries,
+	} {
+		metric.write(w)
+	}
+}
+
+// Metric struct is a counter or histogram, with a series for each set of
+// label values
+type Metric struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// series struct is the value of a metric for one set of label values
+type series struct {
+	labels []string
+	value  float64
+	// For histograms, counts per bucket of DefaultDurationBuckets
+	buckets []uint64
+	count   uint64
+}
+
+func newMetric(name string, help string, kind string, labels ...string) *Metric {
+	return &Metric{name: name, help: help, kind: kind, labels: labels, series: make(map[string]*series)}
+}
+
+// Add adds value to the counter with the given label values
+func (s *Metric) Add(value float64, labels ...string) {
+	s.mu.Lock()
+	s.get(labels).value += value
+	s.mu.Unlock()
+}
+
+// Observe records a value in the histogram with the given label values
+func (s *Metric) Observe(value float64, labels ...string) {
+	s.mu.Lock()
+	series := s.get(labels)
+	series.value += value
+	series.count++
+	for i, bound := range DefaultDurationBuckets {
+		if value <= bound {
+			series.buckets[i]++
+		}
+	}
+	s.mu.Unlock()
+}
+
+func (s *Metric) get(labels []string) *series {
+	key := strings.Join(labels, "\x00")
+	found, ok := s.series[key]
+	if !ok {
+		found = &series{labels: labels}
+		if s.kind == "histogram" {
+			found.buckets = make([]uint64, len(DefaultDurationBuckets))
+		}
+		s.series[key] = found
+	}
+	return found
+}
+
+func (s *Metric) write(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", s.name, s.help, s.name, s.kind)
+
+	keys := make([]string, 0, len(s.series))
+	for key := range s.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		series := s.series[key]
+		labels := s.labelPairs(series.labels)
+		if s.kind != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", s.name, formatLabels(labels), formatValue(series.value))
+			continue
+		}
+		for i, bound := range DefaultDurationBuckets {
+			bucket := append(labels[:len(labels):len(labels)], "le", formatValue(bound))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", s.name, formatLabels(bucket), series.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", s.name, formatLabels(append(labels[:len(labels):len(labels)], "le", "+Inf")), series.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", s.name, formatLabels(labels), formatValue(series.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", s.name, formatLabels(labels), series.count)
+	}
+}
+
+// labelPairs returns the label names and values alternately
+func (s *Metric) labelPairs(values []string) []string {
+	var pairs []string
+	for i, name := range s.labels {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs = append(pairs, name, value)
+	}
+	return pairs
+}
+
+func formatLabels(pairs []string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	var parts []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, pairs[i]+"="+strconv.Quote(pairs[i+1]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,101 @@
+package telemetry
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/johnwcallahan/forecast-discussion-alerts/internal/config"
+)
+
+// SentryFlushTimeout is how long to wait for events to reach Sentry before
+// exiting
+const SentryFlushTimeout = 2 * time.Second
+
+// InitSentry starts reporting errors to the config's SentryDSN, if it's set.
+// The SDK reads SENTRY_ENVIRONMENT and SENTRY_RELEASE from the environment.
+func InitSentry(config config.Config) error {
+	if config.SentryDSN == "" {
+		return nil
+	}
+	return sentry.Init(sentry.ClientOptions{
+		Dsn:              config.SentryDSN,
+		AttachStacktrace: true,
+	})
+}
+
+// ReportPanic reports a panic to Sentry, waits for it to be sent and panics
+// again. It's deferred by main.
+func ReportPanic() {
+	if r := recover(); r != nil {
+		sentry.CurrentHub().Recover(r)
+		sentry.Flush(SentryFlushTimeout)
+		panic(r)
+	}
+}
+
+// sentryHandler struct reports records at error level and above to Sentry,
+// with their attributes as context, before passing every record on
+type sentryHandler struct {
+	next  slog.Handler
+	attrs []slog.Attr
+}
+
+func (s *sentryHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return s.next.Enabled(ctx, level)
+}
+
+func (s *sentryHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelError {
+		extras := make(map[string]interface{})
+		var err error
+		collect := func(attr slog.Attr) bool {
+			value := attr.Value.Resolve().Any()
+			if e, ok := value.(error); ok && attr.Key == "err" {
+				err = e
+				value = e.Error()
+			}
+			extras[attr.Key] = value
+			return true
+		}
+		for _, attr := range s.attrs {
+			collect(attr)
+		}
+		r.Attrs(collect)
+
+		sentry.WithScope(func(scope *sentry.Scope) {
+			scope.SetContext("log", extras)
+			if err != nil {
+				// Keep the message, which says what we were doing
+				sentry.CaptureException(&loggedError{msg: r.Message, err: err})
+			} else {
+				sentry.CaptureMessage(r.Message)
+			}
+		})
+	}
+	return s.next.Handle(ctx, r)
+}
+
+func (s *sentryHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &sentryHandler{next: s.next.WithAttrs(attrs), attrs: append(s.attrs[:len(s.attrs):len(s.attrs)], attrs...)}
+}
+
+func (s *sentryHandler) WithGroup(name string) slog.Handler {
+	return &sentryHandler{next: s.next.WithGroup(name), attrs: s.attrs}
+}
+
+// loggedError struct is an error logged with a message, reported to Sentry
+// as "message: error"
+type loggedError struct {
+	msg string
+	err error
+}
+
+func (e *loggedError) Error() string {
+	return e.msg + ": " + e.err.Error()
+}
+
+func (e *loggedError) Unwrap() error {
+	return e.err
+}
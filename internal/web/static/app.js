@@ -0,0 +1,171 @@
+"use strict";
+
+// The token is kept for the tab only, and sent to the admin API as a bearer
+// token. The API is found relative to the page, served at /ui/.
+const tokenKey = "adminToken";
+const api = "../admin/";
+
+const $ = (id) => document.getElementById(id);
+
+async function call(method, path, data) {
+  const headers = { Authorization: "Bearer " + sessionStorage.getItem(tokenKey) };
+  if (data !== undefined) {
+    headers["Content-Type"] = "application/json";
+  }
+  const response = await fetch(api + path, {
+    method,
+    headers,
+    body: data === undefined ? undefined : JSON.stringify(data),
+  });
+  const body = await response.json().catch(() => ({}));
+  if (response.status === 401) {
+    signOut();
+  }
+  if (!response.ok) {
+    throw new Error(body.error || response.statusText);
+  }
+  return body;
+}
+
+function setStatus(text, isError) {
+  $("status").textContent = text;
+  $("status").classList.toggle("error", Boolean(isError));
+}
+
+function showReport(report) {
+  const rows = [
+    ["Started", new Date(report.started).toLocaleString()],
+    ["Duration", report.durationSeconds.toFixed(1) + "s"],
+    ["Users matched", report.usersMatched + " of " + report.users],
+    ["Messages sent", report.messagesSent],
+    ["Messages scheduled", report.messagesScheduled],
+    ["Failures", (report.failures || []).length + Object.keys(report.fetchFailures || {}).length],
+  ];
+  if (report.standby) {
+    rows.splice(1, rows.length - 1, ["Standby", "Another instance is the leader"]);
+  }
+  $("report").replaceChildren(
+    ...rows.flatMap(([name, value]) => {
+      const dt = document.createElement("dt");
+      const dd = document.createElement("dd");
+      dt.textContent = name;
+      dd.textContent = value;
+      return [dt, dd];
+    }),
+  );
+
+  const failures = Object.entries(report.fetchFailures || {}).map(
+    ([office, reason]) => "Office " + office + ": " + reason,
+  );
+  if (report.error) {
+    failures.unshift("Run failed: " + report.error);
+  }
+  for (const failure of report.failures || []) {
+    failures.push("User " + failure.user + " (" + failure.office + "): " + failure.reason);
+  }
+  $("failures").replaceChildren(
+    ...failures.map((text) => {
+      const li = document.createElement("li");
+      li.textContent = text;
+      return li;
+    }),
+  );
+}
+
+function showUsers(users) {
+  $("users").replaceChildren(
+    ...users.map((user) => {
+      const tr = document.createElement("tr");
+      for (const value of [user.id, user.firstName, user.locationId, user.subscriptions.join(", "), user.source || ""]) {
+        const td = document.createElement("td");
+        td.textContent = value;
+        tr.append(td);
+      }
+      return tr;
+    }),
+  );
+}
+
+async function refresh() {
+  try {
+    const { users } = await call("GET", "users");
+    showUsers(users);
+    setStatus("");
+  } catch (err) {
+    setStatus(err.message, true);
+    return;
+  }
+  try {
+    showReport(await call("GET", "report"));
+  } catch (err) {
+    $("report").replaceChildren();
+    $("failures").replaceChildren();
+    setStatus(err.message);
+  }
+}
+
+function signIn(token) {
+  sessionStorage.setItem(tokenKey, token);
+  $("login").hidden = true;
+  $("logout").hidden = false;
+  $("admin").hidden = false;
+  refresh();
+}
+
+function signOut() {
+  sessionStorage.removeItem(tokenKey);
+  $("login").hidden = false;
+  $("logout").hidden = true;
+  $("admin").hidden = true;
+}
+
+$("login").addEventListener("submit", (event) => {
+  event.preventDefault();
+  signIn($("token").value);
+  $("token").value = "";
+});
+
+$("logout").addEventListener("click", signOut);
+
+$("refresh").addEventListener("click", refresh);
+
+$("run").addEventListener("click", async () => {
+  try {
+    const { status } = await call("POST", "run");
+    setStatus(status + ", refresh to see the report when it's done");
+  } catch (err) {
+    setStatus(err.message, true);
+  }
+});
+
+$("reload").addEventListener("click", async () => {
+  try {
+    const { status, users } = await call("POST", "reload");
+    setStatus(status + ", " + users + " users");
+    refresh();
+  } catch (err) {
+    setStatus(err.message, true);
+  }
+});
+
+$("signup").addEventListener("submit", async (event) => {
+  event.preventDefault();
+  const form = event.target;
+  const fields = Object.fromEntries(new FormData(form));
+  fields.subscriptions = fields.subscriptions
+    .split(",")
+    .map((name) => name.trim())
+    .filter(Boolean);
+  try {
+    const user = await call("POST", "users", fields);
+    form.reset();
+    setStatus("Signed up " + user.firstName + " as user " + user.id);
+    refresh();
+  } catch (err) {
+    setStatus(err.message, true);
+  }
+});
+
+if (sessionStorage.getItem(tokenKey)) {
+  signIn(sessionStorage.getItem(tokenKey));
+}
@@ -0,0 +1,33 @@
+// Package web serves the admin UI, a page over the admin API for viewing
+// the users and the last run, starting runs and reloads, and signing up
+// users. Its assets are embedded, so the binary needs no asset directory
+// alongside it.
+//
+// Signing up is for the admin, behind the admin token, rather than a public
+// page, so no one can subscribe a number that isn't theirs. New users are
+// added to the users file, which must be JSON, and take effect right away.
+package web
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// Handler serves the UI's assets. Mount it under a prefix with
+// http.StripPrefix.
+func Handler() http.Handler {
+	// static is always there, it's embedded
+	assets, _ := fs.Sub(static, "static")
+	files := http.FileServer(http.FS(assets))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The page only talks to the admin API, so nothing else may load
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		files.ServeHTTP(w, r)
+	})
+}
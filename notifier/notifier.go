@@ -0,0 +1,113 @@
+// Package notifier defines what an SMS gateway implements to send forecast
+// discussion alerts, and the errors and limits gateways share. It's part of
+// the public API described in package nws.
+package notifier
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// MaxSMSLength is the maximum body length Twilio accepts for a single message
+const MaxSMSLength = 1600
+
+// ErrUnsubscribed is returned when sending to a number that has opted out
+var ErrUnsubscribed = errors.New("Recipient has unsubscribed")
+
+// ErrSchedulingUnsupported is returned when the provider can't schedule
+// messages with the current config
+var ErrSchedulingUnsupported = errors.New("Provider can't schedule messages")
+
+// Provider is implemented by each SMS gateway
+type Provider interface {
+	// SendSMS sends a message and returns the ID the provider assigned to it
+	SendSMS(ctx context.Context, to string, body string) (string, error)
+}
+
+// MMSProvider is implemented by providers that can attach images
+type MMSProvider interface {
+	SendMMS(ctx context.Context, to string, body string, mediaURL string) (string, error)
+}
+
+// SchedulingProvider is implemented by providers that can hold a message
+// and deliver it later, so the sender doesn't have to be running at delivery
+// time
+type SchedulingProvider interface {
+	ScheduleMMS(ctx context.Context, to string, body string, mediaURL string, sendAt time.Time) (string, error)
+}
+
+// Sender sends messages on top of a provider, e.g. skipping opted out
+// numbers and retrying temporary errors. SendMMS sends a plain SMS if
+// mediaURL is empty, and Schedule returns ErrSchedulingUnsupported if the
+// provider can't schedule.
+type Sender interface {
+	Send(ctx context.Context, to string, body string) (string, error)
+	SendMMS(ctx context.Context, to string, body string, mediaURL string) (string, error)
+	Schedule(ctx context.Context, to string, body string, mediaURL string, sendAt time.Time) (string, error)
+}
+
+// IsTemporary reports whether err is a provider error that may succeed if
+// retried. Providers mark such errors with a Temporary() bool method.
+func IsTemporary(err error) bool {
+	var temporary interface{ Temporary() bool }
+	return errors.As(err, &temporary) && temporary.Temporary()
+}
+
+// IsMisconfigured reports whether err is a provider error caused by the
+// sender's own config, in which case every other send will fail too.
+// Providers mark such errors with a Misconfigured() bool method.
+func IsMisconfigured(err error) bool {
+	var misconfigured interface{ Misconfigured() bool }
+	return errors.As(err, &misconfigured) && misconfigured.Misconfigured()
+}
+
+// gsm7Chars holds the GSM 03.38 basic character set. gsm7ExtChars need an
+// escape character and so take up two characters of a segment.
+const (
+	gsm7Chars    = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsm7ExtChars = "^{}\\[~]|€\f"
+)
+
+// IsGSM7 reports whether body can be sent in the GSM 7-bit alphabet, rather
+// than UCS-2 with its shorter segments
+func IsGSM7(body string) bool {
+	for _, r := range body {
+		if !strings.ContainsRune(gsm7Chars, r) && !strings.ContainsRune(gsm7ExtChars, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// CountSegments returns the number of SMS segments a body is billed as
+func CountSegments(body string) int {
+	length := 0
+	for _, r := range body {
+		if strings.ContainsRune(gsm7ExtChars, r) {
+			length += 2
+		} else {
+			length++
+		}
+	}
+
+	single, multi := 160, 153
+	if !IsGSM7(body) {
+		// UCS-2 encoding counts UTF-16 code units
+		length = 0
+		for _, r := range body {
+			if r > 0xFFFF {
+				length += 2
+			} else {
+				length++
+			}
+		}
+		single, multi = 70, 67
+	}
+
+	if length <= single {
+		return 1
+	}
+	return (length + multi - 1) / multi
+}
@@ -0,0 +1,276 @@
+package nws
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// sectionHeadingRe matches the line starting each section, e.g.
+// ".SHORT TERM /Tonight through Saturday/...". The heading runs up to the
+// first "..." and the section text may start on the same line.
+var sectionHeadingRe = regexp.MustCompile(`(?m)^\.([A-Za-z][^\n]*?)\.\.\.`)
+
+// timePeriodRe matches the period a section covers, e.g. " /Tonight through
+// Saturday/", but not the slashes in "WATCHES/WARNINGS/ADVISORIES"
+var timePeriodRe = regexp.MustCompile(`\s+/.*$`)
+
+// sectionEndRe matches the "&&" and "$$" that end a section, usually on a
+// line of their own but sometimes after the last sentence
+var sectionEndRe = regexp.MustCompile(`(?m)(^|\s)(&&|\$\$)\s*$`)
+
+// sectionAliases groups the headings different offices use for the same kind
+// of section. A subscription to any name in a group matches whichever of them
+// the office uses.
+var sectionAliases = [][]string{
+	{"SHORT TERM", "NEAR TERM", "SHORT RANGE"},
+	{"LONG TERM", "EXTENDED", "LONG RANGE", "EXTENDED FORECAST"},
+	{"DISCUSSION", "SYNOPSIS", "OVERVIEW", "FORECAST DISCUSSION"},
+	{"AVIATION", "AVIATION DISCUSSION"},
+	{"MARINE", "MARINE DISCUSSION"},
+	{"FIRE WEATHER", "FIRE WEATHER DISCUSSION"},
+	{"WATCHES/WARNINGS/ADVISORIES", "WARNINGS/ADVISORIES"},
+}
+
+// commonSections are other section names used by many offices
+var commonSections = []string{
+	"KEY MESSAGES", "UPDATE", "HYDROLOGY", "CLIMATE", "TROPICAL", "EQUIPMENT",
+	"TIDES/COASTAL FLOODING", "COASTAL FLOODING", "BEACHES", "AIR QUALITY",
+	"PRELIMINARY POINT TEMPS", HeadlinesSection,
+}
+
+// IsCommonSection reports whether name, or one of its built-in or given
+// aliases, is a section name used by many offices. Offices can name sections
+// however they like, so a name that isn't common may still be valid.
+func IsCommonSection(name string, aliases map[string][]string) bool {
+	afd := AFD{Aliases: aliases}
+	for _, alias := range afd.sectionNameAliases(NormalizeSectionName(name)) {
+		if containsName(commonSections, alias) {
+			return true
+		}
+		for _, group := range sectionAliases {
+			if containsName(group, alias) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NormalizeSectionName returns the form of a section name used for matching,
+// so "short_term", "Short-Term" and "SHORT TERM" are the same section
+func NormalizeSectionName(name string) string {
+	// Hyphens between words, but not in ranges like "DAYS 3-7". A loop
+	// rather than a regexp, since matches of "X-X" can't overlap and would
+	// miss the second hyphen in "A-B-C".
+	b := []byte(strings.Replace(name, "_", " ", -1))
+	for i := 1; i+1 < len(b); i++ {
+		if b[i] == '-' && isLetter(b[i-1]) && isLetter(b[i+1]) {
+			b[i] = ' '
+		}
+	}
+	name = string(b)
+	return strings.ToUpper(strings.Join(strings.Fields(name), " "))
+}
+
+// isLetter reports whether c is an ASCII letter
+func isLetter(c byte) bool {
+	return 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z'
+}
+
+// sectionNameAliases returns the names that a subscription to name matches,
+// name itself first
+func (s *AFD) sectionNameAliases(name string) []string {
+	keys := make([]string, 0, len(s.Aliases))
+	for key := range s.Aliases {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	groups := sectionAliases
+	for _, key := range keys {
+		group := []string{NormalizeSectionName(key)}
+		for _, alias := range s.Aliases[key] {
+			group = append(group, NormalizeSectionName(alias))
+		}
+		groups = append(groups[:len(groups):len(groups)], group)
+	}
+
+	// Groups sharing a name are merged, so an alias of "EXTENDED" is also
+	// an alias of "LONG TERM"
+	names := []string{name}
+	for grew := true; grew; {
+		grew = false
+		for _, group := range groups {
+			if !sharesName(group, names) {
+				continue
+			}
+			for _, alias := range group {
+				if !containsName(names, alias) {
+					names = append(names, alias)
+					grew = true
+				}
+			}
+		}
+	}
+	return names
+}
+
+func sharesName(a []string, b []string) bool {
+	for _, name := range a {
+		if containsName(b, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Section struct is one section of an Area Forecast Discussion
+type Section struct {
+	// Name is the upper-cased heading without any "/.../" time period, e.g.
+	// "SHORT TERM"
+	Name string
+	// Heading is the heading as written, e.g. "SHORT TERM /Tonight through
+	// Saturday/"
+	Heading string
+	// Body is the unformatted text of the section
+	Body string
+	// Issued is the time the section was written if the office gives one in
+	// the heading or at the start of the text, e.g. "415 AM PDT"
+	Issued string
+	// Parts splits Body into any update and the previous discussion
+	Parts []SectionPart
+}
+
+// AFD struct is an Area Forecast Discussion split into its sections, in the
+// order they appear in the product
+type AFD struct {
+	// WMOHeader and AWIPSID are the identifying lines at the top of the
+	// product, e.g. "FXUS66 KPQR 151030" and "AFDPQR"
+	WMOHeader string
+	AWIPSID   string
+	// Header is the text between those and the first section: the product
+	// name, office and issuance time
+	Header string
+	// Signatures are the forecasters who signed the discussion
+	Signatures []Signature
+	// Aliases adds to the built-in section aliases, mapping a section name
+	// to other headings that should match it, e.g. "SHORT TERM" to "DAY 1"
+	Aliases map[string][]string
+
+	sections []Section
+	index    map[string]int
+}
+
+// ParseAFD splits the text of an Area Forecast Discussion into sections
+func ParseAFD(text string) *AFD {
+	afd := &AFD{index: make(map[string]int)}
+	afd.WMOHeader, afd.AWIPSID, text = StripWMOHeader(NormalizeProductText(text))
+
+	headings := sectionHeadingRe.FindAllStringSubmatchIndex(text, -1)
+	if len(headings) == 0 {
+		afd.Header = strings.TrimSpace(text)
+		return afd
+	}
+	afd.Header = strings.TrimSpace(text[:headings[0][0]])
+	afd.Signatures = parseSignatures(text)
+
+	for i, loc := range headings {
+		end := len(text)
+		if i+1 < len(headings) {
+			end = headings[i+1][0]
+		}
+		body := text[loc[1]:end]
+		if stop := sectionEndRe.FindStringIndex(body); stop != nil {
+			body = body[:stop[0]]
+		}
+
+		heading := strings.TrimSpace(text[loc[2]:loc[3]])
+		name := NormalizeSectionName(timePeriodRe.ReplaceAllString(heading, ""))
+
+		// The first of any repeated sections wins, as with the old regex
+		if _, ok := afd.index[name]; !ok {
+			afd.index[name] = len(afd.sections)
+		}
+		section := Section{
+			Name:    name,
+			Heading: heading,
+			Body:    strings.TrimSpace(body),
+			Issued:  findIssued(heading),
+		}
+		section.Parts = parseSectionParts(section.Body)
+		if section.Issued == "" && len(section.Parts) > 0 && section.Parts[0].Label == "" {
+			section.Issued = section.Parts[0].Issued
+		}
+		afd.sections = append(afd.sections, section)
+	}
+	return afd
+}
+
+// AFD parses the product text as an Area Forecast Discussion
+func (s *Product) AFD() *AFD {
+	return ParseAFD(s.ProductText)
+}
+
+// Section returns the section with the given name, ignoring case. If the
+// office doesn't use that heading, a section under one of its aliases, e.g.
+// "NEAR TERM" for "SHORT TERM", is returned instead. Headings prefixed with
+// the office ID, e.g. "PQR WATCHES/WARNINGS/ADVISORIES", match without it.
+func (s *AFD) Section(name string) (Section, bool) {
+	aliases := s.sectionNameAliases(NormalizeSectionName(name))
+	for _, alias := range aliases {
+		if i, ok := s.index[alias]; ok {
+			return s.sections[i], true
+		}
+	}
+	// Match "/" and spaces alike, so "watches_warnings_advisories" works too
+	key := strings.NewReplacer("/", " ")
+	for _, alias := range aliases {
+		alias = key.Replace(alias)
+		for _, section := range s.sections {
+			name := key.Replace(section.Name)
+			if name == alias || strings.HasSuffix(name, " "+alias) {
+				return section, true
+			}
+		}
+	}
+	return Section{}, false
+}
+
+// Sections returns the names of the sections in this issuance, in the order
+// they appear. Offices don't all issue the same sections, and some only
+// include a section in some issuances.
+func (s *AFD) Sections() []string {
+	names := make([]string, 0, len(s.index))
+	for i, section := range s.sections {
+		// Skip repeats of a section, which Section never returns
+		if s.index[section.Name] == i {
+			names = append(names, section.Name)
+		}
+	}
+	return names
+}
+
+// GetDiscussionSection gets a section of the forecast discussion, cleaned up
+// and formatted for sending
+func (s *AFD) GetDiscussionSection(sectionName string) (string, error) {
+	section, ok := s.Section(sectionName)
+	if !ok {
+		return "", errors.New("No section of type " + NormalizeSectionName(sectionName) + " found")
+	}
+	name := section.Name
+	if section.Issued != "" {
+		name += " (issued " + section.Issued + ")"
+	}
+	return formatDiscussionItem(name, formatSectionParts(section.Parts)), nil
+}
@@ -0,0 +1,228 @@
+package nws
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/afd")
+
+var fetch = flag.Bool("fetch", false, "save the latest AFD of each of archiveOffices from the IEM archive to testdata/afd/archive, and rewrite their golden files")
+
+// fixtureGlob matches the AFDs the tests parse. They're nwstest's fixtures,
+// kept there so nwstest can embed them.
+var fixtureGlob = filepath.Join("nwstest", "fixtures", "*.txt")
+
+// archiveDir holds real AFDs saved from the IEM archive, next to their
+// golden files
+var archiveDir = filepath.Join("testdata", "afd", "archive")
+
+// archiveOffices are the offices -fetch saves, chosen to cover each region's
+// formats: segmented and unsegmented, key messages, marine and fire weather
+// sections, Alaska, the Pacific and the Caribbean
+var archiveOffices = []string{
+	"BOX", "OKX", "LWX", "CTP", "MFL", "TBW", "BMX", "LIX", "HGX", "FWD",
+	"OUN", "LOT", "DTX", "MPX", "OAX", "BOU", "ABQ", "PSR", "SLC", "SGX",
+	"LOX", "MTR", "PQR", "SEW", "AFC", "AFG", "AJK", "HFO", "GUM", "SJU",
+}
+
+// fetchArchive saves the latest AFD of each of archiveOffices to archiveDir
+func fetchArchive(t *testing.T) {
+	if err := os.MkdirAll(archiveDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	client := NewIEMClient(&http.Client{Timeout: 30 * time.Second})
+	for _, office := range archiveOffices {
+		product, err := client.GetAFD(context.Background(), office)
+		if err != nil {
+			t.Errorf("Couldn't fetch %s: %v", office, err)
+			continue
+		}
+		path := filepath.Join(archiveDir, strings.ToLower(office)+".txt")
+		if err := ioutil.WriteFile(path, []byte(product.ProductText+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// afdPaths returns the fixture and archived AFDs
+func afdPaths() ([]string, error) {
+	fixtures, err := filepath.Glob(fixtureGlob)
+	if err != nil {
+		return nil, err
+	}
+	archived, err := filepath.Glob(filepath.Join(archiveDir, "*.txt"))
+	return append(fixtures, archived...), err
+}
+
+// goldenFile returns the golden file of an AFD, beside it for archived ones
+// and in testdata/afd for fixtures
+func goldenFile(path string) string {
+	dir := filepath.Join("testdata", "afd")
+	if filepath.Dir(path) == archiveDir {
+		dir = archiveDir
+	}
+	return filepath.Join(dir, strings.TrimSuffix(filepath.Base(path), ".txt")+".golden.json")
+}
+
+// goldenSection is how a parsed section is recorded in a golden file
+type goldenSection struct {
+	Name      string
+	Heading   string
+	Issued    string        `json:",omitempty"`
+	Parts     []SectionPart `json:",omitempty"`
+	Formatted string
+}
+
+// goldenAFD is how a parsed AFD is recorded in a golden file
+type goldenAFD struct {
+	WMOHeader  string
+	AWIPSID    string
+	Header     string
+	Sections   []goldenSection
+	Signatures []Signature      `json:",omitempty"`
+	Headlines  []StateHeadlines `json:",omitempty"`
+	Severity   Severity
+	Segments   []Segment `json:",omitempty"`
+}
+
+func parseGolden(text string) goldenAFD {
+	afd := ParseAFD(text)
+	golden := goldenAFD{
+		WMOHeader:  afd.WMOHeader,
+		AWIPSID:    afd.AWIPSID,
+		Header:     afd.Header,
+		Signatures: afd.Signatures,
+		Severity:   afd.Severity(),
+	}
+	golden.Headlines, _ = afd.Headlines()
+	_, golden.Segments = ParseSegments(text)
+	for _, name := range afd.Sections() {
+		section, _ := afd.Section(name)
+		formatted, _ := afd.GetDiscussionSection(name)
+		golden.Sections = append(golden.Sections, goldenSection{
+			Name:      section.Name,
+			Heading:   section.Heading,
+			Issued:    section.Issued,
+			Parts:     section.Parts,
+			Formatted: formatted,
+		})
+	}
+	return golden
+}
+
+// TestParseAFDGolden parses every fixture and archived AFD and compares the
+// result with its .golden.json file. Run with -update after an intended
+// parser change, and review the diff of the golden files. Run with -fetch to
+// refresh the archived AFDs, and add an office to archiveOffices to cover
+// it. The fixtures are short and written for the tests of nwstest's users.
+func TestParseAFDGolden(t *testing.T) {
+	if *fetch {
+		fetchArchive(t)
+	}
+	paths, err := afdPaths()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("No AFDs in nwstest/fixtures")
+	}
+
+	for _, path := range paths {
+		path := path
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			text, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.MarshalIndent(parseGolden(string(text)), "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			goldenPath := goldenFile(path)
+			if *update || *fetch && filepath.Dir(path) == archiveDir {
+				if err := ioutil.WriteFile(goldenPath, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := ioutil.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("%v, run go test -update to create it", err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("Parsed %s differs from %s, run go test -update if the change is intended:\n%s",
+					path, goldenPath, got)
+			}
+		})
+	}
+}
+
+// FuzzParseAFD checks that any text parses without panicking and that every
+// section the parser reports can be looked up and formatted
+func FuzzParseAFD(f *testing.F) {
+	paths, _ := afdPaths()
+	for _, path := range paths {
+		if text, err := ioutil.ReadFile(path); err == nil {
+			f.Add(string(text))
+		}
+	}
+	f.Add(".SHORT TERM...\n&&")
+	f.Add("$$\n.A...\n$$")
+	f.Add("ORZ001>-151200-\n.X...y\n$$")
+
+	f.Fuzz(func(t *testing.T, text string) {
+		afd := ParseAFD(text)
+		seen := make(map[string]bool)
+		for _, name := range afd.Sections() {
+			if seen[name] {
+				t.Errorf("Section %q listed twice", name)
+			}
+			seen[name] = true
+			if _, ok := afd.Section(name); !ok {
+				t.Errorf("Listed section %q can't be looked up", name)
+			}
+			formatted, err := afd.GetDiscussionSection(name)
+			if err != nil {
+				t.Errorf("Listed section %q can't be formatted: %v", name, err)
+			}
+			if strings.Contains(formatted, "\n\n\n") {
+				t.Errorf("Section %q has runs of blank lines: %q", name, formatted)
+			}
+		}
+		afd.Headlines()
+		afd.Severity()
+		afd.HTML()
+		afd.Markdown()
+		ParseSegments(text)
+		ExtractQuantities(text)
+	})
+}
+
+func TestNormalizeSectionName(t *testing.T) {
+	tests := map[string]string{
+		"short_term":       "SHORT TERM",
+		"Short-Term":       "SHORT TERM",
+		"  near   term ":   "NEAR TERM",
+		"Days 3-7":         "DAYS 3-7",
+		"a-b-c":            "A B C",
+		"Day-3-Long-Term":  "DAY-3-LONG TERM",
+		"watches/warnings": "WATCHES/WARNINGS",
+		"-fire-weather-":   "-FIRE WEATHER-",
+	}
+	for name, want := range tests {
+		if got := NormalizeSectionName(name); got != want {
+			t.Errorf("NormalizeSectionName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package nws
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned instead of making a request while the API is
+// considered down
+var ErrCircuitOpen = errors.New("NWS API is failing, requests are paused")
+
+// CircuitBreaker struct stops requests to a failing API for a cool-down
+// period once Threshold requests in a row have failed
+type CircuitBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+	// OnOpen is called each time the breaker opens
+	OnOpen func(failures int, until time.Time)
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// NewCircuitBreaker returns a breaker with the given threshold and cool-down
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		Threshold: threshold,
+		Cooldown:  cooldown,
+	}
+}
+
+// Allow returns ErrCircuitOpen if requests are paused. Once the cool-down
+// has passed, requests are let through again, and the first failure reopens
+// the breaker.
+func (s *CircuitBreaker) Allow() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Now().Before(s.openUntil) {
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+// Record notes whether a request succeeded
+func (s *CircuitBreaker) Record(failed bool) {
+	s.mu.Lock()
+	if !failed {
+		s.failures = 0
+		s.mu.Unlock()
+		return
+	}
+	s.failures++
+	if s.failures < s.Threshold {
+		s.mu.Unlock()
+		return
+	}
+	s.openUntil = time.Now().Add(s.Cooldown)
+	failures, until := s.failures, s.openUntil
+	s.mu.Unlock()
+
+	if s.OnOpen != nil {
+		s.OnOpen(failures, until)
+	}
+}
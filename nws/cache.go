@@ -0,0 +1,127 @@
+package nws
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// cachedResponse struct is a response body along with the validators needed
+// to ask the server whether it has changed
+type cachedResponse struct {
+	ETag         string
+	LastModified string
+	Body         []byte
+}
+
+// ResponseCache struct remembers responses by URL so repeated requests can
+// be made conditional and answered with 304 Not Modified
+type ResponseCache struct {
+	mu        sync.Mutex
+	responses map[string]cachedResponse
+}
+
+// NewResponseCache returns an empty cache
+func NewResponseCache() *ResponseCache {
+	return &ResponseCache{responses: make(map[string]cachedResponse)}
+}
+
+// prepare adds conditional headers to req if we have a cached response for
+// its URL
+func (s *ResponseCache) prepare(req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cached, ok := s.responses[req.URL.String()]
+	if !ok {
+		return
+	}
+	if cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	if cached.LastModified != "" {
+		req.Header.Set("If-Modified-Since", cached.LastModified)
+	}
+}
+
+// store caches a successful response if it carries validators
+func (s *ResponseCache) store(req *http.Request, resp *http.Response, body []byte) {
+	etag := resp.Header.Get("ETag")
+	lastModified := resp.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[req.URL.String()] = cachedResponse{
+		ETag:         etag,
+		LastModified: lastModified,
+		Body:         body,
+	}
+}
+
+// cached returns the cached body for a request answered with 304
+func (s *ResponseCache) cached(req *http.Request) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cached, ok := s.responses[req.URL.String()]
+	return cached.Body, ok
+}
+
+// AFDFetcher is anything that can fetch the latest AFD for an office
+type AFDFetcher interface {
+	GetAFD(ctx context.Context, locationID string) (*Product, error)
+}
+
+// AFDCache struct fetches each office's AFD at most once, so users
+// subscribed to the same office share one request. Create a new cache for
+// each run so the next run sees new issuances.
+type AFDCache struct {
+	Fetcher AFDFetcher
+
+	mu      sync.Mutex
+	entries map[string]*afdCacheEntry
+}
+
+type afdCacheEntry struct {
+	mu   sync.Mutex
+	done bool
+	afd  *Product
+	err  error
+}
+
+// NewAFDCache returns an empty cache in front of fetcher
+func NewAFDCache(fetcher AFDFetcher) *AFDCache {
+	return &AFDCache{
+		Fetcher: fetcher,
+		entries: make(map[string]*afdCacheEntry),
+	}
+}
+
+// GetAFD returns the office's AFD, fetching it on first use. Errors are
+// cached too, so a failing office isn't retried for every subscriber, except
+// a canceled or timed out context: that was the caller's, so the next
+// caller fetches again with its own.
+func (s *AFDCache) GetAFD(ctx context.Context, locationID string) (*Product, error) {
+	key := strings.ToUpper(locationID)
+	s.mu.Lock()
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &afdCacheEntry{}
+		s.entries[key] = entry
+	}
+	s.mu.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.done {
+		return entry.afd, entry.err
+	}
+	afd, err := s.Fetcher.GetAFD(ctx, locationID)
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return nil, err
+	}
+	entry.afd, entry.err, entry.done = afd, err, true
+	return afd, err
+}
@@ -0,0 +1,55 @@
+package nws
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// countingFetcher fails with err, then returns a product, counting calls
+type countingFetcher struct {
+	calls int
+	err   error
+}
+
+func (s *countingFetcher) GetAFD(ctx context.Context, locationID string) (*Product, error) {
+	s.calls++
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &Product{ID: "afd-" + locationID}, nil
+}
+
+func TestAFDCacheRetriesCanceledContext(t *testing.T) {
+	fetcher := &countingFetcher{}
+	cache := NewAFDCache(fetcher)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cache.GetAFD(canceled, "BOX"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetAFD with a canceled context returned %v", err)
+	}
+	product, err := cache.GetAFD(context.Background(), "box")
+	if err != nil || product.ID != "afd-box" {
+		t.Fatalf("GetAFD after a canceled caller returned %v, %v", product, err)
+	}
+	if _, err := cache.GetAFD(context.Background(), "BOX"); err != nil || fetcher.calls != 2 {
+		t.Errorf("GetAFD fetched %d times, want 2", fetcher.calls)
+	}
+}
+
+func TestAFDCacheCachesErrors(t *testing.T) {
+	fetcher := &countingFetcher{err: ErrServer}
+	cache := NewAFDCache(fetcher)
+	for i := 0; i < 3; i++ {
+		if _, err := cache.GetAFD(context.Background(), "OAX"); !errors.Is(err, ErrServer) {
+			t.Fatalf("GetAFD returned %v, want ErrServer", err)
+		}
+	}
+	if fetcher.calls != 1 {
+		t.Errorf("GetAFD fetched %d times, want 1", fetcher.calls)
+	}
+}
@@ -0,0 +1,468 @@
+package nws
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// DefaultRequestsPerSecond keeps us well under the API's (unpublished) rate
+// limit
+const DefaultRequestsPerSecond = 5
+
+// DefaultUserAgent identifies us to the API, which requires a User-Agent
+// with contact details. Programs using this package should set their own.
+const DefaultUserAgent = "forecast-discussion-alerts/" + Version + " (https://github.com/johnwcallahan/forecast-discussion-alerts)"
+
+// Client struct is a wrapper around the NWS API
+type Client struct {
+	BaseURI    string
+	UserAgent  string
+	HTTPClient *http.Client
+	// Limiter spaces out requests so we stay within the API's rate limits. It
+	// is shared by every request made through the client.
+	Limiter *rate.Limiter
+	// Cache makes repeated requests conditional so unchanged responses come
+	// back as 304s. It may be nil.
+	Cache *ResponseCache
+	// MaxRetries is how many times a request is retried after a network
+	// error or a 429/5xx response, waiting RetryDelay doubled on each attempt
+	MaxRetries int
+	RetryDelay time.Duration
+	// Breaker pauses requests while the API is down. It may be nil.
+	Breaker *CircuitBreaker
+	// Logger, if set, logs each request at debug level with its status and
+	// duration
+	Logger *slog.Logger
+	// OnRequest, if set, is called after each attempt at a request with the
+	// response status, or 0 if there was none, and how long it took.
+	// OnRetry is called before each retry.
+	OnRequest func(req *http.Request, status int, duration time.Duration)
+	OnRetry   func(req *http.Request, err error)
+}
+
+// API is the part of the NWS API used by the app. Client implements it
+// against api.weather.gov; tests can implement it themselves or point a
+// Client at an nwstest.Server.
+type API interface {
+	AFDFetcher
+	GetAFDAt(ctx context.Context, locationID string, t time.Time) (*Product, error)
+	GetProduct(ctx context.Context, productID string) (*Product, error)
+	ListProducts(ctx context.Context, query ProductQuery) ([]Product, error)
+	ListOffices(ctx context.Context) ([]Office, error)
+	GetProductTypes(ctx context.Context, locationID string) ([]ProductType, error)
+	GetPoint(ctx context.Context, lat float64, lon float64) (*Point, error)
+}
+
+var _ API = (*Client)(nil)
+
+// NewClient returns a client with default params that makes its requests
+// through httpClient, or http.DefaultClient if it is nil
+func NewClient(httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		BaseURI:    "https://api.weather.gov",
+		HTTPClient: httpClient,
+		UserAgent:  DefaultUserAgent,
+		Limiter:    rate.NewLimiter(rate.Limit(DefaultRequestsPerSecond), 1),
+		Cache:      NewResponseCache(),
+		MaxRetries: 3,
+		RetryDelay: 500 * time.Millisecond,
+		Breaker:    NewCircuitBreaker(5, 5*time.Minute),
+	}
+}
+
+func (s *Client) doRequest(req *http.Request) ([]byte, error) {
+	req.Header.Set("User-Agent", s.UserAgent)
+	// Product texts are large and compress well. Asking for gzip ourselves
+	// rather than leaving it to the transport keeps it explicit, and means
+	// readBody has to decode it.
+	req.Header.Set("Accept-Encoding", "gzip")
+	if s.Breaker != nil {
+		if err := s.Breaker.Allow(); err != nil {
+			return nil, err
+		}
+	}
+
+	var body []byte
+	var err error
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		body, retry, err = s.doRequestOnce(req)
+		if !retry || attempt >= s.MaxRetries {
+			// Only errors that retrying would have helped with mean the API
+			// is down, a 404 for example doesn't
+			if s.Breaker != nil && req.Context().Err() == nil {
+				s.Breaker.Record(retry)
+			}
+			return body, err
+		}
+
+		if s.OnRetry != nil {
+			s.OnRetry(req, err)
+		}
+
+		// Exponential backoff, randomized so clients don't retry in lockstep
+		delay := s.RetryDelay << uint(attempt)
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// doRequestOnce performs a single request and reports whether it is worth
+// retrying
+func (s *Client) doRequestOnce(req *http.Request) ([]byte, bool, error) {
+	if err := s.Limiter.Wait(req.Context()); err != nil {
+		return nil, false, err
+	}
+	if s.Cache != nil {
+		s.Cache.prepare(req)
+	}
+	start := time.Now()
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		if s.Logger != nil {
+			s.Logger.Debug("NWS request failed", "url", req.URL.String(), "duration", time.Since(start), "err", err)
+		}
+		if s.OnRequest != nil {
+			s.OnRequest(req, 0, time.Since(start))
+		}
+		return nil, req.Context().Err() == nil, err
+	}
+	defer resp.Body.Close()
+	if s.Logger != nil {
+		s.Logger.Debug("NWS request", "url", req.URL.String(), "status", resp.StatusCode, "duration", time.Since(start))
+	}
+	if s.OnRequest != nil {
+		s.OnRequest(req, resp.StatusCode, time.Since(start))
+	}
+	if resp.StatusCode == http.StatusNotModified && s.Cache != nil {
+		if body, ok := s.Cache.cached(req); ok {
+			return body, false, nil
+		}
+	}
+	body, err := readBody(resp)
+	if err != nil {
+		return nil, true, err
+	}
+	if resp.StatusCode != 200 {
+		apiErr := newAPIError(resp.StatusCode, body)
+		return nil, apiErr.Temporary(), apiErr
+	}
+	if s.Cache != nil {
+		s.Cache.store(req, resp, body)
+	}
+	return body, false, nil
+}
+
+// readBody reads a response body, decoding it if it is gzipped
+func readBody(resp *http.Response) ([]byte, error) {
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return ioutil.ReadAll(resp.Body)
+	}
+	reader, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+// GetAFD return most recent Area Forecast Discussion
+func (s *Client) GetAFD(ctx context.Context, locationID string) (*Product, error) {
+	products, err := s.ListProducts(ctx, ProductQuery{
+		Type:     "AFD",
+		Location: locationID,
+		Limit:    1,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(products) < 1 {
+		return nil, fmt.Errorf("Couldn't find AFD for %s: %w", locationID, ErrNotFound)
+	}
+
+	latestID := products[0].ID
+	afd, err := s.GetProduct(ctx, latestID)
+	if err != nil {
+		return nil, err
+	}
+	return afd, nil
+}
+
+// GetAFDAt returns the Area Forecast Discussion that was current at t, i.e.
+// the most recent one issued at or before t
+func (s *Client) GetAFDAt(ctx context.Context, locationID string, t time.Time) (*Product, error) {
+	products, err := s.ListProducts(ctx, ProductQuery{
+		Type:     "AFD",
+		Location: locationID,
+		End:      t,
+		Limit:    1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(products) < 1 {
+		return nil, fmt.Errorf("Couldn't find AFD issued before %s: %w", t.Format(time.RFC3339), ErrNotFound)
+	}
+	return s.GetProduct(ctx, products[0].ID)
+}
+
+// GetProducts methods retrieves product listing
+func (s *Client) GetProducts(ctx context.Context, productType string, locationID string) ([]Product, error) {
+	uri := s.BaseURI + "/products/types/" + productType + "/locations/" + locationID
+	req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/geo+json")
+	bytes, err := s.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	var resp Response
+	err = json.Unmarshal(bytes, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Products, nil
+}
+
+// Office struct represents a forecast office that issues products
+type Office struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// ListOffices returns every office that issues AFDs, sorted by ID. The API
+// has no listing of all offices, so this uses the locations AFDs are issued
+// for, which are exactly the valid LocationID values.
+func (s *Client) ListOffices(ctx context.Context) ([]Office, error) {
+	uri := s.BaseURI + "/products/types/AFD/locations"
+	req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/ld+json")
+	bytes, err := s.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Locations map[string]string `json:"locations"`
+	}
+	err = json.Unmarshal(bytes, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	offices := make([]Office, 0, len(resp.Locations))
+	for id, name := range resp.Locations {
+		offices = append(offices, Office{ID: id, Name: name})
+	}
+	sort.Slice(offices, func(i, j int) bool {
+		return offices[i].ID < offices[j].ID
+	})
+	return offices, nil
+}
+
+// ProductType struct is a kind of product an office issues
+type ProductType struct {
+	ProductCode string `json:"productCode"`
+	ProductName string `json:"productName"`
+}
+
+// GetProductTypes returns the kinds of product an office issues
+func (s *Client) GetProductTypes(ctx context.Context, locationID string) ([]ProductType, error) {
+	uri := s.BaseURI + "/products/locations/" + strings.ToUpper(locationID) + "/types"
+	req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/ld+json")
+	bytes, err := s.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		ProductTypes []ProductType `json:"@graph"`
+	}
+	err = json.Unmarshal(bytes, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.ProductTypes, nil
+}
+
+// Point struct describes who is responsible for forecasts at a location
+type Point struct {
+	Office          string
+	ForecastZone    string
+	County          string
+	FireWeatherZone string
+	City            string
+	State           string
+	TimeZone        string
+}
+
+// GetPoint returns the forecast office and zones covering a latitude and
+// longitude
+func (s *Client) GetPoint(ctx context.Context, lat float64, lon float64) (*Point, error) {
+	// The API redirects requests with more than four decimal places
+	uri := fmt.Sprintf("%s/points/%.4f,%.4f", s.BaseURI, lat, lon)
+	req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/geo+json")
+	bytes, err := s.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Properties struct {
+			CWA              string `json:"cwa"`
+			ForecastZone     string `json:"forecastZone"`
+			County           string `json:"county"`
+			FireWeatherZone  string `json:"fireWeatherZone"`
+			TimeZone         string `json:"timeZone"`
+			RelativeLocation struct {
+				Properties struct {
+					City  string `json:"city"`
+					State string `json:"state"`
+				} `json:"properties"`
+			} `json:"relativeLocation"`
+		} `json:"properties"`
+	}
+	err = json.Unmarshal(bytes, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	props := resp.Properties
+	return &Point{
+		Office:          props.CWA,
+		ForecastZone:    path.Base(props.ForecastZone),
+		County:          path.Base(props.County),
+		FireWeatherZone: path.Base(props.FireWeatherZone),
+		City:            props.RelativeLocation.Properties.City,
+		State:           props.RelativeLocation.Properties.State,
+		TimeZone:        props.TimeZone,
+	}, nil
+}
+
+// ProductQuery struct filters a product listing. Zero values are left out of
+// the query.
+type ProductQuery struct {
+	Type     string
+	Location string
+	Start    time.Time
+	End      time.Time
+	// Limit caps the number of products returned, newest first
+	Limit int
+}
+
+// ListProducts retrieves the products matching a query, newest first
+func (s *Client) ListProducts(ctx context.Context, query ProductQuery) ([]Product, error) {
+	params := url.Values{}
+	if query.Type != "" {
+		params.Set("type", strings.ToUpper(query.Type))
+	}
+	if query.Location != "" {
+		params.Set("location", strings.ToUpper(query.Location))
+	}
+	if !query.Start.IsZero() {
+		params.Set("start", query.Start.UTC().Format(time.RFC3339))
+	}
+	if !query.End.IsZero() {
+		params.Set("end", query.End.UTC().Format(time.RFC3339))
+	}
+	if query.Limit > 0 {
+		params.Set("limit", strconv.Itoa(query.Limit))
+	}
+
+	uri := s.BaseURI + "/products?" + params.Encode()
+	req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/geo+json")
+	bytes, err := s.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	var resp Response
+	err = json.Unmarshal(bytes, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Products, nil
+}
+
+// ProductHistory pages backwards through the products matching a query,
+// pageSize at a time, calling fn for each product until fn returns false,
+// an error occurs or there are no older products. query.End is moved back
+// after each page; query.Limit is ignored.
+func (s *Client) ProductHistory(ctx context.Context, query ProductQuery, pageSize int, fn func(Product) bool) error {
+	query.Limit = pageSize
+	for {
+		products, err := s.ListProducts(ctx, query)
+		if err != nil {
+			return err
+		}
+		for _, product := range products {
+			if !fn(product) {
+				return nil
+			}
+		}
+		if len(products) < pageSize {
+			return nil
+		}
+
+		oldest := products[len(products)-1].IssuanceTime
+		if oldest.IsZero() {
+			return fmt.Errorf("Product %s has no issuance time to page from", products[len(products)-1].ID)
+		}
+		query.End = oldest.Add(-time.Second)
+	}
+}
+
+// GetProduct returns a single product from the API by ID
+func (s *Client) GetProduct(ctx context.Context, productID string) (*Product, error) {
+	uri := s.BaseURI + "/products/" + productID
+	req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/geo+json")
+	bytes, err := s.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	var product Product
+	err = json.Unmarshal(bytes, &product)
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
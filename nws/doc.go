@@ -0,0 +1,18 @@
+// Package nws is a client for the National Weather Service API at
+// api.weather.gov, with a parser for the sections of Area Forecast
+// Discussions.
+//
+// nws, nws/nwstest and notifier are this module's public API, for other Go
+// tools to build on:
+//
+//	go get github.com/johnwcallahan/forecast-discussion-alerts@v1
+//
+// Their exported names keep working across minor versions; a change that has
+// to break them waits for the next major version, published under a /vN
+// module path as Go requires. The packages under internal belong to the
+// forecast-alerts command and may change in any release.
+package nws
+
+// Version is the module's release, tagged as v plus Version when it's
+// published, and sent in DefaultUserAgent
+const Version = "1.0.0"
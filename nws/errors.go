@@ -0,0 +1,66 @@
+package nws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Errors returned by the NWS client, for use with errors.Is
+var (
+	ErrNotFound    = errors.New("Not found")
+	ErrRateLimited = errors.New("Rate limited")
+	ErrServer      = errors.New("NWS server error")
+)
+
+// APIError struct is an error response from the NWS API, which describes
+// problems as application/problem+json
+type APIError struct {
+	StatusCode    int
+	CorrelationID string `json:"correlationId"`
+	Title         string `json:"title"`
+	Detail        string `json:"detail"`
+	Body          string `json:"-"`
+}
+
+// newAPIError builds an error from a failed response
+func newAPIError(statusCode int, body []byte) *APIError {
+	apiErr := &APIError{StatusCode: statusCode}
+	if err := json.Unmarshal(body, apiErr); err != nil {
+		apiErr.Body = string(body)
+	}
+	return apiErr
+}
+
+func (e *APIError) Error() string {
+	msg := e.Detail
+	if msg == "" {
+		msg = e.Title
+	}
+	if msg == "" {
+		msg = e.Body
+	}
+	if e.CorrelationID != "" {
+		return fmt.Sprintf("NWS API error %d: %s (correlation ID %s)", e.StatusCode, msg, e.CorrelationID)
+	}
+	return fmt.Sprintf("NWS API error %d: %s", e.StatusCode, msg)
+}
+
+// Is lets errors.Is match ErrNotFound, ErrRateLimited and ErrServer
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrServer:
+		return e.StatusCode >= 500
+	}
+	return false
+}
+
+// Temporary reports whether the request may succeed if retried
+func (e *APIError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
@@ -0,0 +1,124 @@
+package nws
+
+import (
+	"regexp"
+	"strings"
+)
+
+// DefaultMaxParagraphLength is the longest a paragraph of a formatted section
+// gets before it's broken up, about what fits on a phone screen
+const DefaultMaxParagraphLength = 320
+
+var (
+	// ellipsisRe matches the "..." NWS text runs words together with, e.g.
+	// "Winds...southwest 10 to 15 mph"
+	ellipsisRe  = regexp.MustCompile(`(\S)\.\.\.(\w)`)
+	sentenceRe  = regexp.MustCompile(`[.!?]+["')\]]*\s+`)
+	blankLineRe = regexp.MustCompile(`\n[ \t]*\n`)
+	spacesRe    = regexp.MustCompile(`[ \t\p{Zs}]+`)
+	// bulletRe matches the start of a list item, e.g. "- ", "* " or "1. "
+	bulletRe = regexp.MustCompile(`^([-*\x{2022}]|\d+[.)])\s`)
+)
+
+// sanitizeString unwraps the hard-wrapped lines of product text into
+// paragraphs, keeping blank-line paragraph breaks and putting each item of a
+// bulleted list on its own line
+func sanitizeString(s string) string {
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	s = strings.Replace(s, "\r", "\n", -1)
+
+	var paragraphs []string
+	for _, paragraph := range blankLineRe.Split(s, -1) {
+		var lines []string
+		for _, line := range strings.Split(paragraph, "\n") {
+			line = strings.TrimSpace(spacesRe.ReplaceAllString(line, " "))
+			if line == "" {
+				continue
+			}
+			if len(lines) == 0 || bulletRe.MatchString(line) {
+				lines = append(lines, line)
+			} else {
+				lines[len(lines)-1] += " " + line
+			}
+		}
+		if len(lines) > 0 {
+			paragraphs = append(paragraphs, strings.Join(lines, "\n"))
+		}
+	}
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// SectionHeaderSep separates the section name from its text in a formatted
+// discussion section
+const SectionHeaderSep = ":\n\n"
+
+func formatDiscussionItem(discussionType string, discussionItem string) string {
+	return strings.ToUpper(discussionType) + SectionHeaderSep + discussionItem
+}
+
+// Reflow formats product text for reading on a phone: hard-wrapped lines are
+// joined into paragraphs, words run together with "..." are spaced out, and
+// paragraphs longer than maxParagraph are broken between sentences. Lists
+// keep one item per line.
+func Reflow(text string, maxParagraph int) string {
+	text = ellipsisRe.ReplaceAllString(sanitizeString(text), "$1... $2")
+
+	var paragraphs []string
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		if len(paragraph) <= maxParagraph || strings.Contains(paragraph, "\n") {
+			paragraphs = append(paragraphs, paragraph)
+			continue
+		}
+		current := ""
+		for _, sentence := range SplitSentences(paragraph) {
+			if current != "" && len(current)+1+len(sentence) > maxParagraph {
+				paragraphs = append(paragraphs, current)
+				current = ""
+			}
+			if current == "" {
+				current = sentence
+			} else {
+				current += " " + sentence
+			}
+		}
+		if current != "" {
+			paragraphs = append(paragraphs, current)
+		}
+	}
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// SplitSentences splits s into its sentences, each ending with its
+// punctuation and any closing quote or bracket
+func SplitSentences(s string) []string {
+	var sentences []string
+	start := 0
+	for _, loc := range sentenceRe.FindAllStringIndex(s, -1) {
+		sentences = append(sentences, strings.TrimSpace(s[start:loc[1]]))
+		start = loc[1]
+	}
+	if rest := strings.TrimSpace(s[start:]); rest != "" {
+		sentences = append(sentences, rest)
+	}
+	return sentences
+}
+
+// FormattedSectionName returns the name a formatted section starts with,
+// ignoring any issuance time, so each version of a section replaces the last
+func FormattedSectionName(section string) string {
+	name, _ := SplitSectionHeader(section)
+	name = strings.TrimSuffix(name, SectionHeaderSep)
+	if i := strings.Index(name, " ("); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// SplitSectionHeader splits a formatted section into the header, including
+// its separator, and the text
+func SplitSectionHeader(section string) (string, string) {
+	if i := strings.Index(section, SectionHeaderSep); i >= 0 {
+		return section[:i+len(SectionHeaderSep)], section[i+len(SectionHeaderSep):]
+	}
+	return "", section
+}
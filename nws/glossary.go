@@ -0,0 +1,112 @@
+package nws
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// glossary maps common abbreviations and jargon in forecast discussions to
+// plain language, see https://forecast.weather.gov/glossary.php. Two-letter
+// abbreviations that are also state codes or common words, such as AR, EC
+// and PW, are left out.
+var glossary = map[string]string{
+	"CAA":      "cold air moving in",
+	"WAA":      "warm air moving in",
+	"H5":       "500 mb (about 18,000 ft)",
+	"H7":       "700 mb (about 10,000 ft)",
+	"H85":      "850 mb (about 5,000 ft)",
+	"H85/H8":   "850 mb (about 5,000 ft)",
+	"H8":       "850 mb (about 5,000 ft)",
+	"PoPs":     "chances of precipitation",
+	"PoP":      "chance of precipitation",
+	"QPF":      "forecast precipitation amounts",
+	"sfc":      "surface",
+	"vort max": "spin aloft",
+	"vort":     "spin aloft",
+	"LLJ":      "low-level jet",
+	"CAPE":     "instability (CAPE)",
+	"MUCAPE":   "instability (MUCAPE)",
+	"SBCAPE":   "surface-based instability",
+	"MLCAPE":   "instability (MLCAPE)",
+	"RH":       "relative humidity",
+	"CWA":      "forecast area",
+	"tstms":    "thunderstorms",
+	"tstm":     "thunderstorm",
+	"trof":     "trough",
+	"bndry":    "boundary",
+	"precip":   "precipitation",
+	"VFR":      "good flying conditions (VFR)",
+	"MVFR":     "marginal flying conditions (MVFR)",
+	"IFR":      "poor flying conditions (IFR)",
+	"LIFR":     "very poor flying conditions (LIFR)",
+	"TAF":      "airport forecast",
+	"TAFs":     "airport forecasts",
+	"NBM":      "National Blend of Models",
+	"GFS":      "GFS (American) model",
+	"ECMWF":    "ECMWF (European) model",
+	"NAM":      "NAM model",
+	"HRRR":     "HRRR (short-range) model",
+	"SPC":      "Storm Prediction Center",
+	"WPC":      "Weather Prediction Center",
+	"IVT":      "moisture transport (IVT)",
+	"PWAT":     "atmospheric moisture (precipitable water)",
+}
+
+var (
+	glossaryRe    *regexp.Regexp
+	glossaryIndex map[string]string
+)
+
+func init() {
+	var terms []string
+	glossaryIndex = make(map[string]string, len(glossary))
+	for term, meaning := range glossary {
+		if strings.ToLower(term) == term {
+			// Shortened words like "sfc" match in any case
+			terms = append(terms, term)
+			glossaryIndex[term] = meaning
+			continue
+		}
+		// Abbreviations match only as written or, for products in all caps,
+		// in upper case, so "CAA" doesn't match a word like "caa"
+		terms = append(terms, term)
+		glossaryIndex[term] = meaning
+		if upper := strings.ToUpper(term); upper != term {
+			terms = append(terms, upper)
+			glossaryIndex[upper] = meaning
+		}
+	}
+	// Longest first, so "vort max" wins over "vort"
+	sort.Slice(terms, func(i, j int) bool { return len(terms[i]) > len(terms[j]) })
+	for i, term := range terms {
+		terms[i] = regexp.QuoteMeta(term)
+		if strings.ToLower(term) == term {
+			terms[i] = "(?i:" + terms[i] + ")"
+		}
+	}
+	glossaryRe = regexp.MustCompile(`\b(` + strings.Join(terms, "|") + `)\b`)
+}
+
+// ExpandAbbreviations replaces the abbreviations in the glossary with their
+// plain language meaning, for subscribers who aren't meteorologists
+func ExpandAbbreviations(text string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range glossaryRe.FindAllStringIndex(text, -1) {
+		match := text[loc[0]:loc[1]]
+		meaning, ok := glossaryIndex[match]
+		if !ok {
+			meaning = glossaryIndex[strings.ToLower(match)]
+		}
+		// Keep sentences starting with a capital
+		if before := strings.TrimRight(text[:loc[0]], " "); before == "" || strings.HasSuffix(before, ".") || strings.HasSuffix(before, "\n") {
+			meaning = strings.ToUpper(meaning[:1]) + meaning[1:]
+		}
+		b.WriteString(text[last:loc[0]])
+		b.WriteString(meaning)
+		last = loc[1]
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
@@ -0,0 +1,25 @@
+package nws
+
+import "testing"
+
+func TestExpandAbbreviations(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"CAA behind the front.", "Cold air moving in behind the front."},
+		{"Low PoPs through Tue.", "Low chances of precipitation through Tue."},
+		{"LOW POPS THROUGH TUE.", "LOW chances of precipitation THROUGH TUE."},
+		{"Light precip near the sfc bndry.", "Light precipitation near the surface boundary."},
+		{"LIGHT PRECIP NEAR THE SFC.", "LIGHT precipitation NEAR THE surface."},
+		{"The vort max moves east.", "The spin aloft moves east."},
+		// State codes and ordinary words are left alone
+		{"Storms over central AR and eastern OK.", "Storms over central AR and eastern OK."},
+		{"Pop-up showers, the caa is fine.", "Pop-up showers, the caa is fine."},
+	}
+	for _, test := range tests {
+		if got := ExpandAbbreviations(test.text); got != test.want {
+			t.Errorf("ExpandAbbreviations(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package nws
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// HeadlinesSection is the pseudo-section name users subscribe to for a
+// compact list of the watches, warnings and advisories in effect
+const HeadlinesSection = "HEADLINES"
+
+// headlineStateRe matches the start of each state's entry in the watches,
+// warnings and advisories section, e.g. "OR...", or "PZ..." for a marine area
+var headlineStateRe = regexp.MustCompile(`(?m)^\s*([A-Z]{2})\s*\.\.\.`)
+
+// headlineEndRe matches the end of one product in a state's entry
+var headlineEndRe = regexp.MustCompile(`\.\s+[A-Z]`)
+
+// StateHeadlines struct lists the products in effect in one state or marine
+// area
+type StateHeadlines struct {
+	State    string
+	Products []string
+}
+
+// headlinesSection returns the watches, warnings and advisories section,
+// which most offices prefix with their ID, e.g. "PQR WATCHES/WARNINGS/ADVISORIES"
+func (s *AFD) headlinesSection() (Section, bool) {
+	for _, section := range s.sections {
+		if strings.HasSuffix(section.Name, "WARNINGS/ADVISORIES") || strings.HasSuffix(section.Name, "WATCHES/WARNINGS") {
+			return section, true
+		}
+	}
+	return Section{}, false
+}
+
+// Headlines parses the watches, warnings and advisories section into the
+// products in effect in each state, in the order listed
+func (s *AFD) Headlines() ([]StateHeadlines, bool) {
+	section, ok := s.headlinesSection()
+	if !ok {
+		return nil, false
+	}
+
+	var headlines []StateHeadlines
+	states := headlineStateRe.FindAllStringSubmatchIndex(section.Body, -1)
+	for i, loc := range states {
+		end := len(section.Body)
+		if i+1 < len(states) {
+			end = states[i+1][0]
+		}
+		text := strings.Join(strings.Fields(section.Body[loc[1]:end]), " ")
+		headlines = append(headlines, StateHeadlines{
+			State:    section.Body[loc[2]:loc[3]],
+			Products: splitHeadlines(text),
+		})
+	}
+	return headlines, true
+}
+
+// splitHeadlines splits a state's entry into its products, e.g. "Wind
+// Advisory until 5 PM PDT this afternoon for ORZ001"
+func splitHeadlines(text string) []string {
+	var products []string
+	start := 0
+	for _, loc := range headlineEndRe.FindAllStringIndex(text, -1) {
+		products = append(products, text[start:loc[0]])
+		start = loc[1] - 1
+	}
+	products = append(products, strings.TrimSuffix(text[start:], "."))
+
+	var active []string
+	for _, product := range products {
+		product = strings.TrimSpace(product)
+		if product != "" && !strings.EqualFold(product, "none") {
+			active = append(active, product)
+		}
+	}
+	return active
+}
+
+// GetHeadlines formats the products in effect in the given states, or in
+// every state listed if none are given, as a compact message
+func (s *AFD) GetHeadlines(states ...string) (string, error) {
+	headlines, ok := s.Headlines()
+	if !ok {
+		return "", errors.New("No watches, warnings or advisories section found")
+	}
+
+	var lines []string
+	for _, state := range headlines {
+		if len(states) > 0 && !containsName(states, state.State) {
+			continue
+		}
+		if len(state.Products) == 0 {
+			lines = append(lines, state.State+": None")
+			continue
+		}
+		lines = append(lines, state.State+": "+strings.Join(state.Products, "; "))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "None")
+	}
+	return formatDiscussionItem(HeadlinesSection, strings.Join(lines, "\n")), nil
+}
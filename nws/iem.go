@@ -0,0 +1,130 @@
+package nws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// IEMClient struct fetches products from the Iowa Environmental Mesonet's
+// archive of NWS text products, https://mesonet.agron.iastate.edu/wx/afos/
+type IEMClient struct {
+	BaseURI    string
+	UserAgent  string
+	HTTPClient *http.Client
+}
+
+// NewIEMClient returns a client with default params
+func NewIEMClient(httpClient *http.Client) *IEMClient {
+	return &IEMClient{
+		BaseURI:    "https://mesonet.agron.iastate.edu",
+		UserAgent:  DefaultUserAgent,
+		HTTPClient: httpClient,
+	}
+}
+
+// GetAFD returns the most recent Area Forecast Discussion in the archive
+func (s *IEMClient) GetAFD(ctx context.Context, locationID string) (*Product, error) {
+	pil := "AFD" + strings.ToUpper(locationID)
+	params := url.Values{
+		"pil":   {pil},
+		"limit": {"1"},
+		"fmt":   {"text"},
+	}
+	uri := s.BaseURI + "/cgi-bin/afos/retrieve.py?" + params.Encode()
+	req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", s.UserAgent)
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, newAPIError(resp.StatusCode, body)
+	}
+
+	// Strip the start and end of transmission characters around the text
+	text := strings.Trim(string(body), "\x01\x03\r\n ")
+	if !strings.Contains(text, pil) {
+		return nil, fmt.Errorf("Couldn't find %s in the IEM archive: %w", pil, ErrNotFound)
+	}
+	wmoHeader, _, _ := StripWMOHeader(NormalizeProductText(text))
+	fields := strings.Fields(wmoHeader)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("The IEM archive's %s has no WMO heading", pil)
+	}
+	issued, err := wmoIssuanceTime(fields[2], time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("The IEM archive's %s: %v", pil, err)
+	}
+	// The heading identifies the issuance, with any correction indicator
+	// telling a correction from the product it corrects
+	id := "iem-" + fields[1] + "-" + pil + "-" + strings.Join(fields[2:], "-")
+	return &Product{
+		ID:              id,
+		WmoCollectiveID: fields[0],
+		IssuingOffice:   fields[1],
+		IssuanceTime:    issued,
+		ProductCode:     "AFD",
+		ProductName:     "Area Forecast Discussion",
+		ProductText:     text,
+	}, nil
+}
+
+// wmoIssuanceTime returns the time of a WMO heading's DDHHMM, in UTC, in the
+// month up to a day after now
+func wmoIssuanceTime(ddhhmm string, now time.Time) (time.Time, error) {
+	parsed, err := time.Parse("021504", ddhhmm)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid WMO heading time %q", ddhhmm)
+	}
+	now = now.UTC()
+	for months := 0; months < 3; months++ {
+		year, month, _ := now.AddDate(0, -months, 0).Date()
+		issued := time.Date(year, month, parsed.Day(), parsed.Hour(), parsed.Minute(), 0, 0, time.UTC)
+		// Skip months too short for the day, which time.Date normalizes
+		if issued.Day() == parsed.Day() && !issued.After(now.Add(24*time.Hour)) {
+			return issued, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Invalid WMO heading time %q", ddhhmm)
+}
+
+// FallbackFetcher struct fetches AFDs from Primary, falling back to Fallback
+// when Primary fails
+type FallbackFetcher struct {
+	Primary  AFDFetcher
+	Fallback AFDFetcher
+	// OnFallback, if set, is called with Primary's error before trying
+	// Fallback
+	OnFallback func(locationID string, err error)
+}
+
+// GetAFD returns the AFD from whichever source has it
+func (s *FallbackFetcher) GetAFD(ctx context.Context, locationID string) (*Product, error) {
+	afd, err := s.Primary.GetAFD(ctx, locationID)
+	if err == nil || ctx.Err() != nil {
+		return afd, err
+	}
+	if s.OnFallback != nil {
+		s.OnFallback(locationID, err)
+	}
+
+	afd, fallbackErr := s.Fallback.GetAFD(ctx, locationID)
+	if fallbackErr != nil {
+		return nil, errors.Join(err, fmt.Errorf("fallback: %w", fallbackErr))
+	}
+	return afd, nil
+}
@@ -0,0 +1,57 @@
+package nws
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWMOIssuanceTime(t *testing.T) {
+	now := time.Date(2024, 3, 1, 2, 0, 0, 0, time.UTC)
+	tests := map[string]time.Time{
+		"010130": time.Date(2024, 3, 1, 1, 30, 0, 0, time.UTC),
+		"012300": time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC),
+		"291845": time.Date(2024, 2, 29, 18, 45, 0, 0, time.UTC),
+		"311200": time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC),
+	}
+	for ddhhmm, want := range tests {
+		if got, err := wmoIssuanceTime(ddhhmm, now); err != nil || !got.Equal(want) {
+			t.Errorf("wmoIssuanceTime(%q) = %v, %v, want %v", ddhhmm, got, err, want)
+		}
+	}
+	if _, err := wmoIssuanceTime("321200", now); err == nil {
+		t.Error("wmoIssuanceTime accepted day 32")
+	}
+}
+
+func TestFallbackFetcherKeepsErrors(t *testing.T) {
+	primary := &countingFetcher{err: context.DeadlineExceeded}
+	fallback := &countingFetcher{err: ErrNotFound}
+	fetcher := &FallbackFetcher{Primary: primary, Fallback: fallback}
+	_, err := fetcher.GetAFD(context.Background(), "BOX")
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetAFD returned %v, want both sources' errors", err)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := fetcher.GetAFD(canceled, "BOX"); !errors.Is(err, context.Canceled) || fallback.calls != 1 {
+		t.Errorf("GetAFD with a canceled context returned %v after %d fallbacks, want no fallback", err, fallback.calls)
+	}
+}
+
+func TestIEMClientErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	client := &IEMClient{BaseURI: server.URL, HTTPClient: server.Client()}
+	_, err := client.GetAFD(context.Background(), "BOX")
+	var apiErr *APIError
+	if !errors.Is(err, ErrServer) || !errors.As(err, &apiErr) || !apiErr.Temporary() {
+		t.Errorf("GetAFD returned %v, want a temporary ErrServer", err)
+	}
+}
@@ -0,0 +1,363 @@
+// Package nwstest provides a fake NWS API server for tests, serving canned
+// Area Forecast Discussions from a few offices.
+package nwstest
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/nws"
+	"golang.org/x/time/rate"
+)
+
+//go:embed fixtures/*.txt
+var fixtures embed.FS
+
+// FixtureIssuanceTime is when the canned discussions are issued
+var FixtureIssuanceTime = time.Date(2024, 10, 15, 12, 0, 0, 0, time.UTC)
+
+// FixtureOffices returns the offices with a canned discussion, sorted
+func FixtureOffices() []string {
+	entries, _ := fixtures.ReadDir("fixtures")
+	offices := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		offices = append(offices, strings.ToUpper(strings.TrimSuffix(entry.Name(), ".txt")))
+	}
+	sort.Strings(offices)
+	return offices
+}
+
+// Fixture returns the text of an office's canned discussion, or "" if it
+// has none. LOT's is split into zone segments.
+func Fixture(office string) string {
+	text, err := fixtures.ReadFile("fixtures/" + strings.ToLower(office) + ".txt")
+	if err != nil {
+		return ""
+	}
+	return string(text)
+}
+
+// Server struct is an httptest server answering the requests nws.Client
+// makes. It starts with each fixture issued at FixtureIssuanceTime.
+type Server struct {
+	*httptest.Server
+
+	mu sync.Mutex
+	// products maps each office to its discussions, newest first
+	products map[string][]nws.Product
+	points   map[string]nws.Point
+	failures map[string]int
+	requests int
+}
+
+// NewServer starts a server with the fixtures loaded. Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		products: make(map[string][]nws.Product),
+		points:   make(map[string]nws.Point),
+		failures: make(map[string]int),
+	}
+	for _, office := range FixtureOffices() {
+		s.AddAFD(office, Fixture(office), FixtureIssuanceTime)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /products", s.listProducts)
+	mux.HandleFunc("GET /products/{id}", s.getProduct)
+	mux.HandleFunc("GET /products/types/{type}/locations", s.listLocations)
+	mux.HandleFunc("GET /products/types/{type}/locations/{office}", s.listOfficeProducts)
+	mux.HandleFunc("GET /products/locations/{office}/types", s.listProductTypes)
+	mux.HandleFunc("GET /points/{coords}", s.getPoint)
+	s.Server = httptest.NewServer(s.count(mux))
+	return s
+}
+
+// NWSClient returns a client for the server that doesn't wait between
+// requests or retry
+func (s *Server) NWSClient() *nws.Client {
+	client := nws.NewClient(s.Client())
+	client.BaseURI = s.URL
+	client.Limiter = rate.NewLimiter(rate.Inf, 1)
+	client.Cache = nil
+	client.MaxRetries = 0
+	client.Breaker = nil
+	return client
+}
+
+// AddAFD adds a discussion for an office and returns it. The latest one
+// issued is served as the office's current discussion.
+func (s *Server) AddAFD(office string, text string, issued time.Time) nws.Product {
+	office = strings.ToUpper(office)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	product := nws.Product{
+		ID:              fmt.Sprintf("nwstest-%s-%d", office, len(s.products[office])+1),
+		WmoCollectiveID: "FXUS60",
+		IssuingOffice:   "K" + office,
+		IssuanceTime:    issued,
+		ProductCode:     "AFD",
+		ProductName:     "Area Forecast Discussion",
+		ProductText:     text,
+	}
+	products := append(s.products[office], product)
+	sort.SliceStable(products, func(i, j int) bool {
+		return products[i].IssuanceTime.After(products[j].IssuanceTime)
+	})
+	s.products[office] = products
+	return product
+}
+
+// AddPoint makes GetPoint for a latitude and longitude return point
+func (s *Server) AddPoint(lat float64, lon float64, point nws.Point) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.points[pointKey(lat, lon)] = point
+}
+
+// Fail makes every request for an office's products answer with status, or
+// stops failing them if status is 0
+func (s *Server) Fail(office string, status int) {
+	office = strings.ToUpper(office)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if status == 0 {
+		delete(s.failures, office)
+		return
+	}
+	s.failures[office] = status
+}
+
+// Requests returns how many requests the server has answered
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *Server) count(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests++
+		s.mu.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// failing answers with the office's configured failure, if any
+func (s *Server) failing(w http.ResponseWriter, office string) bool {
+	s.mu.Lock()
+	status, ok := s.failures[strings.ToUpper(office)]
+	s.mu.Unlock()
+	if ok {
+		writeProblem(w, status, "Failing "+strings.ToUpper(office)+" as configured")
+	}
+	return ok
+}
+
+func (s *Server) listProducts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	office := query.Get("location")
+	if s.failing(w, office) {
+		return
+	}
+	if productType := query.Get("type"); productType != "" && !strings.EqualFold(productType, "AFD") {
+		writeJSON(w, nws.Response{Products: []nws.Product{}})
+		return
+	}
+	var end time.Time
+	if raw := query.Get("end"); raw != "" {
+		var err error
+		if end, err = time.Parse(time.RFC3339, raw); err != nil {
+			writeProblem(w, http.StatusBadRequest, "Invalid end: "+raw)
+			return
+		}
+	}
+	limit, _ := strconv.Atoi(query.Get("limit"))
+
+	s.mu.Lock()
+	var products []nws.Product
+	for key, officeProducts := range s.products {
+		if office != "" && !strings.EqualFold(key, office) {
+			continue
+		}
+		products = append(products, officeProducts...)
+	}
+	s.mu.Unlock()
+	sort.SliceStable(products, func(i, j int) bool {
+		return products[i].IssuanceTime.After(products[j].IssuanceTime)
+	})
+
+	// Listings leave out the text, as the API does
+	listed := []nws.Product{}
+	for _, product := range products {
+		if !end.IsZero() && product.IssuanceTime.After(end) {
+			continue
+		}
+		product.ProductText = ""
+		listed = append(listed, product)
+		if limit > 0 && len(listed) == limit {
+			break
+		}
+	}
+	writeJSON(w, nws.Response{Products: listed})
+}
+
+func (s *Server) listOfficeProducts(w http.ResponseWriter, r *http.Request) {
+	office := r.PathValue("office")
+	if s.failing(w, office) {
+		return
+	}
+	s.mu.Lock()
+	listed := []nws.Product{}
+	if strings.EqualFold(r.PathValue("type"), "AFD") {
+		for _, product := range s.products[strings.ToUpper(office)] {
+			product.ProductText = ""
+			listed = append(listed, product)
+		}
+	}
+	s.mu.Unlock()
+	writeJSON(w, nws.Response{Products: listed})
+}
+
+func (s *Server) getProduct(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	s.mu.Lock()
+	var found nws.Product
+	for _, products := range s.products {
+		for _, product := range products {
+			if product.ID == id {
+				found = product
+			}
+		}
+	}
+	s.mu.Unlock()
+	if found.ID == "" {
+		writeProblem(w, http.StatusNotFound, "Product "+id+" not found")
+		return
+	}
+	if s.failing(w, strings.TrimPrefix(found.IssuingOffice, "K")) {
+		return
+	}
+	writeJSON(w, found)
+}
+
+func (s *Server) listLocations(w http.ResponseWriter, r *http.Request) {
+	locations := make(map[string]string)
+	s.mu.Lock()
+	if strings.EqualFold(r.PathValue("type"), "AFD") {
+		for office, products := range s.products {
+			locations[office] = officeName(products[0].ProductText, office)
+		}
+	}
+	s.mu.Unlock()
+	writeJSON(w, map[string]interface{}{"locations": locations})
+}
+
+func (s *Server) listProductTypes(w http.ResponseWriter, r *http.Request) {
+	office := r.PathValue("office")
+	if s.failing(w, office) {
+		return
+	}
+	types := []nws.ProductType{}
+	s.mu.Lock()
+	if len(s.products[strings.ToUpper(office)]) > 0 {
+		types = append(types, nws.ProductType{ProductCode: "AFD", ProductName: "Area Forecast Discussion"})
+	}
+	s.mu.Unlock()
+	writeJSON(w, map[string]interface{}{"@graph": types})
+}
+
+func (s *Server) getPoint(w http.ResponseWriter, r *http.Request) {
+	coords := strings.Split(r.PathValue("coords"), ",")
+	if len(coords) != 2 {
+		writeProblem(w, http.StatusBadRequest, "Invalid point "+r.PathValue("coords"))
+		return
+	}
+	lat, latErr := strconv.ParseFloat(coords[0], 64)
+	lon, lonErr := strconv.ParseFloat(coords[1], 64)
+	if latErr != nil || lonErr != nil {
+		writeProblem(w, http.StatusBadRequest, "Invalid point "+r.PathValue("coords"))
+		return
+	}
+	s.mu.Lock()
+	point, ok := s.points[pointKey(lat, lon)]
+	s.mu.Unlock()
+	if !ok {
+		writeProblem(w, http.StatusNotFound, "No data for point "+r.PathValue("coords"))
+		return
+	}
+
+	// Zones come back as URLs, as the API returns them
+	zoneURL := func(kind string, zone string) string {
+		if zone == "" {
+			return ""
+		}
+		return "https://api.weather.gov/zones/" + path.Join(kind, zone)
+	}
+	var resp struct {
+		Properties struct {
+			CWA              string `json:"cwa"`
+			ForecastZone     string `json:"forecastZone"`
+			County           string `json:"county"`
+			FireWeatherZone  string `json:"fireWeatherZone"`
+			TimeZone         string `json:"timeZone"`
+			RelativeLocation struct {
+				Properties struct {
+					City  string `json:"city"`
+					State string `json:"state"`
+				} `json:"properties"`
+			} `json:"relativeLocation"`
+		} `json:"properties"`
+	}
+	props := &resp.Properties
+	props.CWA = point.Office
+	props.ForecastZone = zoneURL("forecast", point.ForecastZone)
+	props.County = zoneURL("county", point.County)
+	props.FireWeatherZone = zoneURL("fire", point.FireWeatherZone)
+	props.TimeZone = point.TimeZone
+	props.RelativeLocation.Properties.City = point.City
+	props.RelativeLocation.Properties.State = point.State
+	writeJSON(w, resp)
+}
+
+// pointKey rounds a point as the client does, to four decimal places
+func pointKey(lat float64, lon float64) string {
+	return fmt.Sprintf("%.4f,%.4f", lat, lon)
+}
+
+// officeName finds the office's name in the discussion's header, e.g.
+// "National Weather Service Boston/Norton MA"
+func officeName(text string, office string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.ToUpper(line), "NATIONAL WEATHER SERVICE ") {
+			return strings.TrimSpace(line[len("National Weather Service "):])
+		}
+	}
+	return office
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/geo+json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeProblem answers with an application/problem+json error, as the API
+// does
+func writeProblem(w http.ResponseWriter, status int, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"title":  http.StatusText(status),
+		"status": status,
+		"detail": detail,
+	})
+}
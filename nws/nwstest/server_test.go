@@ -0,0 +1,61 @@
+package nwstest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/johnwcallahan/forecast-discussion-alerts/nws"
+)
+
+// TestServer checks that the client reads the fixtures, points and failures
+// the server is set up with
+func TestServer(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	client := server.NWSClient()
+	ctx := context.Background()
+
+	for _, office := range FixtureOffices() {
+		product, err := client.GetAFD(ctx, office)
+		if err != nil {
+			t.Fatalf("GetAFD(%s): %v", office, err)
+		}
+		if product.ProductText != Fixture(office) || !product.IssuanceTime.Equal(FixtureIssuanceTime) {
+			t.Errorf("GetAFD(%s) returned %s issued %s, not the fixture", office, product.ID, product.IssuanceTime)
+		}
+	}
+
+	newer := server.AddAFD("BOX", "Newer", FixtureIssuanceTime.Add(6*time.Hour))
+	if product, err := client.GetAFD(ctx, "box"); err != nil || product.ID != newer.ID {
+		t.Errorf("GetAFD(box) returned %v, %v, want %s", product, err, newer.ID)
+	}
+	if product, err := client.GetAFDAt(ctx, "box", FixtureIssuanceTime); err != nil || product.ProductText != Fixture("BOX") {
+		t.Errorf("GetAFDAt(box) returned %v, %v, want the fixture", product, err)
+	}
+
+	offices, err := client.ListOffices(ctx)
+	if err != nil || len(offices) != len(FixtureOffices()) {
+		t.Errorf("ListOffices returned %v, %v", offices, err)
+	}
+
+	server.AddPoint(42.36, -71.06, nws.Point{Office: "BOX", ForecastZone: "MAZ015", State: "MA"})
+	point, err := client.GetPoint(ctx, 42.36, -71.06)
+	if err != nil || point.Office != "BOX" || point.ForecastZone != "MAZ015" || point.State != "MA" {
+		t.Errorf("GetPoint returned %+v, %v", point, err)
+	}
+	if _, err := client.GetPoint(ctx, 0, 0); !errors.Is(err, nws.ErrNotFound) {
+		t.Errorf("GetPoint of an unknown point returned %v, want ErrNotFound", err)
+	}
+
+	server.Fail("OAX", http.StatusServiceUnavailable)
+	if _, err := client.GetAFD(ctx, "OAX"); !errors.Is(err, nws.ErrServer) {
+		t.Errorf("GetAFD of a failing office returned %v, want ErrServer", err)
+	}
+	server.Fail("OAX", 0)
+	if _, err := client.GetAFD(ctx, "OAX"); err != nil {
+		t.Errorf("GetAFD after failing stopped returned %v", err)
+	}
+}
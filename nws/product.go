@@ -0,0 +1,57 @@
+package nws
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Response struct which contains multiple products
+type Response struct {
+	Products []Product `json:"@graph"`
+}
+
+// Product struct which represents a product listing
+type Product struct {
+	ID              string    `json:"id"`
+	WmoCollectiveID string    `json:"wmoCollectiveId"`
+	IssuingOffice   string    `json:"issuingOffice"`
+	IssuanceTime    time.Time `json:"issuanceTime"`
+	ProductCode     string    `json:"productCode"`
+	ProductName     string    `json:"productName"`
+	ProductText     string    `json:"productText"`
+}
+
+// UnmarshalJSON parses the issuance time, leaving it zero when the API
+// returns it empty or null
+func (s *Product) UnmarshalJSON(data []byte) error {
+	type product Product
+	var raw struct {
+		product
+		IssuanceTime *string `json:"issuanceTime"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*s = Product(raw.product)
+	s.IssuanceTime = time.Time{}
+	if raw.IssuanceTime != nil && *raw.IssuanceTime != "" {
+		issued, err := time.Parse(time.RFC3339, *raw.IssuanceTime)
+		if err != nil {
+			return fmt.Errorf("Invalid issuanceTime %q: %v", *raw.IssuanceTime, err)
+		}
+		s.IssuanceTime = issued
+	}
+	return nil
+}
+
+// Age returns how long ago the product was issued
+func (s *Product) Age(now time.Time) time.Duration {
+	return now.Sub(s.IssuanceTime)
+}
+
+// GetDiscussionSection gets a section of the forecast discussion. To get
+// several sections, parse the product once with AFD instead.
+func (s *Product) GetDiscussionSection(sectionName string) (string, error) {
+	return s.AFD().GetDiscussionSection(sectionName)
+}
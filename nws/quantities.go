@@ -0,0 +1,144 @@
+package nws
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Kinds of quantity extracted from discussion text
+const (
+	QuantitySnow = "snow"
+	QuantityRain = "rain"
+	QuantityIce  = "ice"
+	QuantityWind = "wind"
+	QuantityGust = "gust"
+	QuantityPoP  = "pop"
+)
+
+// quantityRe matches a number or range followed by a unit, e.g. "6 inches",
+// "4 to 8 in", "0.25-0.50\"", "45 mph", "30 kt" or "60%"
+var quantityRe = regexp.MustCompile(`(?i)\b(\d+(?:\.\d+)?|\.\d+)(?:\s*(?:-|to)\s*(\d+(?:\.\d+)?|\.\d+))?\s*(inches|inch|in\b|"|cm\b|mm\b|mph\b|kts?\b|knots?\b|%|percent\b)`)
+
+// Words that say what an amount measures when they appear near it
+var (
+	snowRe = regexp.MustCompile(`(?i)\bsnow`)
+	rainRe = regexp.MustCompile(`(?i)\b(rain|qpf|precip)`)
+	iceRe  = regexp.MustCompile(`(?i)\b(ice|icing|freezing rain)\b`)
+	gustRe = regexp.MustCompile(`(?i)\bgust`)
+	popRe  = regexp.MustCompile(`(?i)\b(pops?|chance|probabilit)`)
+)
+
+// quantityContext is how far either side of a quantity to look for the word
+// saying what it measures
+const quantityContext = 40
+
+// Quantity struct is an amount mentioned in discussion text. Amounts are
+// converted to inches, speeds to mph and probabilities to percent.
+type Quantity struct {
+	// Kind is one of the Quantity constants
+	Kind string
+	// Min and Max are equal unless a range was given
+	Min  float64
+	Max  float64
+	Unit string
+	// Text is the quantity as written, e.g. "4 to 8 inches"
+	Text string
+}
+
+// ExtractQuantities finds the snow, rain and ice amounts, wind speeds and
+// gusts and probabilities mentioned in text. Amounts that can't be told
+// apart by the words around them are skipped.
+func ExtractQuantities(text string) []Quantity {
+	var quantities []Quantity
+	for _, loc := range quantityRe.FindAllStringSubmatchIndex(text, -1) {
+		min, err := strconv.ParseFloat(text[loc[2]:loc[3]], 64)
+		if err != nil {
+			continue
+		}
+		max := min
+		if loc[4] >= 0 {
+			if max, err = strconv.ParseFloat(text[loc[4]:loc[5]], 64); err != nil {
+				continue
+			}
+		}
+
+		before := text[maxInt(0, loc[0]-quantityContext):loc[0]]
+		after := text[loc[1]:minInt(len(text), loc[1]+quantityContext)]
+		near := before + " " + after
+
+		q := Quantity{Min: min, Max: max, Text: text[loc[0]:loc[1]]}
+		switch unit := strings.ToLower(text[loc[6]:loc[7]]); unit {
+		case "inches", "inch", "in", `"`, "cm", "mm":
+			// The nearest word wins, so "1 inch of rain then snow" is rain
+			q.Kind = nearestKind(before, after, map[string]*regexp.Regexp{
+				QuantitySnow: snowRe,
+				QuantityRain: rainRe,
+				QuantityIce:  iceRe,
+			})
+			q.Unit = "in"
+			if unit == "cm" {
+				q.Min, q.Max = q.Min/2.54, q.Max/2.54
+			} else if unit == "mm" {
+				q.Min, q.Max = q.Min/25.4, q.Max/25.4
+			}
+		case "mph", "kt", "kts", "knot", "knots":
+			q.Kind = QuantityWind
+			if gustRe.MatchString(near) {
+				q.Kind = QuantityGust
+			}
+			q.Unit = "mph"
+			if unit != "mph" {
+				q.Min, q.Max = q.Min*1.15078, q.Max*1.15078
+			}
+		case "%", "percent":
+			if popRe.MatchString(near) {
+				q.Kind = QuantityPoP
+			}
+			q.Unit = "%"
+		}
+		if q.Kind != "" {
+			quantities = append(quantities, q)
+		}
+	}
+	return quantities
+}
+
+// nearestKind returns the kind whose word appears closest to the quantity
+// between before and after it
+func nearestKind(before string, after string, kinds map[string]*regexp.Regexp) string {
+	kind := ""
+	distance := len(before) + len(after) + 1
+	for k, re := range kinds {
+		if locs := re.FindAllStringIndex(before, -1); locs != nil {
+			if d := len(before) - locs[len(locs)-1][1]; d < distance {
+				kind, distance = k, d
+			}
+		}
+		if loc := re.FindStringIndex(after); loc != nil {
+			if d := loc[0]; d < distance {
+				kind, distance = k, d
+			}
+		}
+	}
+	return kind
+}
+
+// Quantities returns the quantities mentioned in the section
+func (s Section) Quantities() []Quantity {
+	return ExtractQuantities(strings.Join(strings.Fields(s.Body), " "))
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
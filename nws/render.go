@@ -0,0 +1,142 @@
+package nws
+
+import (
+	"html"
+	"strings"
+)
+
+// markdownEscaper escapes the characters Markdown renderers such as Slack,
+// Discord and Telegram would otherwise treat as formatting
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "~", `\~`,
+	"[", `\[`, "]", `\]`, "|", `\|`, ">", `\>`, "#", `\#`,
+)
+
+// renderedBlock is a paragraph or list of a section's text
+type renderedBlock struct {
+	// Label is the update label of the part the block starts, e.g. "Update
+	// (issued 1040 AM PDT)"
+	Label string
+	Lines []string
+	List  bool
+}
+
+// blocks splits a section into the paragraphs and lists to render
+func (s Section) blocks() []renderedBlock {
+	var blocks []renderedBlock
+	for _, part := range s.Parts {
+		label := part.label()
+		for _, paragraph := range strings.Split(sanitizeString(part.Body), "\n\n") {
+			lines := strings.Split(paragraph, "\n")
+			if len(lines) == 1 || !bulletRe.MatchString(lines[len(lines)-1]) {
+				blocks = append(blocks, renderedBlock{Label: label, Lines: lines})
+				label = ""
+				continue
+			}
+			// Text before the first bullet introduces the list
+			start := 0
+			if !bulletRe.MatchString(lines[0]) {
+				blocks = append(blocks, renderedBlock{Label: label, Lines: lines[:1]})
+				label = ""
+				start = 1
+			}
+			items := make([]string, 0, len(lines)-start)
+			for _, line := range lines[start:] {
+				items = append(items, bulletRe.ReplaceAllString(line, ""))
+			}
+			blocks = append(blocks, renderedBlock{Label: label, Lines: items, List: true})
+			label = ""
+		}
+	}
+	return blocks
+}
+
+// title returns the name shown above the section
+func (s Section) title() string {
+	if s.Issued != "" {
+		return s.Name + " (issued " + s.Issued + ")"
+	}
+	return s.Name
+}
+
+// HTML renders the section as an HTML fragment for email and the web
+func (s Section) HTML() string {
+	var b strings.Builder
+	b.WriteString("<section>\n<h2>" + html.EscapeString(s.title()) + "</h2>\n")
+	for _, block := range s.blocks() {
+		if block.Label != "" {
+			b.WriteString("<p><strong>" + html.EscapeString(block.Label) + "</strong></p>\n")
+		}
+		if block.List {
+			b.WriteString("<ul>\n")
+			for _, item := range block.Lines {
+				b.WriteString("<li>" + html.EscapeString(item) + "</li>\n")
+			}
+			b.WriteString("</ul>\n")
+			continue
+		}
+		b.WriteString("<p>" + html.EscapeString(strings.Join(block.Lines, " ")) + "</p>\n")
+	}
+	b.WriteString("</section>\n")
+	return b.String()
+}
+
+// Markdown renders the section as Markdown for chat apps
+func (s Section) Markdown() string {
+	var blocks []string
+	blocks = append(blocks, "**"+markdownEscaper.Replace(s.title())+"**")
+	for _, block := range s.blocks() {
+		text := ""
+		if block.Label != "" {
+			text = "_" + markdownEscaper.Replace(block.Label) + "_\n"
+		}
+		if block.List {
+			items := make([]string, len(block.Lines))
+			for i, item := range block.Lines {
+				items[i] = "- " + markdownEscaper.Replace(item)
+			}
+			text += strings.Join(items, "\n")
+		} else {
+			text += markdownEscaper.Replace(strings.Join(block.Lines, " "))
+		}
+		blocks = append(blocks, text)
+	}
+	return strings.Join(blocks, "\n\n") + "\n"
+}
+
+// selected returns the named sections, or every section if no names are
+// given, skipping any the AFD doesn't have
+func (s *AFD) selected(names []string) []Section {
+	if len(names) == 0 {
+		names = s.Sections()
+	}
+	var sections []Section
+	for _, name := range names {
+		if section, ok := s.Section(name); ok {
+			sections = append(sections, section)
+		}
+	}
+	return sections
+}
+
+// HTML renders the named sections, or the whole discussion if no names are
+// given, as an HTML fragment
+func (s *AFD) HTML(names ...string) string {
+	var b strings.Builder
+	b.WriteString("<article>\n")
+	for _, section := range s.selected(names) {
+		b.WriteString(section.HTML())
+	}
+	b.WriteString("</article>\n")
+	return b.String()
+}
+
+// Markdown renders the named sections, or the whole discussion if no names
+// are given, as Markdown
+func (s *AFD) Markdown(names ...string) string {
+	var rendered []string
+	for _, section := range s.selected(names) {
+		rendered = append(rendered, section.Markdown())
+	}
+	return strings.Join(rendered, "\n")
+}
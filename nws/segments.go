@@ -0,0 +1,142 @@
+package nws
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ugcRe matches a UGC line, or lines, naming the zones or counties a segment
+// covers and when it expires, e.g. "ORZ001>004-006-WAZ039-151200-"
+var ugcRe = regexp.MustCompile(`(?m)^((?:[A-Z]{2}[CZ](?:\d{3}|ALL)|[>\-]|\d{3}|\n)+-\n?\d{6}-)[ \t]*$`)
+
+// segmentEndRe matches the "$$" line that ends each segment
+var segmentEndRe = regexp.MustCompile(`(?m)^\s*\$\$\s*$`)
+
+// Segment struct is one part of a product covering its own set of zones or
+// counties
+type Segment struct {
+	// UGC lists the zones and counties the segment covers, e.g. "ORZ001" and
+	// "ORC051". It's empty for a segment without a UGC line.
+	UGC []string
+	// Expires is the day, hour and minute in UTC the segment expires as
+	// written in the UGC line, e.g. "151200"
+	Expires string
+	// Text is the segment's text, starting after the UGC line
+	Text string
+}
+
+// Covers reports whether the segment covers any of the given zones or
+// counties, or covers everything because it has no UGC line
+func (s Segment) Covers(zones ...string) bool {
+	if len(s.UGC) == 0 {
+		return true
+	}
+	for _, zone := range zones {
+		zone = strings.ToUpper(zone)
+		for _, code := range s.UGC {
+			if code == zone || (strings.HasSuffix(code, "ALL") && code[:3] == zone[:minInt(3, len(zone))]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParseSegments splits product text into its "$$"-separated segments. Text
+// before the first UGC line, or the whole product if there are none, is the
+// product header and is returned separately.
+func ParseSegments(text string) (string, []Segment) {
+	text = NormalizeProductText(text)
+	ugcs := ugcRe.FindAllStringSubmatchIndex(text, -1)
+	if len(ugcs) == 0 {
+		return text, nil
+	}
+
+	header := text[:ugcs[0][0]]
+	var segments []Segment
+	for i, loc := range ugcs {
+		end := len(text)
+		if i+1 < len(ugcs) {
+			end = ugcs[i+1][0]
+		}
+		body := text[loc[1]:end]
+		if stop := segmentEndRe.FindStringIndex(body); stop != nil {
+			body = body[:stop[0]]
+		}
+		codes, expires, err := ParseUGC(text[loc[2]:loc[3]])
+		if err != nil {
+			continue
+		}
+		segments = append(segments, Segment{UGC: codes, Expires: expires, Text: strings.TrimSpace(body)})
+	}
+	return header, segments
+}
+
+// ParseUGC expands a UGC string such as "ORZ001>004-006-WAZ039-151200-" into
+// the codes it covers, ORZ001 to ORZ004, ORZ006 and WAZ039, and its
+// expiration time
+func ParseUGC(ugc string) ([]string, string, error) {
+	ugc = strings.Join(strings.Fields(ugc), "")
+	tokens := strings.Split(strings.Trim(ugc, "-"), "-")
+	if len(tokens) < 2 {
+		return nil, "", fmt.Errorf("Invalid UGC %s", ugc)
+	}
+	expires := tokens[len(tokens)-1]
+
+	var codes []string
+	prefix := ""
+	for _, token := range tokens[:len(tokens)-1] {
+		for j, part := range strings.Split(token, ">") {
+			if len(part) == 6 {
+				prefix, part = part[:3], part[3:]
+			}
+			if prefix == "" || len(part) != 3 {
+				return nil, "", fmt.Errorf("Invalid UGC %s", ugc)
+			}
+			if j == 0 || part == "ALL" {
+				codes = append(codes, prefix+part)
+				continue
+			}
+			// A range from the previous code, e.g. "001>004"
+			from, err := strconv.Atoi(codes[len(codes)-1][3:])
+			if err != nil {
+				return nil, "", fmt.Errorf("Invalid UGC %s", ugc)
+			}
+			to, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, "", fmt.Errorf("Invalid UGC %s", ugc)
+			}
+			for n := from + 1; n <= to; n++ {
+				codes = append(codes, fmt.Sprintf("%s%03d", prefix, n))
+			}
+		}
+	}
+	return codes, expires, nil
+}
+
+// Segments splits the product into its segments, see ParseSegments
+func (s *Product) Segments() []Segment {
+	_, segments := ParseSegments(s.ProductText)
+	return segments
+}
+
+// AFDFor parses the product as an Area Forecast Discussion for someone in
+// the given zones or counties. If the product is split into segments by
+// zone, only the first segment covering them is parsed, under the product's
+// header.
+func (s *Product) AFDFor(zones ...string) *AFD {
+	header, segments := ParseSegments(s.ProductText)
+	if len(segments) < 2 {
+		return s.AFD()
+	}
+	for _, segment := range segments {
+		if segment.Covers(zones...) {
+			afd := ParseAFD(header + "\n" + segment.Text + "\n$$\n")
+			afd.Signatures = parseSignatures(s.ProductText)
+			return afd
+		}
+	}
+	return s.AFD()
+}
@@ -0,0 +1,137 @@
+package nws
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Severity levels, by the lowest score that reaches them
+const (
+	SeverityLow      = "low"
+	SeverityModerate = "moderate"
+	SeverityHigh     = "high"
+	SeverityExtreme  = "extreme"
+)
+
+// severityTerm struct is a phrase that raises the urgency of a discussion
+type severityTerm struct {
+	re     *regexp.Regexp
+	phrase string
+	weight int
+}
+
+func newSeverityTerm(phrase string, weight int) severityTerm {
+	return severityTerm{
+		re:     regexp.MustCompile(`(?i)\b` + strings.Replace(regexp.QuoteMeta(phrase), " ", `\s+`, -1) + `\b`),
+		phrase: phrase,
+		weight: weight,
+	}
+}
+
+// severityTerms are scored once each however often they appear
+var severityTerms = []severityTerm{
+	newSeverityTerm("particularly dangerous situation", 40),
+	newSeverityTerm("life-threatening", 30),
+	newSeverityTerm("tornado emergency", 50),
+	newSeverityTerm("flash flood emergency", 50),
+	newSeverityTerm("tornado", 25),
+	newSeverityTerm("hurricane", 30),
+	newSeverityTerm("tropical storm", 15),
+	newSeverityTerm("blizzard", 25),
+	newSeverityTerm("ice storm", 25),
+	newSeverityTerm("flash flood", 20),
+	newSeverityTerm("excessive heat", 20),
+	newSeverityTerm("extreme heat", 20),
+	newSeverityTerm("severe thunderstorm", 15),
+	newSeverityTerm("damaging winds", 10),
+	newSeverityTerm("large hail", 10),
+	newSeverityTerm("heavy snow", 10),
+	newSeverityTerm("atmospheric river", 10),
+	newSeverityTerm("red flag", 10),
+	newSeverityTerm("record", 5),
+	newSeverityTerm("dense fog", 5),
+}
+
+// Points per product in effect in the headlines block
+const (
+	headlineWarningWeight  = 15
+	headlineWatchWeight    = 10
+	headlineAdvisoryWeight = 4
+)
+
+// severityRanks orders the levels
+var severityRanks = map[string]int{SeverityLow: 0, SeverityModerate: 1, SeverityHigh: 2, SeverityExtreme: 3}
+
+// Severity struct rates how urgent an issuance of a discussion is
+type Severity struct {
+	// Score is from 0, routine, to 100
+	Score int
+	// Level is one of the Severity constants
+	Level string
+	// Reasons lists what contributed to the score, e.g. "tornado" or
+	// "OR: High Wind Warning until 5 PM PDT"
+	Reasons []string
+}
+
+// SeverityLevel returns the level of a score
+func SeverityLevel(score int) string {
+	switch {
+	case score >= 75:
+		return SeverityExtreme
+	case score >= 40:
+		return SeverityHigh
+	case score >= 15:
+		return SeverityModerate
+	}
+	return SeverityLow
+}
+
+// AtLeast reports whether the severity reaches the given level. Unknown
+// levels are always reached.
+func (s Severity) AtLeast(level string) bool {
+	rank, ok := severityRanks[strings.ToLower(level)]
+	return !ok || severityRanks[s.Level] >= rank
+}
+
+// Severity scores the discussion by the warning-related terms in its text and
+// the products in effect in its headlines block
+func (s *AFD) Severity() Severity {
+	var severity Severity
+	headlines, _ := s.headlinesSection()
+
+	var text []string
+	for _, section := range s.sections {
+		if section.Name != headlines.Name {
+			text = append(text, section.Body)
+		}
+	}
+	body := strings.Join(text, "\n")
+	for _, term := range severityTerms {
+		if term.re.MatchString(body) {
+			severity.Score += term.weight
+			severity.Reasons = append(severity.Reasons, term.phrase)
+		}
+	}
+
+	states, _ := s.Headlines()
+	for _, state := range states {
+		for _, product := range state.Products {
+			weight := headlineAdvisoryWeight
+			lower := strings.ToLower(product)
+			switch {
+			case strings.Contains(lower, "warning"):
+				weight = headlineWarningWeight
+			case strings.Contains(lower, "watch"):
+				weight = headlineWatchWeight
+			}
+			severity.Score += weight
+			severity.Reasons = append(severity.Reasons, state.State+": "+product)
+		}
+	}
+
+	if severity.Score > 100 {
+		severity.Score = 100
+	}
+	severity.Level = SeverityLevel(severity.Score)
+	return severity
+}
@@ -0,0 +1,68 @@
+package nws
+
+import (
+	"regexp"
+	"strings"
+)
+
+// signatureRe matches a signature line naming the forecaster of one section,
+// e.g. "SHORT TERM...JDS" or "Aviation....Smith"
+var signatureRe = regexp.MustCompile(`^([A-Za-z][A-Za-z /]*?)\s*\.{2,}\s*(\S.*)$`)
+
+// Signature struct is one forecaster signature from the end of an AFD
+type Signature struct {
+	// Section is the normalized name of the section the forecaster wrote, or
+	// empty if the signature covers the whole discussion
+	Section string
+	// Forecaster is the name or initials as signed, e.g. "JDS"
+	Forecaster string
+}
+
+// parseSignatures parses the signatures after the last "$$" of an AFD
+func parseSignatures(text string) []Signature {
+	i := strings.LastIndex(text, "$$")
+	if i < 0 {
+		return nil
+	}
+
+	var signatures []Signature
+	for _, line := range strings.Split(text[i+2:], "\n") {
+		line = strings.TrimSpace(line)
+		// Some offices end with a link to their web site
+		if line == "" || strings.Contains(line, "://") || strings.Contains(strings.ToLower(line), "weather.gov") {
+			continue
+		}
+		if m := signatureRe.FindStringSubmatch(line); m != nil {
+			signatures = append(signatures, Signature{Section: NormalizeSectionName(m[1]), Forecaster: m[2]})
+		} else {
+			signatures = append(signatures, Signature{Forecaster: line})
+		}
+	}
+	return signatures
+}
+
+// Forecasters returns the names of everyone who signed the discussion, each
+// once, in the order they signed
+func (s *AFD) Forecasters() []string {
+	var names []string
+	for _, signature := range s.Signatures {
+		if !containsName(names, signature.Forecaster) {
+			names = append(names, signature.Forecaster)
+		}
+	}
+	return names
+}
+
+// SignatureFor returns who wrote the named section: the forecaster who signed
+// for it or one of its aliases, or everyone who signed the discussion if the
+// office doesn't sign sections separately
+func (s *AFD) SignatureFor(sectionName string) string {
+	for _, alias := range s.sectionNameAliases(NormalizeSectionName(sectionName)) {
+		for _, signature := range s.Signatures {
+			if signature.Section == alias {
+				return signature.Forecaster
+			}
+		}
+	}
+	return strings.Join(s.Forecasters(), ", ")
+}
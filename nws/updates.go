@@ -0,0 +1,112 @@
+package nws
+
+import (
+	"regexp"
+	"strings"
+)
+
+// issuedRe matches the issuance markers offices put in section headings and
+// at the start of updated text, e.g. "/issued 415 AM PDT/" or "Issued at 1040
+// AM PDT Thu Oct 15 2026"
+var issuedRe = regexp.MustCompile(`(?i)/?\s*\b(?:issued|updated)(?:\s+at)?\s+(\d{1,4}\s*[AP]M\s+[A-Z]{2,5}(?:\s+[A-Z]{3}\s+[A-Z]{3}\s+\d{1,2}\s+\d{4})?)\s*/?\.?`)
+
+// partRe matches the labels that split a section into the latest update and
+// the discussion it updates, e.g. "UPDATE..." and "PREVIOUS DISCUSSION..."
+var partRe = regexp.MustCompile(`(?m)^\s*(UPDATE|PREVIOUS DISCUSSION|PREV DISCUSSION)\s*\.\.\.`)
+
+// SectionPart struct is a portion of a section written at one time. Offices
+// that update a discussion during the day put the new text first, labelled
+// "UPDATE", followed by the earlier text labelled "PREVIOUS DISCUSSION".
+type SectionPart struct {
+	// Label is "UPDATE", "PREVIOUS DISCUSSION", or empty for unlabelled text
+	Label string
+	// Issued is the time the part was written as given by the office, e.g.
+	// "415 AM PDT", or empty if it isn't given
+	Issued string
+	// Body is the unformatted text of the part without its label and
+	// issuance marker
+	Body string
+}
+
+// IsUpdate reports whether the part is new text added to the discussion since
+// it was first issued
+func (s SectionPart) IsUpdate() bool {
+	return s.Label == "UPDATE"
+}
+
+// label returns how the part is introduced in a message, e.g. "Update
+// (issued 1040 AM PDT)", or an empty string for unlabelled text
+func (s SectionPart) label() string {
+	if s.Label == "" {
+		return ""
+	}
+	label := s.Label[:1] + strings.ToLower(s.Label[1:])
+	if s.Issued != "" {
+		label += " (issued " + s.Issued + ")"
+	}
+	return label
+}
+
+// findIssued returns the time in the first issuance marker in s
+func findIssued(s string) string {
+	if m := issuedRe.FindStringSubmatch(s); m != nil {
+		return strings.Join(strings.Fields(m[1]), " ")
+	}
+	return ""
+}
+
+// cutIssued removes an issuance marker from the start of s, returning the
+// time it gives and the remaining text
+func cutIssued(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	loc := issuedRe.FindStringSubmatchIndex(s)
+	if loc == nil || loc[0] != 0 {
+		return "", s
+	}
+	return strings.Join(strings.Fields(s[loc[2]:loc[3]]), " "), strings.TrimSpace(s[loc[1]:])
+}
+
+// parseSectionParts splits the body of a section into its labelled parts
+func parseSectionParts(body string) []SectionPart {
+	var parts []SectionPart
+	add := func(label string, text string) {
+		issued, text := cutIssued(text)
+		if label == "" && issued == "" && text == "" {
+			return
+		}
+		parts = append(parts, SectionPart{Label: label, Issued: issued, Body: text})
+	}
+
+	labels := partRe.FindAllStringSubmatchIndex(body, -1)
+	if len(labels) == 0 {
+		add("", body)
+		return parts
+	}
+	add("", body[:labels[0][0]])
+	for i, loc := range labels {
+		end := len(body)
+		if i+1 < len(labels) {
+			end = labels[i+1][0]
+		}
+		label := body[loc[2]:loc[3]]
+		if label == "PREV DISCUSSION" {
+			label = "PREVIOUS DISCUSSION"
+		}
+		add(label, body[loc[1]:end])
+	}
+	return parts
+}
+
+// formatSectionParts formats the parts of a section for sending, labelling
+// updates and the earlier discussion with the time they were issued
+func formatSectionParts(parts []SectionPart) string {
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		text := Reflow(part.Body, DefaultMaxParagraphLength)
+		if label := part.label(); label != "" {
+			text = label + ": " + text
+		}
+		texts = append(texts, text)
+	}
+	return strings.Join(texts, "\n\n")
+}
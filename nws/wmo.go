@@ -0,0 +1,50 @@
+package nws
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// wmoHeaderRe matches the WMO abbreviated heading, e.g. "FXUS66 KPQR
+	// 151030", optionally followed by a correction or amendment indicator
+	wmoHeaderRe = regexp.MustCompile(`^[A-Z]{4}\d{2} [A-Z]{4} \d{6}(?: [A-Z]{3})?$`)
+	// awipsIDRe matches the AWIPS product ID line, e.g. "AFDPQR"
+	awipsIDRe = regexp.MustCompile(`^[A-Z0-9]{4,6}$`)
+	// sequenceRe matches the transmission sequence number some feeds start
+	// products with, e.g. "000" or "123"
+	sequenceRe = regexp.MustCompile(`^\d{3}$`)
+)
+
+// productTextReplacer normalizes line endings, including the "\r\r\n" of raw
+// NOAAPort text, and drops its start and end of message characters
+var productTextReplacer = strings.NewReplacer("\r\r\n", "\n", "\r\n", "\n", "\r", "\n", "\x01", "", "\x03", "")
+
+// NormalizeProductText normalizes the line endings and control characters
+// that differ between the NWS API and raw feeds such as the IEM archive
+func NormalizeProductText(text string) string {
+	return productTextReplacer.Replace(text)
+}
+
+// StripWMOHeader splits the WMO heading and AWIPS ID lines from the start of
+// normalized product text, returning the heading, the ID and the rest of the
+// text. Missing lines are returned empty.
+func StripWMOHeader(text string) (string, string, string) {
+	var wmoHeader, awipsID string
+	lines := strings.Split(text, "\n")
+	i := 0
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		switch {
+		case line == "":
+		case wmoHeader == "" && awipsID == "" && sequenceRe.MatchString(line):
+		case wmoHeader == "" && awipsID == "" && wmoHeaderRe.MatchString(line):
+			wmoHeader = line
+		case awipsID == "" && awipsIDRe.MatchString(line):
+			awipsID = line
+		default:
+			return wmoHeader, awipsID, strings.Join(lines[i:], "\n")
+		}
+	}
+	return wmoHeader, awipsID, ""
+}